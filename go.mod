@@ -6,5 +6,7 @@ require (
 	github.com/google/uuid v1.1.1
 	github.com/jinzhu/gorm v1.9.16
 	github.com/lib/pq v1.1.1
+	github.com/prometheus/client_golang v1.11.0
 	github.com/stretchr/testify v1.6.1
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,34 @@
+package trace
+
+import "github.com/jinzhu/gorm"
+
+// Scope settings copied into GormEvent.Vars so call sites can be labelled
+// for filtering trace output later:
+//
+//	db.Set(trace.TagKey, "checkout-flow").Create(&order)
+//	db.Set(trace.AnnotationsKey, map[string]string{"flow": "checkout"})
+const (
+	TagKey         = "gormsanity:tag"
+	AnnotationsKey = "gormsanity:annotations"
+)
+
+// Tag returns a handle of db whose operations are tagged with tag.
+func Tag(db *gorm.DB, tag string) *gorm.DB {
+	return db.Set(TagKey, tag)
+}
+
+// Annotate returns a handle of db whose operations carry the annotation
+// key=value in addition to those already set on db.
+func Annotate(db *gorm.DB, key, value string) *gorm.DB {
+	annotations := map[string]string{}
+	if v, ok := db.Get(AnnotationsKey); ok {
+		// Copy rather than modify the map other handles share.
+		if existing, ok := v.(map[string]string); ok {
+			for k, v := range existing {
+				annotations[k] = v
+			}
+		}
+	}
+	annotations[key] = value
+	return db.Set(AnnotationsKey, annotations)
+}
@@ -0,0 +1,30 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestAnnotations(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	checkout := Annotate(Annotate(Tag(db, "checkout-flow"), "step", "payment"), "cart", "42")
+	a.NoError(checkout.Create(&models.Account{EmailAddress: "tag@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(Annotate(db, "step", "lookup").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Set(TagKey, "raw").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Operations()
+	a.Len(events, 3)
+	a.Equal("checkout-flow", events[0].Vars[TagKey])
+	a.Equal(map[string]string{"step": "payment", "cart": "42"}, events[0].Vars[AnnotationsKey])
+	a.Equal(map[string]string{"step": "lookup"}, events[1].Vars[AnnotationsKey])
+	a.NotContains(events[1].Vars, TagKey)
+	a.Equal("raw", events[2].Vars[TagKey])
+}
@@ -0,0 +1,157 @@
+package trace
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AsyncSink moves writing off the GORM callback path. Events are queued on
+// a bounded channel and written to the wrapped sink by a background
+// goroutine, which flushes it every FlushInterval or after BatchSize
+// events. When the queue is full events are dropped rather than blocking
+// the query; see Dropped. The configuration fields must be set before the
+// first event is written.
+type AsyncSink struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	// OnError is called from the background goroutine with the errors of
+	// the wrapped sink, which has no caller to return them to.
+	OnError func(error)
+
+	next    Sink
+	dropped uint64
+
+	once   sync.Once
+	mu     sync.RWMutex
+	closed bool
+	queue  chan asyncOp
+	done   chan struct{}
+}
+
+type asyncOp struct {
+	event   *GormEvent
+	flushed chan struct{}
+}
+
+// NewAsyncSink wraps next with a queue of 1024 events flushed every second
+// or every 100 events.
+func NewAsyncSink(next Sink) *AsyncSink {
+	return &AsyncSink{
+		QueueSize:     1024,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		next:          next,
+	}
+}
+
+// Dropped returns the number of events discarded because the queue was
+// full, plus those dropped by the wrapped sink.
+func (s *AsyncSink) Dropped() uint64 {
+	dropped := atomic.LoadUint64(&s.dropped)
+	if d, ok := s.next.(dropCounter); ok {
+		dropped += d.Dropped()
+	}
+	return dropped
+}
+
+func (s *AsyncSink) start() {
+	s.once.Do(func() {
+		s.queue = make(chan asyncOp, s.QueueSize)
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *AsyncSink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.FlushInterval)
+	defer ticker.Stop()
+
+	pending := 0
+	for {
+		select {
+		case op, ok := <-s.queue:
+			if !ok {
+				s.report(s.next.Flush())
+				return
+			}
+			if op.flushed != nil {
+				s.report(s.next.Flush())
+				pending = 0
+				close(op.flushed)
+				continue
+			}
+			s.report(s.next.Write(op.event))
+			pending++
+			if pending >= s.BatchSize {
+				s.report(s.next.Flush())
+				pending = 0
+			}
+		case <-ticker.C:
+			if pending > 0 {
+				s.report(s.next.Flush())
+				pending = 0
+			}
+		}
+	}
+}
+
+func (s *AsyncSink) report(err error) {
+	if err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+func (s *AsyncSink) Write(event *GormEvent) error {
+	s.start()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errSinkClosed
+	}
+
+	select {
+	case s.queue <- asyncOp{event: event}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+// Flush blocks until every queued event has been written and the wrapped
+// sink flushed.
+func (s *AsyncSink) Flush() error {
+	s.start()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	s.queue <- asyncOp{flushed: flushed}
+	<-flushed
+	return nil
+}
+
+// Close drains the queue and closes the wrapped sink.
+func (s *AsyncSink) Close() error {
+	s.start()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	return s.next.Close()
+}
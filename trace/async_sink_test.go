@@ -0,0 +1,76 @@
+package trace
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// blockingSink holds up writes until release is closed.
+type blockingSink struct {
+	memorySink
+	release chan struct{}
+}
+
+func (s *blockingSink) Write(event *GormEvent) error {
+	<-s.release
+	return s.memorySink.Write(event)
+}
+
+func TestAsyncSink(t *testing.T) {
+	a := require.New(t)
+	next := &memorySink{}
+
+	sink := NewAsyncSink(next)
+	sink.FlushInterval = time.Hour
+	for i := 0; i < 10; i++ {
+		a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	}
+	a.NoError(sink.Flush())
+	a.Len(next.Events(), 10)
+
+	a.NoError(sink.Close())
+	a.True(next.closed)
+	a.Error(sink.Write(&GormEvent{}))
+}
+
+func TestAsyncSink_DropsWhenFull(t *testing.T) {
+	a := require.New(t)
+	next := &blockingSink{release: make(chan struct{})}
+
+	sink := NewAsyncSink(next)
+	sink.QueueSize = 1
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// The first event is picked up by the worker and blocks it, the
+		// second fills the queue and the rest are dropped.
+		for i := 0; i < 5; i++ {
+			sink.Write(&GormEvent{EventType: "query"})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	wg.Wait()
+
+	close(next.release)
+	a.NoError(sink.Close())
+	a.Equal(uint64(5), sink.Dropped()+uint64(len(next.Events())))
+	a.True(sink.Dropped() >= 3)
+}
+
+func TestAsyncSink_OnError(t *testing.T) {
+	a := require.New(t)
+
+	var errs []error
+	sink := NewAsyncSink(&failingSink{})
+	sink.OnError = func(err error) { errs = append(errs, err) }
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	a.NoError(sink.Close())
+
+	a.Len(errs, 1)
+	a.Contains(errs[0].Error(), "disk full")
+}
@@ -0,0 +1,49 @@
+package trace
+
+import (
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// callerSkip lists the packages whose frames are never the caller of an
+// operation: gorm's and this one's, apart from its tests.
+var callerSkip = []string{
+	"github.com/jinzhu/gorm.",
+	reflect.TypeOf(Tracer{}).PkgPath() + ".",
+}
+
+// caller returns the file:line and function of the first frame outside
+// gorm, this package and the packages in skip.
+func caller(skip []string) (string, string) {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !skipFrame(frame, skip) {
+			return frame.File + ":" + strconv.Itoa(frame.Line), frame.Function
+		}
+		if !more {
+			return "", ""
+		}
+	}
+}
+
+func skipFrame(frame runtime.Frame, skip []string) bool {
+	for _, prefix := range skip {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	if strings.HasSuffix(frame.File, "_test.go") {
+		return false
+	}
+	for _, prefix := range callerSkip {
+		if strings.HasPrefix(frame.Function, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/jinzhu/gorm"
+)
+
+// FieldChange is a column written by an update. New is the value written
+// and Old the value the model held before, when it differs. Old is only
+// known when the event starts before gorm assigns the update to the model,
+// e.g. with WithCallbackPlacement("update", First(), Last()).
+type FieldChange struct {
+	Column string      `json:"column"`
+	Old    interface{} `json:"old,omitempty"`
+	New    interface{} `json:"new,omitempty"`
+}
+
+// fieldValues snapshots the columns of the model an operation works on,
+// so an update can report what it changed.
+func fieldValues(scope *gorm.Scope) map[string]interface{} {
+	if scope.Value == nil || scope.IndirectValue().Kind() != reflect.Struct {
+		return nil
+	}
+	values := map[string]interface{}{}
+	for _, f := range scope.Fields() {
+		if f.IsNormal && !f.IsIgnored {
+			values[f.DBName] = f.Field.Interface()
+		}
+	}
+	return values
+}
+
+// fieldChanges lists the columns an update wrote, sorted by name: those
+// given to Update and Updates, or every column for Save. Values are left
+// out when namesOnly is set.
+func fieldChanges(scope *gorm.Scope, initial map[string]interface{}, namesOnly bool) []FieldChange {
+	updates := map[string]interface{}{}
+	if attrs, ok := scope.InstanceGet("gorm:update_attrs"); ok {
+		updates, _ = attrs.(map[string]interface{})
+	} else if scope.Value != nil && scope.IndirectValue().Kind() == reflect.Struct {
+		for _, f := range scope.Fields() {
+			if f.IsNormal && !f.IsIgnored && !f.IsPrimaryKey {
+				updates[f.DBName] = f.Field.Interface()
+			}
+		}
+	}
+
+	var changes []FieldChange
+	for column, value := range updates {
+		change := FieldChange{Column: column}
+		if !namesOnly {
+			change.New = value
+			if old, ok := initial[column]; ok && !reflect.DeepEqual(old, value) {
+				change.Old = old
+			}
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Column < changes[j].Column })
+	return changes
+}
@@ -0,0 +1,16 @@
+package trace
+
+import "time"
+
+// Clock tells the tracer the time, see WithClock.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the default clock. Its times carry a monotonic reading,
+// so durations aren't skewed by changes to the wall clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
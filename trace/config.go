@@ -0,0 +1,369 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config describes a tracer in a file, so it can be tuned by people who
+// don't change the code. Files ending in .json are read as JSON, others as
+// YAML:
+//
+//	name: primary
+//	sample_rate: 0.1
+//	min_duration: 50ms
+//	event_types: [create, update, delete]
+//	disable_rules: [zero_insert_value]
+//	rules:
+//	  n_plus_one: {severity: error}
+//	  hard_delete: {enabled: false}
+//	suppress:
+//	  - {rule: n_plus_one, fingerprint: 3f1c0d2b9e8a7f60}
+//	  - {caller: legacy/report.go}
+//	slow_thresholds: {all: 500ms, query: 100ms}
+//	slow_tables: {audit_log: 2s}
+//	zero_row_writes: true
+//	zero_row_allow: [3f1c0d2b9e8a7f60]
+//	redact_vars: true
+//	verbosity: summary
+//	sinks:
+//	  - type: file
+//	    path: /var/log/app/gorm.log
+//	    max_size: 104857600
+//	    max_files: 5
+//	  - type: http
+//	    url: https://collector.internal/events
+type Config struct {
+	Name           string                `json:"name" yaml:"name"`
+	Service        string                `json:"service" yaml:"service"`
+	ServiceVersion string                `json:"service_version" yaml:"service_version"`
+	Tags           map[string]string     `json:"tags" yaml:"tags"`
+	SampleRate     *float64              `json:"sample_rate" yaml:"sample_rate"`
+	MinDuration    string                `json:"min_duration" yaml:"min_duration"`
+	ErrorsOnly     bool                  `json:"errors_only" yaml:"errors_only"`
+	EventTypes     []string              `json:"event_types" yaml:"event_types"`
+	Tables         []string              `json:"tables" yaml:"tables"`
+	DisableRules   []string              `json:"disable_rules" yaml:"disable_rules"`
+	Rules          map[string]RuleConfig `json:"rules" yaml:"rules"`
+	Suppress       []Suppression         `json:"suppress" yaml:"suppress"`
+	SlowThresholds map[string]string     `json:"slow_thresholds" yaml:"slow_thresholds"`
+	SlowTables     map[string]string     `json:"slow_tables" yaml:"slow_tables"`
+	ZeroRowWrites  bool                  `json:"zero_row_writes" yaml:"zero_row_writes"`
+	ZeroRowAllow   []string              `json:"zero_row_allow" yaml:"zero_row_allow"`
+	RedactVars     bool                  `json:"redact_vars" yaml:"redact_vars"`
+	Verbosity      string                `json:"verbosity" yaml:"verbosity"`
+	Async          bool                  `json:"async" yaml:"async"`
+	Sinks          []SinkConfig          `json:"sinks" yaml:"sinks"`
+}
+
+// RuleConfig configures a rule by its ID, see Tracer.Rules. Severity is
+// "info", "warn" or "error", and Enabled false turns the rule off as
+// disable_rules does, while true overrides disable_rules.
+type RuleConfig struct {
+	Enabled  *bool  `json:"enabled" yaml:"enabled"`
+	Severity string `json:"severity" yaml:"severity"`
+}
+
+// SinkConfig describes one sink. Type selects the sink, and which of the
+// other fields apply:
+//
+//	stdout, stderr, pretty  format
+//	file                    path, format, max_size, max_files, max_age, compress
+//	http                    url, headers, format
+//	otlp                    url, reporting the config's service name
+//	socket                  network, address, format
+//	syslog                  network, address, tag
+//	fluent                  network, address, tag
+//	parquet                 path
+//
+// Format is "json" (the default), "csv" or "msgpack".
+type SinkConfig struct {
+	Type     string            `json:"type" yaml:"type"`
+	Format   string            `json:"format" yaml:"format"`
+	Path     string            `json:"path" yaml:"path"`
+	URL      string            `json:"url" yaml:"url"`
+	Headers  map[string]string `json:"headers" yaml:"headers"`
+	Network  string            `json:"network" yaml:"network"`
+	Address  string            `json:"address" yaml:"address"`
+	Tag      string            `json:"tag" yaml:"tag"`
+	MaxSize  int64             `json:"max_size" yaml:"max_size"`
+	MaxFiles int               `json:"max_files" yaml:"max_files"`
+	MaxAge   string            `json:"max_age" yaml:"max_age"`
+	Compress bool              `json:"compress" yaml:"compress"`
+}
+
+// LoadConfig reads the config file at path and returns an option applying
+// it. Options passed after it take precedence, until Tracer.Reload applies
+// the settings the file sets on top of them.
+func LoadConfig(path string) (Option, error) {
+	cfg, err := readConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	opt, err := cfg.Option()
+	if err != nil {
+		return nil, fmt.Errorf("gormsanity: %s: %v", path, err)
+	}
+	return func(t *Tracer) {
+		t.configPath = path
+		t.configBase = t.reloadSettings()
+		opt(t)
+		t.configApplied = t.reloadSettings()
+	}, nil
+}
+
+func readConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&cfg)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gormsanity: reading %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// Option returns an option applying the config, or an error if it's
+// invalid.
+func (c *Config) Option() (Option, error) {
+	var opts []Option
+
+	if c.Name != "" {
+		opts = append(opts, WithName(c.Name))
+	}
+	if c.Service != "" {
+		opts = append(opts, WithServiceName(c.Service))
+	}
+	if c.ServiceVersion != "" {
+		opts = append(opts, WithServiceVersion(c.ServiceVersion))
+	}
+	if len(c.Tags) > 0 {
+		opts = append(opts, WithTags(c.Tags))
+	}
+	if c.SampleRate != nil {
+		if *c.SampleRate < 0 || *c.SampleRate > 1 {
+			return nil, fmt.Errorf("sample_rate %v is not between 0 and 1", *c.SampleRate)
+		}
+		opts = append(opts, WithSampleRate(*c.SampleRate))
+	}
+	if c.MinDuration != "" {
+		d, err := time.ParseDuration(c.MinDuration)
+		if err != nil {
+			return nil, fmt.Errorf("min_duration: %v", err)
+		}
+		opts = append(opts, WithMinDuration(d))
+	}
+	if c.ErrorsOnly {
+		opts = append(opts, WithErrorsOnly())
+	}
+	if len(c.EventTypes) > 0 {
+		opts = append(opts, WithEventTypes(c.EventTypes...))
+	}
+	if len(c.Tables) > 0 {
+		opts = append(opts, WithTables(c.Tables...))
+	}
+	disabled, severities, err := c.ruleSettings()
+	if err != nil {
+		return nil, err
+	}
+	for name, off := range disabled {
+		if off {
+			opts = append(opts, WithoutRules(name))
+		} else {
+			opts = append(opts, WithRules(name))
+		}
+	}
+	for name, severity := range severities {
+		opts = append(opts, WithRuleSeverity(name, severity))
+	}
+	if len(c.Suppress) > 0 {
+		opts = append(opts, WithSuppressions(c.Suppress...))
+	}
+	for typ, v := range c.SlowThresholds {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("slow_thresholds: %s: %v", typ, err)
+		}
+		if typ == "all" {
+			opts = append(opts, WithSlowThreshold(d))
+		} else {
+			opts = append(opts, WithSlowThreshold(d, typ))
+		}
+	}
+	for table, v := range c.SlowTables {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("slow_tables: %s: %v", table, err)
+		}
+		opts = append(opts, WithSlowTableThreshold(table, d))
+	}
+	if c.ZeroRowWrites || len(c.ZeroRowAllow) > 0 {
+		opts = append(opts, WithZeroRowWriteDetection(c.ZeroRowAllow...))
+	}
+	if c.RedactVars {
+		opts = append(opts, WithRedactedVars())
+	}
+	if c.Verbosity != "" {
+		v, err := parseVerbosity(c.Verbosity)
+		if err != nil {
+			return nil, fmt.Errorf("verbosity: %v", err)
+		}
+		opts = append(opts, WithVerbosity(v))
+	}
+	if c.Async {
+		opts = append(opts, WithAsync())
+	}
+
+	for i, sc := range c.Sinks {
+		sink, err := sc.sink(c.Service)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %v", i, err)
+		}
+		opts = append(opts, WithSink(sink))
+	}
+
+	return func(t *Tracer) {
+		for _, opt := range opts {
+			opt(t)
+		}
+	}, nil
+}
+
+// ruleSettings returns the rules the config turns off, mapped to true, or
+// back on, mapped to false, and the severities it sets, by rule.
+func (c *Config) ruleSettings() (map[string]bool, map[string]Severity, error) {
+	disabled := map[string]bool{}
+	for _, name := range c.DisableRules {
+		disabled[name] = true
+	}
+	severities := map[string]Severity{}
+	for name, rc := range c.Rules {
+		if rc.Enabled != nil {
+			disabled[name] = !*rc.Enabled
+		}
+		if rc.Severity != "" {
+			s, err := parseSeverity(rc.Severity)
+			if err != nil {
+				return nil, nil, fmt.Errorf("rules: %s: severity: %v", name, err)
+			}
+			severities[name] = s
+		}
+	}
+	return disabled, severities, nil
+}
+
+func (c SinkConfig) formatter() (Formatter, error) {
+	switch strings.ToLower(c.Format) {
+	case "", "json":
+		return JSONFormatter{}, nil
+	case "csv":
+		return NewCSVFormatter()
+	case "msgpack":
+		return MsgpackFormatter{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", c.Format)
+}
+
+func (c SinkConfig) sink(service string) (Sink, error) {
+	formatter, err := c.formatter()
+	if err != nil {
+		return nil, err
+	}
+
+	switch strings.ToLower(c.Type) {
+	case "stdout", "stderr":
+		w := os.Stdout
+		if strings.EqualFold(c.Type, "stderr") {
+			w = os.Stderr
+		}
+		s := NewWriterSink(w)
+		s.Formatter = formatter
+		return s, nil
+	case "pretty":
+		return newPrettySink(), nil
+	case "file":
+		if c.Path == "" {
+			return nil, fmt.Errorf("file sink needs a path")
+		}
+		s := NewFileSink(c.Path)
+		s.Formatter = formatter
+		s.MaxSize = c.MaxSize
+		s.MaxFiles = c.MaxFiles
+		s.Compress = c.Compress
+		if c.MaxAge != "" {
+			if s.MaxAge, err = time.ParseDuration(c.MaxAge); err != nil {
+				return nil, fmt.Errorf("max_age: %v", err)
+			}
+		}
+		return s, nil
+	case "http":
+		if c.URL == "" {
+			return nil, fmt.Errorf("http sink needs a url")
+		}
+		s := NewHTTPSink(c.URL)
+		for k, v := range c.Headers {
+			s.Header.Set(k, v)
+		}
+		if c.Format != "" {
+			s.Formatter = formatter
+		}
+		return s, nil
+	case "otlp":
+		if c.URL == "" {
+			return nil, fmt.Errorf("otlp sink needs a url")
+		}
+		return NewOTLPSink(c.URL, service), nil
+	case "socket":
+		if c.Address == "" {
+			return nil, fmt.Errorf("socket sink needs an address")
+		}
+		network := c.Network
+		if network == "" {
+			network = "unix"
+		}
+		s := NewSocketSink(network, c.Address)
+		s.Formatter = formatter
+		return s, nil
+	case "syslog":
+		return NewSyslogSink(c.Network, c.Address, SyslogLocal0, c.Tag), nil
+	case "fluent":
+		network, address := c.Network, c.Address
+		if network == "" {
+			network = "tcp"
+		}
+		if address == "" {
+			address = "localhost:24224"
+		}
+		s := NewFluentSink(network, address)
+		if c.Tag != "" {
+			s.TagPrefix = c.Tag
+		}
+		return s, nil
+	case "parquet":
+		if c.Path == "" {
+			return nil, fmt.Errorf("parquet sink needs a path")
+		}
+		return NewParquetSink(c.Path), nil
+	}
+	return nil, fmt.Errorf("unknown sink type %q", c.Type)
+}
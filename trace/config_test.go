@@ -0,0 +1,127 @@
+package trace
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	yamlPath := writeConfig(t, dir, "gormsanity.yaml", `
+name: replica
+sample_rate: 0.5
+min_duration: 50ms
+event_types: [query]
+tables: [accounts]
+disable_rules: [no_where_clause, hard_delete]
+rules:
+  n_plus_one: {severity: error}
+  hard_delete: {enabled: true}
+  select_star: {enabled: false}
+suppress:
+  - {rule: n_plus_one, fingerprint: abc123}
+redact_vars: true
+tags:
+  env: prod
+slow_thresholds: {all: 1s, query: 100ms}
+slow_tables: {audit_log: 2s}
+zero_row_allow: [abc123]
+sinks:
+  - type: file
+    path: `+filepath.Join(dir, "gorm.log")+`
+    format: csv
+    max_size: 1024
+    max_files: 3
+    max_age: 24h
+  - type: http
+    url: http://localhost:9999/events
+    headers:
+      Authorization: Bearer token
+`)
+	jsonPath := writeConfig(t, dir, "gormsanity.json", `{
+		"name": "replica",
+		"sample_rate": 0.5,
+		"min_duration": "50ms",
+		"event_types": ["query"],
+		"tables": ["accounts"],
+		"disable_rules": ["no_where_clause", "hard_delete"],
+		"rules": {"n_plus_one": {"severity": "error"}, "hard_delete": {"enabled": true}, "select_star": {"enabled": false}},
+		"suppress": [{"rule": "n_plus_one", "fingerprint": "abc123"}],
+		"redact_vars": true,
+		"tags": {"env": "prod"},
+		"slow_thresholds": {"all": "1s", "query": "100ms"},
+		"slow_tables": {"audit_log": "2s"},
+		"zero_row_allow": ["abc123"],
+		"sinks": [
+			{"type": "file", "path": "`+filepath.Join(dir, "gorm.log")+`", "format": "csv", "max_size": 1024, "max_files": 3, "max_age": "24h"},
+			{"type": "http", "url": "http://localhost:9999/events", "headers": {"Authorization": "Bearer token"}}
+		]
+	}`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		opt, err := LoadConfig(path)
+		a.NoError(err, path)
+
+		tracer := New("primary", opt)
+		a.Equal("replica", tracer.Name())
+		a.Equal(0.5, tracer.sample)
+		a.Equal(50*time.Millisecond, tracer.minDuration)
+		a.Equal(map[string]bool{"query": true}, tracer.eventTypes)
+		a.Equal(map[string]bool{"accounts": true}, tracer.tables)
+		a.Equal(map[string]bool{"no_where_clause": true, "select_star": true}, tracer.disabledRules)
+		a.Equal(map[string]Severity{"n_plus_one": SeverityError}, tracer.severities)
+		a.Equal([]Suppression{{Rule: "n_plus_one", Fingerprint: "abc123"}}, tracer.suppressions)
+		a.True(tracer.redactVars)
+		a.Equal(map[string]string{"env": "prod"}, tracer.tags)
+		a.Equal(map[string]time.Duration{"": time.Second, "query": 100 * time.Millisecond}, tracer.slow.types)
+		a.Equal(map[string]time.Duration{"audit_log": 2 * time.Second}, tracer.slow.tables)
+		a.Equal(map[string]bool{"abc123": true}, tracer.zeroRows.allowed)
+
+		sinks := tracer.sink.(*MultiSink).sinks
+		a.Len(sinks, 2)
+		file := sinks[0].(*FileSink)
+		a.IsType(&CSVFormatter{}, file.Formatter)
+		a.Equal(int64(1024), file.MaxSize)
+		a.Equal(3, file.MaxFiles)
+		a.Equal(24*time.Hour, file.MaxAge)
+		a.Equal("Bearer token", sinks[1].(*HTTPSink).Header.Get("Authorization"))
+	}
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for content, msg := range map[string]string{
+		"sample_rate: 3":                  "sample_rate",
+		"min_duration: soon":              "min_duration",
+		"sinks: [{type: carrier_pigeon}]": "unknown sink type",
+		"sinks: [{type: file}]":           "needs a path",
+		"sampel_rate: 0.1":                "sampel_rate",
+		"rules: {tx_done: {severity: 5}}": "severity",
+	} {
+		_, err := LoadConfig(writeConfig(t, dir, "gormsanity.yml", content))
+		a.Error(err, content)
+		a.Contains(err.Error(), msg)
+	}
+
+	_, err = LoadConfig(filepath.Join(dir, "missing.yaml"))
+	a.True(os.IsNotExist(err))
+}
@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const contextScopeKey = trackScopeKey + ":context"
+
+type contextKey string
+
+// Context keys the tracer reads correlation IDs from, set with
+// context.WithValue. The values may be strings or fmt.Stringers.
+const (
+	RequestIDKey contextKey = "gormsanity.request_id"
+	TraceIDKey   contextKey = "gormsanity.trace_id"
+	UserIDKey    contextKey = "gormsanity.user_id"
+)
+
+// ContextExtractor copies values from the context bound to an operation
+// onto its event.
+type ContextExtractor func(ctx context.Context, event *GormEvent)
+
+// WithContext returns a handle of db whose operations are recorded with the
+// request, trace and user IDs found in ctx, so they can be correlated with
+// whatever caused them, and the time left before its deadline:
+//
+//	db := trace.WithContext(db, r.Context())
+func WithContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	return db.Set(contextScopeKey, ctx)
+}
+
+// extractContextIDs reads the IDs stored under RequestIDKey, TraceIDKey and
+// UserIDKey, and the attempt stored under AttemptContextKey.
+func extractContextIDs(ctx context.Context, event *GormEvent) {
+	event.RequestID = contextString(ctx, RequestIDKey)
+	event.TraceID = contextString(ctx, TraceIDKey)
+	event.UserID = contextString(ctx, UserIDKey)
+	if n, ok := ctx.Value(AttemptContextKey).(int); ok {
+		event.Attempt = n
+	}
+}
+
+func contextString(ctx context.Context, key interface{}) string {
+	switch v := ctx.Value(key).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// applyContext runs the extractors on the context bound to scope, if any.
+func (t *Tracer) applyContext(event *GormEvent, scope *gorm.Scope) {
+	v, ok := scope.Get(contextScopeKey)
+	if !ok {
+		return
+	}
+	ctx, ok := v.(context.Context)
+	if !ok || ctx == nil {
+		return
+	}
+
+	extractContextIDs(ctx, event)
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := time.Until(deadline)
+		event.TimeToDeadline = &remaining
+	}
+	for _, extract := range t.extractors {
+		extract(ctx, event)
+	}
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+type tenantKey struct{}
+
+func TestWithContext(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithContextExtractor(func(ctx context.Context, e *GormEvent) {
+		e.Warnings = append(e.Warnings, "tenant:"+ctx.Value(tenantKey{}).(string))
+	}))
+
+	ctx := context.WithValue(context.Background(), RequestIDKey, "req-1")
+	ctx = context.WithValue(ctx, TraceIDKey, "4bf92f3577b34da6a3ce929d0e0e4736")
+	ctx = context.WithValue(ctx, UserIDKey, 42)
+	ctx = context.WithValue(ctx, tenantKey{}, "acme")
+
+	a.NoError(WithContext(db, ctx).Create(&models.Account{EmailAddress: "ctx@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Operations()
+	a.Len(events, 2)
+	a.Equal("req-1", events[0].RequestID)
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", events[0].TraceID)
+	a.Equal("42", events[0].UserID)
+	a.Contains(events[0].Warnings, "tenant:acme")
+
+	a.Empty(events[1].RequestID, "the context is bound to the returned handle only")
+
+	span := otlpSpanFromEvent(events[0])
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", span.TraceID)
+}
+
+func TestWithContext_Deadline(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	a.NoError(WithContext(db, ctx).Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(WithContext(db, context.Background()).Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.NotNil(events[0].TimeToDeadline)
+	a.True(*events[0].TimeToDeadline > 50*time.Second && *events[0].TimeToDeadline <= time.Minute)
+	a.Nil(events[1].TimeToDeadline)
+}
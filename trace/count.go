@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// tableSizeTTL is how long the estimated size of a table is remembered.
+const tableSizeTTL = 10 * time.Minute
+
+var countStar = regexp.MustCompile(`(?i)^\s*SELECT\s+count\(\s*(?:\*|1|"?\w+"?)\s*\)\s+FROM\s+"?\w+"?\s*(?:$|WHERE\b)`)
+
+// fullCountDetector flags counts of every row of tables with at least
+// minRows rows, which read the whole table, see WithFullCountDetection.
+type fullCountDetector struct {
+	minRows int64
+
+	mu      sync.Mutex
+	db      *sql.DB
+	sizes   map[string]tableSize
+	lookups map[string]bool
+	wg      sync.WaitGroup
+}
+
+type tableSize struct {
+	rows int64
+	ok   bool
+	at   time.Time
+}
+
+func newFullCountDetector(minRows int64) *fullCountDetector {
+	return &fullCountDetector{minRows: minRows, sizes: map[string]tableSize{}, lookups: map[string]bool{}}
+}
+
+func (d *fullCountDetector) rule() string { return "full_count" }
+
+// use sets the database table sizes are looked up in, unless it's set
+// already.
+func (d *fullCountDetector) use(db *sql.DB) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.db == nil {
+		d.db = db
+	}
+}
+
+func (d *fullCountDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "row_query" || !countStar.MatchString(e.Query) || hasWhere(e.Query) {
+		return nil
+	}
+	msg := fmt.Sprintf("counting every row of %s", e.TableName)
+	if d.minRows > 0 {
+		rows, ok := d.size(e.Dialect, e.TableName, e.StartTime)
+		if !ok || rows < d.minRows {
+			return nil
+		}
+		msg += fmt.Sprintf(", ~%d of them,", rows)
+	}
+	msg += " reads the whole table; an estimate such as Postgres' pg_class.reltuples or MySQL's information_schema.tables.table_rows is far cheaper where an approximate count will do"
+
+	e.Warnings = append(e.Warnings, d.rule())
+	return singleViolation(d.rule(), e, msg)
+}
+
+// size returns the estimated number of rows of table. When it isn't known
+// or is older than tableSizeTTL, it's looked up in the background for
+// later counts: the count's own connection is still busy with its result,
+// and the pool may have no other.
+func (d *fullCountDetector) size(dialect, table string, now time.Time) (int64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s, known := d.sizes[table]
+	if (!known || now.Sub(s.at) >= tableSizeTTL) && d.db != nil && !d.lookups[table] {
+		d.lookups[table] = true
+		d.wg.Add(1)
+		go d.lookup(d.db, dialect, table, now)
+	}
+	return s.rows, s.ok
+}
+
+func (d *fullCountDetector) lookup(db *sql.DB, dialect, table string, now time.Time) {
+	defer d.wg.Done()
+	rows, err := estimatedRows(db, dialect, table)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sizes[table] = tableSize{rows: rows, ok: err == nil, at: now}
+	delete(d.lookups, table)
+}
+
+// wait waits for the lookups in flight.
+func (d *fullCountDetector) wait() {
+	d.wg.Wait()
+}
+
+// estimatedRows returns the planner's estimate of the number of rows of
+// table, which unlike counting them is cheap.
+func estimatedRows(db *sql.DB, dialect, table string) (int64, error) {
+	var query string
+	switch dialect {
+	case "postgres":
+		query = "SELECT reltuples::bigint FROM pg_class WHERE relname = $1"
+	case "mysql":
+		query = "SELECT table_rows FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?"
+	default:
+		return 0, fmt.Errorf("gormsanity: can't estimate the size of tables of %s", dialect)
+	}
+	var rows int64
+	err := db.QueryRow(query, table).Scan(&rows)
+	return rows, err
+}
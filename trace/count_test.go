@@ -0,0 +1,65 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_FullCount(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	var lookups int
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.Contains(query, "pg_class") {
+			lookups++
+			sizes := map[string]int64{"accounts": 250000, "test_notes": 10}
+			return []string{"reltuples"}, [][]driver.Value{{sizes[args[0].(string)]}}
+		}
+		return []string{"count"}, [][]driver.Value{{int64(5)}}
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithFullCountDetection(1000))
+	var n int
+	a.NoError(db.Model(&models.Account{}).Count(&n).Error, "the size isn't known yet")
+	a.NoError(db.Model(&testNote{}).Count(&n).Error)
+	tracer.fullCount.wait()
+	a.NoError(db.Model(&models.Account{}).Count(&n).Error)
+	a.NoError(db.Model(&models.Account{}).Count(&n).Error)
+	a.NoError(db.Model(&models.Account{}).Where("status = ?", models.Status_Active).Count(&n).Error)
+	a.NoError(db.Model(&testNote{}).Count(&n).Error, "small")
+	tracer.Close()
+	a.Equal(2, lookups, "sizes are remembered")
+
+	var violations []*Violation
+	var flagged int
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+		} else if hasWarning(e, "full_count") {
+			flagged++
+		}
+	}
+	a.Equal(2, flagged)
+	a.Len(violations, 2)
+	a.Equal("full_count", violations[0].Rule)
+	a.True(strings.HasPrefix(violations[0].Message, "counting every row of accounts, ~250000 of them, reads the whole table;"), violations[0].Message)
+}
+
+func TestFullCountDetector_AnySize(t *testing.T) {
+	a := require.New(t)
+	d := newFullCountDetector(0)
+	count := func(query string) []*Violation {
+		return d.observe(&GormEvent{EventType: "row_query", Dialect: "sqlite3", TableName: "accounts", Query: query})
+	}
+	a.Len(count(`SELECT count(*) FROM "accounts"`), 1)
+	a.Len(count(`SELECT count(*) FROM "accounts"  WHERE "accounts"."deleted_at" IS NULL`), 1)
+	a.Empty(count(`SELECT count(*) FROM "accounts"  WHERE (status = ?)`))
+	a.Empty(count(`SELECT count(*) FROM accounts JOIN orders ON orders.account_id = accounts.id`))
+	a.Empty(count(`SELECT id FROM "accounts"`))
+}
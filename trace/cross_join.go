@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	joinKeyword   = regexp.MustCompile(`(?i)\b(?:(CROSS|NATURAL)\s+)?JOIN\b`)
+	joinCondition = regexp.MustCompile(`(?i)\b(?:ON|USING)\b`)
+	joinEnd       = regexp.MustCompile(`(?i)\b(?:JOIN|WHERE|GROUP\s+BY|ORDER\s+BY|HAVING|LIMIT|UNION)\b`)
+	fromList      = regexp.MustCompile(`(?i)\bFROM\s+([^()]*?)\s*(?:\b(?:WHERE|JOIN|INNER|LEFT|RIGHT|FULL|GROUP|ORDER|LIMIT)\b|$)`)
+)
+
+// crossJoinDetector flags queries that probably join tables by accident
+// into their cartesian product: those joining a table without a condition,
+// and those returning fanOut or more times as many rows as distinct
+// records of their model, see WithCrossJoinDetection.
+type crossJoinDetector struct {
+	fanOut int
+}
+
+func (d crossJoinDetector) rule() string { return "cross_join" }
+
+func (d crossJoinDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" && e.EventType != "row_query" {
+		return nil
+	}
+	query := fingerprintStrings.ReplaceAllString(e.Query, "?")
+
+	var msg string
+	switch {
+	case missingJoinCondition(query):
+		msg = fmt.Sprintf("query on %s joins a table without a condition", e.TableName)
+	case d.fanOut > 0 && e.distinctRows > 0 && isJoin(query) && e.RowsReturned >= int64(d.fanOut*e.distinctRows):
+		msg = fmt.Sprintf("query on %s returned %d rows for %d distinct records", e.TableName, e.RowsReturned, e.distinctRows)
+	default:
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	return singleViolation(d.rule(), e, msg)
+}
+
+// missingJoinCondition reports whether query joins a table with neither ON
+// nor USING, or lists tables in FROM without a WHERE clause to relate
+// them. CROSS and NATURAL joins say what they mean and aren't reported.
+func missingJoinCondition(query string) bool {
+	for _, loc := range joinKeyword.FindAllStringSubmatchIndex(query, -1) {
+		if loc[2] >= 0 {
+			continue
+		}
+		rest := query[loc[1]:]
+		if end := joinEnd.FindStringIndex(rest); end != nil {
+			rest = rest[:end[0]]
+		}
+		if !joinCondition.MatchString(rest) {
+			return true
+		}
+	}
+	if m := fromList.FindStringSubmatch(query); m != nil && strings.Contains(m[1], ",") {
+		return !hasWhere(query)
+	}
+	return false
+}
+
+// isJoin reports whether query reads from more than one table.
+func isJoin(query string) bool {
+	if joinKeyword.MatchString(query) {
+		return true
+	}
+	m := fromList.FindStringSubmatch(query)
+	return m != nil && strings.Contains(m[1], ",")
+}
+
+// distinctRows counts the distinct primary keys of the records a query
+// scanned into a slice, or returns 0 when they can't be told apart.
+func distinctRows(scope *gorm.Scope) int {
+	if scope.Value == nil {
+		return 0
+	}
+	v := scope.IndirectValue()
+	if v.Kind() != reflect.Slice {
+		return 0
+	}
+	pk := scope.PrimaryField()
+	if pk == nil {
+		return 0
+	}
+	seen := map[interface{}]bool{}
+	for i := 0; i < v.Len(); i++ {
+		row := elem(v.Index(i))
+		if row.Kind() != reflect.Struct {
+			return 0
+		}
+		key := fieldByIndex(row, pk.Struct.Index)
+		if !key.IsValid() || !key.Type().Comparable() {
+			return 0
+		}
+		seen[key.Interface()] = true
+	}
+	return len(seen)
+}
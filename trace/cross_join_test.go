@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_CrossJoin(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		// Each account once per order.
+		var rows [][]driver.Value
+		for id := 1; id <= 2; id++ {
+			for order := 0; order < 5; order++ {
+				rows = append(rows, []driver.Value{int64(id)})
+			}
+		}
+		return []string{"id"}, rows
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithCrossJoinDetection(4), WithoutRules("no_where_clause", "zero_insert_value"))
+	a.NoError(db.Joins("JOIN orders").Find(&[]models.Account{}).Error)
+	a.NoError(db.Joins("JOIN orders ON orders.account_id = accounts.id").Find(&[]models.Account{}).Error)
+	a.NoError(db.Find(&[]models.Account{}).Error, "not a join")
+	tracer.Close()
+
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+		}
+	}
+	a.Len(violations, 2)
+	a.Regexp(`^query on accounts joins a table without a condition at .*cross_join_test.go:\d+$`, violations[0].Message)
+	a.Regexp(`^query on accounts returned 10 rows for 2 distinct records at .*cross_join_test.go:\d+$`, violations[1].Message)
+}
+
+func TestMissingJoinCondition(t *testing.T) {
+	a := require.New(t)
+	a.False(missingJoinCondition(`SELECT * FROM "accounts"`))
+	a.True(missingJoinCondition(`SELECT * FROM accounts JOIN orders WHERE accounts.id = ?`))
+	a.False(missingJoinCondition(`SELECT * FROM accounts LEFT JOIN orders ON orders.account_id = accounts.id INNER JOIN lines USING (order_id)`))
+	a.True(missingJoinCondition(`SELECT * FROM accounts JOIN orders ON orders.account_id = accounts.id JOIN lines`))
+	a.False(missingJoinCondition(`SELECT * FROM accounts CROSS JOIN regions`), "deliberate")
+	a.True(missingJoinCondition(`SELECT * FROM accounts, orders`))
+	a.True(missingJoinCondition(`SELECT * FROM accounts, orders WHERE "deleted_at" IS NULL`))
+	a.False(missingJoinCondition(`SELECT * FROM accounts, orders WHERE orders.account_id = accounts.id`))
+	a.False(missingJoinCondition(`SELECT id, email FROM accounts WHERE nick_name = 'a, b'`))
+}
@@ -0,0 +1,141 @@
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRuleWindow is how far back the events given to custom rules
+	// in RuleContext.Window go, see WithRule.
+	DefaultRuleWindow = time.Minute
+	// maxRuleWindowEvents bounds the events kept for each window.
+	maxRuleWindowEvents = 100
+)
+
+// Rule is a sanity check of the application's own, added with WithRule,
+// such as one forbidding writes to legacy tables:
+//
+//	trace.NewRule("legacy_write", func(e *trace.GormEvent, _ trace.RuleContext) []*trace.Violation {
+//		if e.EventType != "query" && strings.HasPrefix(e.TableName, "legacy_") {
+//			return []*trace.Violation{{Message: "write to " + e.TableName}}
+//		}
+//		return nil
+//	})
+//
+// Its violations are written like those of the built in rules, filling in
+// their Rule, Severity, Count and Events when left empty, and the events
+// breaking it get its ID as a warning. It can be turned off and ranked with
+// WithoutRules and WithRuleSeverity.
+type Rule interface {
+	// ID names the rule, in the style of "n_plus_one".
+	ID() string
+	// Check is called with the event of each completed operation before
+	// it's written. It's called from the goroutines running the
+	// operations, so must be safe for concurrent use, and must not modify
+	// the events of ctx.
+	Check(e *GormEvent, ctx RuleContext) []*Violation
+}
+
+// RuleContext is what a Rule is given besides the event it checks.
+type RuleContext struct {
+	// Window is the events of the operations completed before, oldest
+	// first, within DefaultRuleWindow and in the same transaction, or else
+	// the same request, or else outside any, at most 100 of them.
+	Window []*GormEvent
+}
+
+// NewRule returns a Rule with the given ID checking events with check.
+func NewRule(id string, check func(e *GormEvent, ctx RuleContext) []*Violation) Rule {
+	return ruleFunc{id, check}
+}
+
+type ruleFunc struct {
+	id    string
+	check func(*GormEvent, RuleContext) []*Violation
+}
+
+func (r ruleFunc) ID() string { return r.id }
+
+func (r ruleFunc) Check(e *GormEvent, ctx RuleContext) []*Violation {
+	return r.check(e, ctx)
+}
+
+// customRule runs a Rule as a detector.
+type customRule struct {
+	Rule
+	windows *ruleWindows
+}
+
+func (r customRule) rule() string { return r.ID() }
+
+func (r customRule) observe(e *GormEvent) []*Violation {
+	violations := r.Check(e, RuleContext{Window: r.windows.events(e)})
+	if len(violations) == 0 {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, r.ID())
+	for _, v := range violations {
+		if v.Rule == "" {
+			v.Rule = r.ID()
+		}
+		if v.Count == 0 && len(v.Events) == 0 {
+			v.Count = 1
+			v.Events = []string{e.ID}
+		}
+	}
+	return violations
+}
+
+// ruleWindows keeps the recent events of each transaction and request
+// for custom rules.
+type ruleWindows struct {
+	mu        sync.Mutex
+	windows   map[string][]*GormEvent
+	lastPrune time.Time
+}
+
+func newRuleWindows() *ruleWindows {
+	return &ruleWindows{windows: map[string][]*GormEvent{}}
+}
+
+// events returns the window of e, the events added before it.
+func (w *ruleWindows) events(e *GormEvent) []*GormEvent {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	events := w.windows[windowScope(e)]
+	for len(events) > 0 && e.StartTime.Sub(events[0].EndTime) > DefaultRuleWindow {
+		events = events[1:]
+	}
+	return append([]*GormEvent(nil), events...)
+}
+
+// add adds a copy of e, as written events may be changed, to its window
+// once every rule has checked it.
+func (w *ruleWindows) add(e *GormEvent) {
+	c := *e
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.prune(e.EndTime)
+
+	scope := windowScope(e)
+	events := append(w.windows[scope], &c)
+	if len(events) > maxRuleWindowEvents {
+		events = events[len(events)-maxRuleWindowEvents:]
+	}
+	w.windows[scope] = events
+}
+
+// prune forgets the windows of transactions and requests that have gone
+// quiet.
+func (w *ruleWindows) prune(now time.Time) {
+	if now.Sub(w.lastPrune) < DefaultRuleWindow {
+		return
+	}
+	w.lastPrune = now
+	for scope, events := range w.windows {
+		if now.Sub(events[len(events)-1].EndTime) > DefaultRuleWindow {
+			delete(w.windows, scope)
+		}
+	}
+}
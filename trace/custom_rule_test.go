@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_WithRule(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	legacy := NewRule("legacy_write", func(e *GormEvent, _ RuleContext) []*Violation {
+		if e.EventType != "query" && strings.HasPrefix(e.TableName, "test_") {
+			return []*Violation{{Message: "write to " + e.TableName}}
+		}
+		return nil
+	})
+	var windows [][]string
+	rereads := NewRule("reread", func(e *GormEvent, ctx RuleContext) []*Violation {
+		var types []string
+		for _, w := range ctx.Window {
+			types = append(types, w.EventType)
+		}
+		windows = append(windows, types)
+		return nil
+	})
+
+	db, tracer := TraceDB(db, WithSink(sink), WithRule(legacy), WithRule(rereads), WithRuleSeverity("legacy_write", SeverityError), WithoutRules("no_where_clause", "zero_insert_value"))
+	tx := Begin(db)
+	a.NoError(tx.Create(&testNote{ID: 1}).Error)
+	a.NoError(tx.Find(&[]testNote{}).Error)
+	a.NoError(Commit(tx).Error)
+	a.NoError(db.Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 4)
+	a.True(hasWarning(events[0], "legacy_write"))
+	a.Equal(&Violation{Rule: "legacy_write", Severity: SeverityError, Message: "write to test_notes", Count: 1, Events: []string{events[0].ID}}, events[1].Violation)
+	a.False(hasWarning(events[2], "legacy_write"))
+	a.Equal([][]string{nil, {"create"}, nil}, windows, "windows are per transaction")
+
+	var ids []string
+	for _, r := range tracer.Rules() {
+		if r.ID == "legacy_write" || r.ID == "reread" {
+			ids = append(ids, r.ID)
+		}
+	}
+	a.Equal([]string{"legacy_write", "reread"}, ids)
+}
@@ -0,0 +1,133 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// SchemaVersion is the version of GormEvent written by this package. It's
+// bumped whenever a field changes meaning or shape, with a migration added
+// so older trace files can still be decoded.
+const SchemaVersion = 2
+
+// eventMigrations[v] upgrades a decoded event from version v to v+1.
+var eventMigrations = []func(map[string]interface{}){
+	migrateEventV0,
+	migrateEventV1,
+}
+
+// migrateEventV0 upgrades events written before the schema was versioned,
+// which have the same shape as version 1.
+func migrateEventV0(m map[string]interface{}) {}
+
+// migrateEventV1 upgrades events whose errors were written as empty JSON
+// objects, or as messages by MsgpackFormatter, to EventErrors.
+func migrateEventV1(m map[string]interface{}) {
+	list, _ := m["errors"].([]interface{})
+	for i, e := range list {
+		switch e := e.(type) {
+		case string:
+			list[i] = map[string]interface{}{"message": e, "type": ""}
+		case map[string]interface{}:
+			if _, ok := e["message"]; !ok {
+				list[i] = map[string]interface{}{"message": "unknown error", "type": ""}
+			}
+		}
+	}
+	m["has_error"] = len(list) > 0
+}
+
+// DecodeEvent decodes a single JSON encoded event of any schema version.
+// Numbers among the values of an event, such as SQLVars and PrimaryKeys,
+// are decoded as json.Number, keeping the exact digits of large integers.
+func DecodeEvent(data []byte) (*GormEvent, error) {
+	var m map[string]interface{}
+	if err := unmarshalNumbers(data, &m); err != nil {
+		return nil, err
+	}
+	return decodeEventMap(m)
+}
+
+// unmarshalNumbers is json.Unmarshal decoding numbers into interface
+// values as json.Number rather than float64, which can't hold every int64.
+func unmarshalNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func decodeEventMap(m map[string]interface{}) (*GormEvent, error) {
+	version := 0
+	if v, ok := m["schema_version"]; ok {
+		// JSON decodes numbers as json.Number, MessagePack as int64 or
+		// uint64.
+		switch n := v.(type) {
+		case json.Number:
+			i, err := n.Int64()
+			if err != nil {
+				return nil, fmt.Errorf("gormsanity: invalid schema_version %v", v)
+			}
+			version = int(i)
+		case int64:
+			version = int(n)
+		case uint64:
+			version = int(n)
+		default:
+			return nil, fmt.Errorf("gormsanity: invalid schema_version %v", v)
+		}
+	}
+	if version > SchemaVersion {
+		return nil, fmt.Errorf("gormsanity: event schema version %d is newer than supported version %d", version, SchemaVersion)
+	}
+
+	for v := version; v < SchemaVersion; v++ {
+		eventMigrations[v](m)
+	}
+	m["schema_version"] = SchemaVersion
+
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	event := &GormEvent{}
+	if err := unmarshalNumbers(bs, event); err != nil {
+		return nil, err
+	}
+
+	// Events written before durations were recorded.
+	if _, ok := m["duration_ns"]; !ok && !event.EndTime.IsZero() {
+		event.end(event.EndTime)
+	}
+	return event, nil
+}
+
+// Decoder reads newline delimited JSON events of any schema version.
+type Decoder struct {
+	sc *bufio.Scanner
+}
+
+// NewDecoder creates a decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	return &Decoder{sc: sc}
+}
+
+// Decode reads the next event, returning io.EOF when the stream is
+// exhausted. Blank lines are skipped.
+func (d *Decoder) Decode() (*GormEvent, error) {
+	for d.sc.Scan() {
+		line := d.sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		return DecodeEvent(line)
+	}
+	if err := d.sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
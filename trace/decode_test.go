@@ -0,0 +1,74 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder_Versions(t *testing.T) {
+	a := require.New(t)
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"event_type":"query","errors":[{}],"rows_affected":2}` + "\n\n")
+
+	sink := NewWriterSink(&buf)
+	a.NoError(sink.Write(&GormEvent{SchemaVersion: SchemaVersion, EventType: "update", Errors: []error{errors.New("boom")}}))
+
+	dec := NewDecoder(&buf)
+
+	v0, err := dec.Decode()
+	a.NoError(err)
+	a.Equal(SchemaVersion, v0.SchemaVersion)
+	a.Equal("query", v0.EventType)
+	a.Equal(int64(2), v0.RowsAffected)
+	a.Len(v0.Errors, 1)
+
+	v1, err := dec.Decode()
+	a.NoError(err)
+	a.Equal("update", v1.EventType)
+	a.Len(v1.Errors, 1)
+
+	_, err = dec.Decode()
+	a.Equal(io.EOF, err)
+}
+
+func TestDecodeEvent_LargeIntegers(t *testing.T) {
+	a := require.New(t)
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	a.NoError(sink.Write(&GormEvent{
+		SchemaVersion: SchemaVersion,
+		PrimaryKeys:   map[string]interface{}{"id": int64(1234567890123456789)},
+		SQLVars:       []interface{}{int64(1234567890123456789), uint64(18446744073709551615)},
+	}))
+
+	event, err := NewDecoder(&buf).Decode()
+	a.NoError(err)
+	a.Equal(json.Number("1234567890123456789"), event.PrimaryKeys["id"])
+	a.Equal([]interface{}{json.Number("1234567890123456789"), json.Number("18446744073709551615")}, event.SQLVars)
+}
+
+func TestDecodeEvent_FutureVersion(t *testing.T) {
+	_, err := NewDecoder(strings.NewReader(`{"schema_version":999}`)).Decode()
+	require.Error(t, err)
+}
+
+func TestDecodeEvent_Duration(t *testing.T) {
+	a := require.New(t)
+
+	event, err := DecodeEvent([]byte(`{"schema_version":1,"start_time":"2020-01-01T00:00:00Z","end_time":"2020-01-01T00:00:00.25Z"}`))
+	a.NoError(err)
+	a.Equal(250*time.Millisecond, event.Duration, "computed for events written without one")
+
+	event, err = DecodeEvent([]byte(`{"schema_version":1,"start_time":"2020-01-01T00:00:00Z","end_time":"2020-01-01T00:00:00.25Z","duration_ns":1000}`))
+	a.NoError(err)
+	a.Equal(time.Microsecond, event.Duration)
+}
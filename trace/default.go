@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// The default tracer backs the package level functions, for applications
+// that only need one tracer.
+var (
+	defaultMu     sync.Mutex
+	defaultTracer *Tracer
+)
+
+// Enable traces db with the default tracer and returns it. The tracer is
+// created with opts by the first call; later calls share it and ignore
+// their options until Disable.
+func Enable(db *gorm.DB, opts ...Option) *gorm.DB {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultTracer == nil {
+		defaultTracer = New("", opts...)
+	}
+	return defaultTracer.Trace(db)
+}
+
+// Disable untraces every database passed to Enable and closes the default
+// tracer.
+func Disable() {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultTracer == nil {
+		return
+	}
+	defaultTracer.Close()
+	defaultTracer = nil
+}
+
+// Default returns the default tracer, or nil if Enable hasn't been called.
+func Default() *Tracer {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	return defaultTracer
+}
+
+// Flush flushes the default tracer's sink.
+func Flush() error {
+	if t := Default(); t != nil {
+		return t.Flush()
+	}
+	return nil
+}
+
+// Stats reports the default tracer's counters, see Tracer.Stats.
+func Stats() TracerStats {
+	if t := Default(); t != nil {
+		return t.Stats()
+	}
+	return TracerStats{}
+}
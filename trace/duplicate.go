@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDuplicateQueryWindow is how long a transaction or request may go
+// without queries before the queries it ran are forgotten, see
+// WithDuplicateQueryDetection.
+const DefaultDuplicateQueryWindow = time.Minute
+
+// duplicateDetector flags the same query run again with the same values
+// within one transaction or request, a sign of a missing cache or of
+// loading the same thing twice. Queries belonging to neither are left
+// alone, as they may come from unrelated callers.
+type duplicateDetector struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	queries   map[duplicateKey]*duplicateCount
+	lastPrune time.Time
+}
+
+type duplicateKey struct {
+	scope, query, args string
+}
+
+type duplicateCount struct {
+	last   time.Time
+	events []string
+}
+
+func newDuplicateDetector(window time.Duration) *duplicateDetector {
+	return &duplicateDetector{window: window, queries: map[duplicateKey]*duplicateCount{}}
+}
+
+func (d *duplicateDetector) rule() string { return "duplicate_query" }
+
+func (d *duplicateDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" && e.EventType != "row_query" || e.Query == "" {
+		return nil
+	}
+	scope := windowScope(e)
+	if scope == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(e.StartTime)
+
+	key := duplicateKey{scope, e.Query, e.argsHash}
+	c := d.queries[key]
+	if c == nil || e.StartTime.Sub(c.last) > d.window {
+		c = &duplicateCount{}
+		d.queries[key] = c
+	}
+	c.last = e.StartTime
+	c.events = append(c.events, e.ID)
+	if len(c.events) < 2 {
+		return nil
+	}
+
+	e.Warnings = append(e.Warnings, d.rule())
+	if len(c.events) > 2 {
+		return nil
+	}
+	return []*Violation{{
+		Rule:    d.rule(),
+		Message: fmt.Sprintf("the same query ran again with the same values in %s", scope),
+		Count:   len(c.events),
+		Events:  append([]string(nil), c.events...),
+	}}
+}
+
+// prune forgets queries of transactions and requests that have gone quiet.
+func (d *duplicateDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.window {
+		return
+	}
+	d.lastPrune = now
+	for key, c := range d.queries {
+		if now.Sub(c.last) > d.window {
+			delete(d.queries, key)
+		}
+	}
+}
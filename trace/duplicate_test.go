@@ -0,0 +1,92 @@
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_DuplicateQuery(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	req := WithContext(db, context.WithValue(context.Background(), RequestIDKey, "req-1"))
+	for i := 0; i < 3; i++ {
+		a.NoError(req.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	}
+	a.NoError(req.Where("id = ?", 2).Find(&[]models.Account{}).Error)
+	// Outside a request or transaction repeats aren't flagged.
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "duplicate_query"))
+	}
+	a.Equal([]bool{false, true, true, false, false, false}, flagged)
+	a.Len(violations, 1)
+	a.Equal("duplicate_query", violations[0].Rule)
+	a.Equal(2, violations[0].Count)
+}
+
+func TestTracer_DuplicateQuery_Transaction(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	tx := db.Begin()
+	a.NoError(tx.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(tx.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(tx.Commit().Error)
+	// The same query in another transaction isn't a repeat.
+	other := db.Begin()
+	a.NoError(other.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(other.Commit().Error)
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "duplicate_query"))
+	}
+	a.Equal([]bool{false, true, false}, flagged)
+	a.Len(violations, 1)
+	a.Equal("duplicate_query", violations[0].Rule)
+}
+
+func TestDuplicateDetector_Unscoped(t *testing.T) {
+	a := require.New(t)
+	d := newDuplicateDetector(DefaultDuplicateQueryWindow)
+
+	// The same query from unrelated goroutines or requests, belonging to
+	// no transaction or request, isn't a duplicate.
+	done := make(chan []*Violation)
+	for i := 0; i < 4; i++ {
+		go func() {
+			done <- d.observe(&GormEvent{EventType: "query", Query: "SELECT * FROM accounts WHERE id = $1", argsHash: "a"})
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		a.Empty(<-done)
+	}
+	a.Empty(d.queries)
+
+	a.Empty(d.observe(&GormEvent{EventType: "query", RequestID: "req-1", Query: "SELECT 1"}))
+	a.Len(d.observe(&GormEvent{EventType: "query", RequestID: "req-1", Query: "SELECT 1"}), 1)
+}
@@ -0,0 +1,29 @@
+package trace
+
+import "github.com/jinzhu/gorm"
+
+// Enricher attaches application specific fields, such as a tenant ID, to
+// events before they're written. Set them in GormEvent.Fields.
+type Enricher interface {
+	Enrich(event *GormEvent, scope *gorm.Scope)
+}
+
+// EnricherFunc adapts a function to an Enricher.
+type EnricherFunc func(event *GormEvent, scope *gorm.Scope)
+
+// Enrich calls f(event, scope).
+func (f EnricherFunc) Enrich(event *GormEvent, scope *gorm.Scope) {
+	f(event, scope)
+}
+
+func (t *Tracer) enrich(e *GormEvent, scope *gorm.Scope) {
+	if len(t.enrichers) == 0 {
+		return
+	}
+	if e.Fields == nil {
+		e.Fields = map[string]interface{}{}
+	}
+	for _, enricher := range t.enrichers {
+		enricher.Enrich(e, scope)
+	}
+}
@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables configuring TraceDB, so tracing can be tuned
+// without changing code. They're defaults: options passed to TraceDB take
+// precedence. See also SinkEnvVar.
+const (
+	// SampleRateEnvVar sets the sample rate, see WithSampleRate.
+	SampleRateEnvVar = "GORMSANITY_SAMPLE_RATE"
+	// MinDurationEnvVar sets the minimum duration as a Go duration such as
+	// "50ms", see WithMinDuration.
+	MinDurationEnvVar = "GORMSANITY_MIN_DURATION"
+	// ErrorsOnlyEnvVar records only failing operations when true, see
+	// WithErrorsOnly.
+	ErrorsOnlyEnvVar = "GORMSANITY_ERRORS_ONLY"
+	// EventTypesEnvVar is a comma separated list of event types, see
+	// WithEventTypes.
+	EventTypesEnvVar = "GORMSANITY_EVENT_TYPES"
+	// TablesEnvVar is a comma separated list of tables, see WithTables.
+	TablesEnvVar = "GORMSANITY_TABLES"
+	// AsyncEnvVar enables asynchronous writes when true, see WithAsync.
+	AsyncEnvVar = "GORMSANITY_ASYNC"
+	// FileDirEnvVar sets the directory of the default trace file, see
+	// WithFileDir.
+	FileDirEnvVar = "GORMSANITY_FILE_DIR"
+	// FileTemplateEnvVar names the default trace file, see
+	// WithFileTemplate.
+	FileTemplateEnvVar = "GORMSANITY_FILE_TEMPLATE"
+	// VerbosityEnvVar is "full" or "summary", see WithVerbosity.
+	VerbosityEnvVar = "GORMSANITY_VERBOSITY"
+	// ServiceNameEnvVar names the service, see WithServiceName.
+	ServiceNameEnvVar = "GORMSANITY_SERVICE"
+	// ServiceVersionEnvVar sets the service's version, see
+	// WithServiceVersion.
+	ServiceVersionEnvVar = "GORMSANITY_SERVICE_VERSION"
+	// TagsEnvVar is a comma separated list of key=value tags, see WithTags.
+	TagsEnvVar = "GORMSANITY_TAGS"
+)
+
+// envOptions builds options from the environment. Invalid values are
+// skipped and reported.
+func envOptions(getenv func(string) string) ([]Option, []error) {
+	var opts []Option
+	var errs []error
+
+	if v := getenv(SampleRateEnvVar); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate < 0 || rate > 1 {
+			errs = append(errs, fmt.Errorf("gormsanity: invalid %s %q, expected a number between 0 and 1", SampleRateEnvVar, v))
+		} else {
+			opts = append(opts, WithSampleRate(rate))
+		}
+	}
+
+	if v := getenv(MinDurationEnvVar); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gormsanity: invalid %s %q: %v", MinDurationEnvVar, v, err))
+		} else {
+			opts = append(opts, WithMinDuration(d))
+		}
+	}
+
+	if v := getenv(ErrorsOnlyEnvVar); v != "" {
+		errorsOnly, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gormsanity: invalid %s %q, expected true or false", ErrorsOnlyEnvVar, v))
+		} else if errorsOnly {
+			opts = append(opts, WithErrorsOnly())
+		}
+	}
+
+	if v := getenv(EventTypesEnvVar); v != "" {
+		opts = append(opts, WithEventTypes(splitList(v)...))
+	}
+
+	if v := getenv(TablesEnvVar); v != "" {
+		opts = append(opts, WithTables(splitList(v)...))
+	}
+
+	if v := getenv(AsyncEnvVar); v != "" {
+		async, err := strconv.ParseBool(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gormsanity: invalid %s %q, expected true or false", AsyncEnvVar, v))
+		} else if async {
+			opts = append(opts, WithAsync())
+		}
+	}
+
+	if v := getenv(FileDirEnvVar); v != "" {
+		opts = append(opts, WithFileDir(v))
+	}
+
+	if v := getenv(FileTemplateEnvVar); v != "" {
+		opts = append(opts, WithFileTemplate(v))
+	}
+
+	if v := getenv(VerbosityEnvVar); v != "" {
+		verbosity, err := parseVerbosity(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("gormsanity: invalid %s %q: %v", VerbosityEnvVar, v, err))
+		} else {
+			opts = append(opts, WithVerbosity(verbosity))
+		}
+	}
+
+	if v := getenv(ServiceNameEnvVar); v != "" {
+		opts = append(opts, WithServiceName(v))
+	}
+
+	if v := getenv(ServiceVersionEnvVar); v != "" {
+		opts = append(opts, WithServiceVersion(v))
+	}
+
+	if v := getenv(TagsEnvVar); v != "" {
+		tags := map[string]string{}
+		for _, tag := range splitList(v) {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+				errs = append(errs, fmt.Errorf("gormsanity: invalid %s tag %q, expected key=value", TagsEnvVar, tag))
+				continue
+			}
+			tags[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+		if len(tags) > 0 {
+			opts = append(opts, WithTags(tags))
+		}
+	}
+
+	return opts, errs
+}
+
+func parseVerbosity(s string) (Verbosity, error) {
+	switch v := Verbosity(strings.ToLower(s)); v {
+	case VerbosityFull, VerbositySummary:
+		return v, nil
+	}
+	return "", fmt.Errorf("expected %q or %q", VerbosityFull, VerbositySummary)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// reportConfigErrors hands configuration problems to the OnError hook, or
+// standard error without one, rather than failing the application.
+func (t *Tracer) reportConfigErrors(errs []error) {
+	for _, err := range errs {
+		if t.onError != nil {
+			t.onError(err)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
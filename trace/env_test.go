@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestEnvOptions(t *testing.T) {
+	a := require.New(t)
+	env := map[string]string{
+		SampleRateEnvVar:     "0.25",
+		MinDurationEnvVar:    "50ms",
+		EventTypesEnvVar:     "create, update,",
+		TablesEnvVar:         "accounts,orders",
+		AsyncEnvVar:          "true",
+		FileDirEnvVar:        "/var/log/app",
+		FileTemplateEnvVar:   "{service}.log",
+		ServiceNameEnvVar:    "billing",
+		ServiceVersionEnvVar: "v1.4.2",
+		TagsEnvVar:           "env=prod, region = us-east-1",
+		VerbosityEnvVar:      "Summary",
+	}
+
+	opts, errs := envOptions(func(k string) string { return env[k] })
+	a.Empty(errs)
+
+	var tracer Tracer
+	for _, opt := range opts {
+		opt(&tracer)
+	}
+	a.Equal(0.25, tracer.sample)
+	a.Equal(50*time.Millisecond, tracer.minDuration)
+	a.Equal(map[string]bool{"create": true, "update": true}, tracer.eventTypes)
+	a.Equal(map[string]bool{"accounts": true, "orders": true}, tracer.tables)
+	a.True(tracer.async)
+	a.Equal(VerbositySummary, tracer.verbosity)
+	a.Equal(fileConfig{dir: "/var/log/app", template: "{service}.log", service: "billing"}, tracer.file)
+	a.Equal("v1.4.2", tracer.version)
+	a.Equal(map[string]string{"env": "prod", "region": "us-east-1"}, tracer.tags)
+}
+
+func TestEnvOptions_Invalid(t *testing.T) {
+	a := require.New(t)
+	env := map[string]string{
+		SampleRateEnvVar:  "2",
+		MinDurationEnvVar: "soon",
+		AsyncEnvVar:       "maybe",
+		VerbosityEnvVar:   "loud",
+		TagsEnvVar:        "env",
+	}
+
+	opts, errs := envOptions(func(k string) string { return env[k] })
+	a.Empty(opts)
+	a.Len(errs, 5)
+	a.Contains(errs[0].Error(), SampleRateEnvVar)
+}
+
+func TestTraceDB_Env(t *testing.T) {
+	a := require.New(t)
+	os.Setenv(EventTypesEnvVar, "query")
+	os.Setenv(SampleRateEnvVar, "lots")
+	defer os.Unsetenv(EventTypesEnvVar)
+	defer os.Unsetenv(SampleRateEnvVar)
+
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	var errs []error
+	db, tracer := TraceDB(db, WithSink(sink), OnError(func(err error) { errs = append(errs, err) }))
+	a.NoError(db.Create(&models.Account{EmailAddress: "env@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	a.Len(sink.Operations(), 1)
+	a.Equal("query", sink.Operations()[0].EventType)
+	a.Len(errs, 1)
+
+	// Options take precedence over the environment.
+	db, _ = openFakeDB(t)
+	sink = &memorySink{}
+	db, tracer = TraceDB(db, WithSink(sink), WithEventTypes("create"), OnError(func(error) {}))
+	a.NoError(db.Create(&models.Account{EmailAddress: "env@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	a.Len(sink.Operations(), 1)
+	a.Equal("create", sink.Operations()[0].EventType)
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// EventError is an error as recorded in a trace, keeping its message and
+// the Go type it had.
+type EventError struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+func (e EventError) Error() string {
+	return e.Message
+}
+
+// EventErrors are the errors of an operation. Most error types have no
+// exported fields, so they're serialized as EventErrors.
+type EventErrors []error
+
+func (errs EventErrors) details() []EventError {
+	details := make([]EventError, 0, len(errs))
+	for _, err := range errs {
+		if e, ok := err.(EventError); ok {
+			details = append(details, e)
+			continue
+		}
+		details = append(details, EventError{Message: err.Error(), Type: fmt.Sprintf("%T", err)})
+	}
+	return details
+}
+
+func (errs EventErrors) MarshalJSON() ([]byte, error) {
+	if errs == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(errs.details())
+}
+
+func (errs *EventErrors) UnmarshalJSON(data []byte) error {
+	var details []EventError
+	if err := json.Unmarshal(data, &details); err != nil {
+		return err
+	}
+	if details == nil {
+		*errs = nil
+		return nil
+	}
+	*errs = make(EventErrors, 0, len(details))
+	for _, e := range details {
+		*errs = append(*errs, e)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestEventErrors_JSON(t *testing.T) {
+	a := require.New(t)
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	a.NoError(sink.Write(&GormEvent{SchemaVersion: SchemaVersion, Errors: []error{errors.New("duplicate key")}, HasError: true}))
+	a.Contains(buf.String(), `"errors":[{"message":"duplicate key","type":"*errors.errorString"}],"has_error":true`)
+
+	event, err := NewDecoder(&buf).Decode()
+	a.NoError(err)
+	a.Equal(EventErrors{EventError{Message: "duplicate key", Type: "*errors.errorString"}}, event.Errors)
+	a.True(event.HasError)
+}
+
+func TestDecodeEvent_V1Errors(t *testing.T) {
+	a := require.New(t)
+
+	event, err := DecodeEvent([]byte(`{"schema_version":1,"errors":[{}]}`))
+	a.NoError(err)
+	a.True(event.HasError)
+	a.EqualError(event.Errors[0], "unknown error")
+
+	event, err = DecodeEvent([]byte(`{"schema_version":1,"errors":null}`))
+	a.NoError(err)
+	a.False(event.HasError)
+	a.Nil(event.Errors)
+}
+
+func TestTracer_HasError(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing") {
+			return errors.New("column does not exist")
+		}
+		return nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.Error(db.Where("missing = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.False(events[0].HasError)
+	a.True(events[1].HasError)
+	a.Equal("column does not exist", events[1].Errors.details()[0].Message)
+}
@@ -0,0 +1,355 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// explainQueueSize bounds the queries waiting to be explained. Queries
+// arriving when it's full are explained when they next recur.
+const explainQueueSize = 64
+
+var (
+	pgSeqScan = regexp.MustCompile(`Seq Scan on "?([\w.]+)"?`)
+	pgFilter  = regexp.MustCompile(`^\s*(?:Filter|Rows Removed by Filter):`)
+	pgSort    = regexp.MustCompile(`^\s*(?:->\s*)?Sort\s+\(cost=[\d.]+\.\.([\d.]+) rows=(\d+)`)
+	orderBy   = regexp.MustCompile(`(?i)\bORDER\s+BY\b`)
+)
+
+// explainer runs EXPLAIN in the background on queries that recur, at most
+// once per interval for each fingerprint, and reports filters answered by
+// reading the whole of a table with at least minRows rows, and sorts of
+// at least minRows rows for ORDER BY, which an index would avoid. See
+// WithExplain.
+type explainer struct {
+	interval time.Duration
+	minRows  int64
+
+	mu     sync.Mutex
+	db     *sql.DB
+	seen   map[string]*explainedQuery
+	queue  chan explainJob
+	done   chan struct{}
+	closed bool
+}
+
+type explainedQuery struct {
+	count int
+	at    time.Time
+}
+
+type explainJob struct {
+	query   string
+	vars    []interface{}
+	trigger GormEvent
+}
+
+// fullScan is a table read in full to filter its rows.
+type fullScan struct {
+	table string
+	rows  int64
+}
+
+// planSort is a sort of rows that no index returns in order, with the
+// planner's estimate of its total cost, including producing its input.
+type planSort struct {
+	rows int64
+	cost float64
+}
+
+func newExplainer(interval time.Duration, minRows int64) *explainer {
+	return &explainer{interval: interval, minRows: minRows, seen: map[string]*explainedQuery{}}
+}
+
+func (x *explainer) rule() string { return "unindexed_filter" }
+
+// use sets the database EXPLAIN runs on, unless it's set already.
+func (x *explainer) use(db *sql.DB) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.db == nil {
+		x.db = db
+	}
+}
+
+// considerExplain queues the query of e to be explained if it has recurred and
+// hasn't been explained within the interval.
+func (t *Tracer) considerExplain(e *GormEvent, scope *gorm.Scope) {
+	x := t.explain
+	if x == nil || e.Fingerprint == "" || e.EventType != "query" && e.EventType != "row_query" ||
+		!explainable(e.Dialect) || !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(scope.SQL)), "SELECT") {
+		return
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.db == nil || x.closed {
+		return
+	}
+	q := x.seen[e.Fingerprint]
+	if q == nil {
+		q = &explainedQuery{}
+		x.seen[e.Fingerprint] = q
+	}
+	q.count++
+	if q.count < 2 || !q.at.IsZero() && e.StartTime.Sub(q.at) < x.interval {
+		return
+	}
+
+	if x.queue == nil {
+		x.queue = make(chan explainJob, explainQueueSize)
+		x.done = make(chan struct{})
+		go t.runExplain(x.db, x.queue, x.done)
+	}
+	job := explainJob{query: scope.SQL, vars: append([]interface{}(nil), scope.SQLVars...), trigger: *e}
+	select {
+	case x.queue <- job:
+		q.at = e.StartTime
+	default:
+	}
+}
+
+func (t *Tracer) runExplain(db *sql.DB, queue <-chan explainJob, done chan<- struct{}) {
+	defer close(done)
+	for job := range queue {
+		if err := t.explainJob(db, job); err != nil && t.onError != nil {
+			t.onError(fmt.Errorf("gormsanity: explaining %s: %v", job.query, err))
+		}
+	}
+}
+
+func (t *Tracer) explainJob(db *sql.DB, job explainJob) error {
+	dialect := job.trigger.Dialect
+	columns, plan, err := explainQuery(db, job.query, job.vars)
+	if err != nil {
+		return err
+	}
+	text := planText(dialect, columns, plan)
+
+	scans, err := fullScans(db, dialect, columns, plan)
+	if err != nil {
+		return err
+	}
+	for _, s := range scans {
+		if s.rows < t.explain.minRows {
+			continue
+		}
+		t.reportViolation(&job.trigger, &Violation{
+			Rule:    t.explain.rule(),
+			Message: fmt.Sprintf("filtering %s reads all of its ~%d rows; an index on the filtered columns would avoid it", s.table, s.rows),
+			Count:   1,
+			Events:  []string{job.trigger.ID},
+			Plan:    text,
+		})
+	}
+
+	if !orderBy.MatchString(job.query) {
+		return nil
+	}
+	for _, s := range sorts(dialect, columns, plan) {
+		if s.rows < t.explain.minRows {
+			continue
+		}
+		t.reportViolation(&job.trigger, &Violation{
+			Rule:    "unindexed_sort",
+			Message: fmt.Sprintf("ordering %s sorts ~%d rows; an index on the ORDER BY columns would return them in order", job.trigger.TableName, s.rows),
+			Count:   1,
+			Events:  []string{job.trigger.ID},
+			Plan:    text,
+			Cost:    s.cost,
+		})
+	}
+	return nil
+}
+
+// stop waits for the queries queued to be explained.
+func (x *explainer) stop() {
+	x.mu.Lock()
+	x.closed = true
+	queue, done := x.queue, x.done
+	x.mu.Unlock()
+	if queue != nil {
+		close(queue)
+		<-done
+	}
+}
+
+func explainable(dialect string) bool {
+	return dialect == "postgres" || dialect == "mysql"
+}
+
+// explainQuery runs EXPLAIN on query, returning the plan's columns and
+// rows.
+func explainQuery(db *sql.DB, query string, vars []interface{}) ([]string, [][]string, error) {
+	rows, err := db.Query("EXPLAIN "+query, vars...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	var plan [][]string
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = v.String
+		}
+		plan = append(plan, row)
+	}
+	return columns, plan, rows.Err()
+}
+
+// fullScans returns the tables a plan filters by reading them in full,
+// with their sizes.
+func fullScans(db *sql.DB, dialect string, columns []string, plan [][]string) ([]fullScan, error) {
+	if dialect == "mysql" {
+		return mysqlFullScans(columns, plan), nil
+	}
+	scans := pgFullScans(planLines(plan))
+	for i := range scans {
+		// Postgres plans estimate the rows left after filtering, so the
+		// table's size is looked up.
+		rows, err := estimatedRows(db, dialect, scans[i].table)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		scans[i].rows = rows
+	}
+	return scans, nil
+}
+
+// sorts returns the sorts of a plan that no index provides the order of.
+func sorts(dialect string, columns []string, plan [][]string) []planSort {
+	if dialect == "mysql" {
+		return mysqlSorts(columns, plan)
+	}
+	return pgSorts(planLines(plan))
+}
+
+func planLines(plan [][]string) []string {
+	var lines []string
+	for _, row := range plan {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	return lines
+}
+
+func planText(dialect string, columns []string, plan [][]string) string {
+	if dialect == "mysql" {
+		return formatPlan(columns, plan)
+	}
+	return strings.Join(planLines(plan), "\n")
+}
+
+// pgFullScans finds the sequential scans with a filter in the lines of a
+// Postgres plan.
+func pgFullScans(lines []string) []fullScan {
+	var scans []fullScan
+	for i, line := range lines {
+		m := pgSeqScan.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		for _, detail := range lines[i+1:] {
+			if strings.Contains(detail, "->") {
+				break
+			}
+			if pgFilter.MatchString(detail) {
+				scans = append(scans, fullScan{table: m[1]})
+				break
+			}
+		}
+	}
+	return scans
+}
+
+// pgSorts finds the Sort nodes of a Postgres plan. Incremental sorts,
+// whose input is partly ordered by an index, aren't included.
+func pgSorts(lines []string) []planSort {
+	var found []planSort
+	for _, line := range lines {
+		m := pgSort.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		s := planSort{}
+		s.cost, _ = strconv.ParseFloat(m[1], 64)
+		s.rows, _ = strconv.ParseInt(m[2], 10, 64)
+		found = append(found, s)
+	}
+	return found
+}
+
+// mysqlFullScans finds the tables MySQL reads in full, access type ALL,
+// to filter with a WHERE clause.
+func mysqlFullScans(columns []string, plan [][]string) []fullScan {
+	index := map[string]int{}
+	for i, c := range columns {
+		index[strings.ToLower(c)] = i
+	}
+	get := func(row []string, column string) string {
+		if i, ok := index[column]; ok {
+			return row[i]
+		}
+		return ""
+	}
+
+	var scans []fullScan
+	for _, row := range plan {
+		if get(row, "type") != "ALL" || !strings.Contains(get(row, "extra"), "Using where") {
+			continue
+		}
+		rows, _ := strconv.ParseInt(get(row, "rows"), 10, 64)
+		scans = append(scans, fullScan{table: get(row, "table"), rows: rows})
+	}
+	return scans
+}
+
+// mysqlSorts finds the tables MySQL sorts with a filesort. Its plans
+// don't estimate the cost.
+func mysqlSorts(columns []string, plan [][]string) []planSort {
+	index := map[string]int{}
+	for i, c := range columns {
+		index[strings.ToLower(c)] = i
+	}
+	rowsAt, ok := index["rows"]
+	extraAt, ok2 := index["extra"]
+	if !ok || !ok2 {
+		return nil
+	}
+
+	var found []planSort
+	for _, row := range plan {
+		if !strings.Contains(row[extraAt], "Using filesort") {
+			continue
+		}
+		rows, _ := strconv.ParseInt(row[rowsAt], 10, 64)
+		found = append(found, planSort{rows: rows})
+	}
+	return found
+}
+
+func formatPlan(columns []string, plan [][]string) string {
+	lines := []string{strings.Join(columns, "\t")}
+	for _, row := range plan {
+		lines = append(lines, strings.Join(row, "\t"))
+	}
+	return strings.Join(lines, "\n")
+}
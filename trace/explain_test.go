@@ -0,0 +1,158 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_Explain(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		switch {
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"QUERY PLAN"}, [][]driver.Value{
+				{`Seq Scan on accounts  (cost=0.00..1693.00 rows=1 width=64)`},
+				{`  Filter: ((email_address)::text = 'a@acme.com'::text)`},
+			}
+		case strings.Contains(query, "pg_class"):
+			return []string{"reltuples"}, [][]driver.Value{{int64(50000)}}
+		}
+		return nil, nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithExplain(time.Hour, 1000))
+	for i := 0; i < 3; i++ {
+		a.NoError(db.Where("email_address = ?", "a@acme.com").Find(&[]models.Account{}).Error)
+	}
+	tracer.Close()
+
+	var explained int
+	for _, q := range fdb.queries {
+		if strings.HasPrefix(q, "EXPLAIN") {
+			explained++
+		}
+	}
+	a.Equal(1, explained, "once it recurs, then once an interval")
+
+	var violations []*GormEvent
+	for _, e := range sink.Events() {
+		if e.EventType == ViolationEventType {
+			violations = append(violations, e)
+		}
+	}
+	a.Len(violations, 1)
+	v := violations[0].Violation
+	a.Equal("unindexed_filter", v.Rule)
+	a.Contains(v.Message, "filtering accounts reads all of its ~50000 rows")
+	a.Contains(v.Plan, "Seq Scan on accounts")
+	a.Equal("accounts", violations[0].TableName)
+}
+
+func TestTracer_ExplainSmallTable(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		switch {
+		case strings.HasPrefix(query, "EXPLAIN"):
+			return []string{"QUERY PLAN"}, [][]driver.Value{{`Seq Scan on accounts`}, {`  Filter: (id = 1)`}}
+		case strings.Contains(query, "pg_class"):
+			return []string{"reltuples"}, [][]driver.Value{{int64(10)}}
+		}
+		return nil, nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithExplain(time.Hour, 1000))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 2).Find(&[]models.Account{}).Error)
+	tracer.Close()
+	a.Len(sink.Events(), 2)
+}
+
+func TestTracer_ExplainSort(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		if strings.HasPrefix(query, "EXPLAIN") {
+			return []string{"QUERY PLAN"}, [][]driver.Value{
+				{`Sort  (cost=9845.32..9970.32 rows=50000 width=64)`},
+				{`  Sort Key: nick_name`},
+				{`  ->  Index Scan using accounts_org_idx on accounts  (cost=0.29..1693.00 rows=50000 width=64)`},
+				{`        Index Cond: (organization_id = 'org-1'::text)`},
+			}
+		}
+		return nil, nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithExplain(time.Hour, 1000))
+	for i := 0; i < 2; i++ {
+		a.NoError(db.Where("organization_id = ?", "org-1").Order("nick_name").Find(&[]models.Account{}).Error)
+	}
+	tracer.Close()
+
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+		}
+	}
+	a.Len(violations, 1)
+	a.Equal("unindexed_sort", violations[0].Rule)
+	a.Equal("ordering accounts sorts ~50000 rows; an index on the ORDER BY columns would return them in order", violations[0].Message)
+	a.Equal(9970.32, violations[0].Cost)
+	a.Contains(violations[0].Plan, "Sort Key: nick_name")
+}
+
+func TestPgFullScans(t *testing.T) {
+	a := require.New(t)
+	plan := []string{
+		`Hash Join  (cost=1.09..2.20 rows=4 width=72)`,
+		`  Hash Cond: (o.id = l.order_id)`,
+		`  ->  Seq Scan on orders o  (cost=0.00..1.04 rows=4 width=8)`,
+		`  ->  Hash  (cost=1.05..1.05 rows=3 width=64)`,
+		`        ->  Parallel Seq Scan on "lines" l  (cost=0.00..1.05 rows=3 width=64)`,
+		`              Filter: (sku = 'a'::text)`,
+	}
+	a.Equal([]fullScan{{table: "lines"}}, pgFullScans(plan), "scans without a filter read what they must")
+}
+
+func TestPgSorts(t *testing.T) {
+	a := require.New(t)
+	plan := []string{
+		`Limit  (cost=25.88..25.90 rows=10 width=72)`,
+		`  ->  Sort  (cost=25.88..26.28 rows=160 width=72)`,
+		`        Sort Key: created_at DESC`,
+		`        ->  Incremental Sort  (cost=0.48..22.42 rows=160 width=72)`,
+	}
+	a.Equal([]planSort{{rows: 160, cost: 26.28}}, pgSorts(plan))
+}
+
+func TestMysqlSorts(t *testing.T) {
+	a := require.New(t)
+	columns := []string{"id", "table", "type", "rows", "Extra"}
+	plan := [][]string{
+		{"1", "accounts", "ref", "5120", "Using where; Using filesort"},
+		{"1", "orders", "index", "40", "Using index"},
+	}
+	a.Equal([]planSort{{rows: 5120}}, mysqlSorts(columns, plan))
+}
+
+func TestMysqlFullScans(t *testing.T) {
+	a := require.New(t)
+	columns := []string{"id", "select_type", "table", "type", "possible_keys", "key", "rows", "Extra"}
+	plan := [][]string{
+		{"1", "SIMPLE", "accounts", "ALL", "", "", "48213", "Using where"},
+		{"1", "SIMPLE", "orders", "ref", "idx_account", "idx_account", "3", "Using where"},
+		{"1", "SIMPLE", "tags", "ALL", "", "", "12", ""},
+	}
+	a.Equal([]fullScan{{table: "accounts", rows: 48213}}, mysqlFullScans(columns, plan))
+}
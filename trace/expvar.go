@@ -0,0 +1,85 @@
+package trace
+
+import (
+	"expvar"
+	"fmt"
+	"sort"
+)
+
+// The health of every tracer tracing a database is published with expvar
+// under "gormsanity", so it's served at /debug/vars with the rest, keyed
+// by tracer name:
+//
+//	"gormsanity": {"primary": {"events": {"query": 120, "create": 4}, "errors": 2, "pending": 1, ...}}
+//
+// Events and errors count every operation completed, regardless of
+// sampling and filtering, as Metrics does.
+func init() {
+	expvar.Publish("gormsanity", expvar.Func(tracerVars))
+}
+
+// tracerSeq numbers tracers in the order they're created.
+var tracerSeq uint64
+
+// tracerExpvars is what a tracer publishes with expvar.
+type tracerExpvars struct {
+	Events     map[string]uint64 `json:"events"`
+	Errors     uint64            `json:"errors"`
+	Pending    int               `json:"pending"`
+	Written    uint64            `json:"written"`
+	Failed     uint64            `json:"failed"`
+	Dropped    uint64            `json:"dropped"`
+	Filtered   uint64            `json:"filtered"`
+	Evicted    uint64            `json:"evicted"`
+	Suppressed uint64            `json:"suppressed"`
+}
+
+// tracerVars describes the tracers in the registry. Tracers sharing a name
+// are told apart by a suffix, in the order they were created.
+func tracerVars() interface{} {
+	registryMu.Lock()
+	seen := map[*Tracer]bool{}
+	var tracers []*Tracer
+	for _, t := range registry {
+		if !seen[t] {
+			seen[t] = true
+			tracers = append(tracers, t)
+		}
+	}
+	registryMu.Unlock()
+	sort.Slice(tracers, func(i, j int) bool { return tracers[i].seq < tracers[j].seq })
+
+	vars := map[string]tracerExpvars{}
+	for _, t := range tracers {
+		name := t.Name()
+		for n := 2; ; n++ {
+			if _, taken := vars[name]; !taken {
+				break
+			}
+			name = fmt.Sprintf("%s#%d", t.Name(), n)
+		}
+		vars[name] = t.expvars()
+	}
+	return vars
+}
+
+func (t *Tracer) expvars() tracerExpvars {
+	stats := t.Stats()
+	v := tracerExpvars{
+		Events:     map[string]uint64{},
+		Written:    stats.Written,
+		Failed:     stats.Failed,
+		Dropped:    stats.Dropped,
+		Filtered:   stats.Filtered,
+		Evicted:    stats.Evicted,
+		Suppressed: stats.Suppressed,
+	}
+	for _, op := range t.Metrics().Operations {
+		v.Events[op.EventType] += op.Count
+		v.Errors += op.Errors
+	}
+	t.mu.Lock()
+	v.Pending = t.pending.order.Len()
+	t.mu.Unlock()
+	return v
+}
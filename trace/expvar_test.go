@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_Expvar(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing") {
+			return errors.New("column does not exist")
+		}
+		return nil
+	}
+	other, _ := openFakeDB(t)
+
+	db, tracer := TraceDB(db, WithName("expvar"), WithSink(&memorySink{}), WithoutRules("no_where_clause", "zero_insert_value"))
+	defer tracer.Close()
+	_, twin := TraceDB(other, WithName("expvar"), WithSink(&memorySink{}))
+	defer twin.Close()
+	a.NoError(db.Create(&models.Account{EmailAddress: "vars@acme.com"}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.Error(db.Where("missing = ?", 1).Find(&[]models.Account{}).Error)
+
+	var vars map[string]tracerExpvars
+	a.NoError(json.Unmarshal([]byte(expvar.Get("gormsanity").String()), &vars))
+	v := vars["expvar"]
+	a.Equal(map[string]uint64{"create": 1, "query": 2}, v.Events)
+	a.Equal(uint64(1), v.Errors)
+	a.Zero(v.Pending)
+	a.Equal(uint64(3), v.Written)
+	a.Contains(vars, "expvar#2")
+
+	twin.Close()
+	vars = nil
+	a.NoError(json.Unmarshal([]byte(expvar.Get("gormsanity").String()), &vars))
+	a.NotContains(vars, "expvar#2", "closed tracers are left out")
+}
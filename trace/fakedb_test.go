@@ -0,0 +1,180 @@
+package trace
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDriver lets the tracer be exercised through GORM without a running
+// database. Every statement succeeds; queries return whatever the fakeDB's
+// rows func produces, unless the fail func returns an error for them.
+type fakeDriver struct{}
+
+type fakeDB struct {
+	mu           sync.Mutex
+	queries      []string
+	rowsAffected int64
+	rows         func(query string, args []driver.Value) ([]string, [][]driver.Value)
+	fail         func(query string) error
+}
+
+var (
+	fakeDBsMu sync.Mutex
+	fakeDBs   = map[string]*fakeDB{}
+)
+
+func init() {
+	sql.Register("gormsanity_fake", fakeDriver{})
+}
+
+func (fakeDriver) Open(name string) (driver.Conn, error) {
+	fakeDBsMu.Lock()
+	defer fakeDBsMu.Unlock()
+	return &fakeConn{db: fakeDBs[name]}, nil
+}
+
+type fakeConn struct {
+	db *fakeDB
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{db: c.db, query: query}, nil
+}
+
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	db    *fakeDB
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries = append(s.db.queries, s.query)
+	if s.db.fail != nil {
+		if err := s.db.fail(s.query); err != nil {
+			return nil, err
+		}
+	}
+	return driver.RowsAffected(s.db.rowsAffected), nil
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	s.db.mu.Lock()
+	defer s.db.mu.Unlock()
+	s.db.queries = append(s.db.queries, s.query)
+	if s.db.fail != nil {
+		if err := s.db.fail(s.query); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.db.rows != nil {
+		columns, values := s.db.rows(s.query, args)
+		return &fakeRows{columns: columns, values: values}, nil
+	}
+
+	// Postgres inserts read the new primary key back.
+	if strings.Contains(s.query, "RETURNING") {
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{int64(1)}}}, nil
+	}
+	return &fakeRows{}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	i       int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.i])
+	r.i++
+	return nil
+}
+
+// openFakeDB returns a postgres flavored GORM handle backed by fakeDriver.
+func openFakeDB(t *testing.T) (*gorm.DB, *fakeDB) {
+	fdb := &fakeDB{rowsAffected: 1}
+	name := fmt.Sprintf("%s/%p", t.Name(), fdb)
+
+	fakeDBsMu.Lock()
+	fakeDBs[name] = fdb
+	fakeDBsMu.Unlock()
+
+	sqlDB, err := sql.Open("gormsanity_fake", name)
+	require.NoError(t, err)
+
+	db, err := gorm.Open("postgres", sqlDB)
+	require.NoError(t, err)
+
+	return db, fdb
+}
+
+// memorySink collects written events for assertions.
+type memorySink struct {
+	mu     sync.Mutex
+	events []*GormEvent
+	closed bool
+}
+
+func (s *memorySink) Write(event *GormEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("memorySink: write after close")
+	}
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *memorySink) Flush() error { return nil }
+
+func (s *memorySink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *memorySink) Events() []*GormEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*GormEvent(nil), s.events...)
+}
+
+// Operations returns the events written other than violations.
+func (s *memorySink) Operations() []*GormEvent {
+	var ops []*GormEvent
+	for _, e := range s.Events() {
+		if e.EventType != ViolationEventType {
+			ops = append(ops, e)
+		}
+	}
+	return ops
+}
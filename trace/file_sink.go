@@ -0,0 +1,262 @@
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotateTimeFormat = "20060102T150405.000000000"
+
+// FileSink writes events as newline delimited JSON to a file on disk. The
+// file isn't created until the first event is written.
+//
+// Rotation is disabled unless MaxSize is set. When the file would grow past
+// MaxSize it's renamed to <name>-<timestamp><ext> and a fresh file is
+// started at the original path. The rotation fields must be set before the
+// first event is written.
+//
+// Events are written as newline delimited JSON unless another Formatter is
+// set. Setting Compress writes a gzip stream, appending .gz to the file name if
+// it's not already there.
+type FileSink struct {
+	Formatter Formatter
+
+	// MaxSize is the size in bytes a file may reach before it's rotated.
+	MaxSize int64
+	// MaxFiles is the number of rotated files to keep. Zero keeps them all.
+	MaxFiles int
+	// MaxAge removes rotated files older than this. Zero keeps them
+	// regardless of age.
+	MaxAge time.Duration
+	// Compress gzips the output.
+	Compress bool
+	// Perm is the mode files are created with.
+	Perm os.FileMode
+
+	path string
+
+	mu   sync.Mutex
+	f    *os.File
+	gz   *gzip.Writer
+	w    *bufio.Writer
+	size int64
+}
+
+// NewFileSink creates a sink writing to path.
+func NewFileSink(path string) *FileSink {
+	return &FileSink{Formatter: JSONFormatter{}, Perm: 0644, path: path}
+}
+
+func (s *FileSink) Write(event *GormEvent) error {
+	line, err := s.Formatter.Format(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The compressed size of a line isn't known until it's written.
+	next := int64(len(line))
+	if s.Compress {
+		next = 0
+	}
+
+	if s.w != nil && s.MaxSize > 0 && s.size > 0 && s.size+next > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if s.w == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+
+	s.w.Write(line)
+	return s.flush()
+}
+
+func (s *FileSink) filePath() string {
+	if s.Compress && !strings.HasSuffix(s.path, ".gz") {
+		return s.path + ".gz"
+	}
+	return s.path
+}
+
+// splitExt splits path into a base and an extension, treating a compressed
+// extension such as .log.gz as a single extension.
+func splitExt(path string) (string, string) {
+	ext := filepath.Ext(path)
+	if ext == ".gz" {
+		ext = filepath.Ext(strings.TrimSuffix(path, ext)) + ext
+	}
+	return strings.TrimSuffix(path, ext), ext
+}
+
+func (s *FileSink) open() error {
+	path := s.filePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, s.Perm)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = info.Size()
+
+	var out io.Writer = &countingWriter{w: f, n: &s.size}
+	if s.Compress {
+		// Appending to an existing file starts a new gzip member, which
+		// gzip readers handle transparently.
+		s.gz = gzip.NewWriter(out)
+		out = s.gz
+	}
+	s.w = bufio.NewWriter(out)
+
+	if h, ok := s.Formatter.(headerFormatter); ok && s.size == 0 {
+		s.w.Write(h.Header())
+	}
+	return nil
+}
+
+func (s *FileSink) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if s.gz != nil {
+		return s.gz.Flush()
+	}
+	return nil
+}
+
+// closeFile flushes buffered events and syncs them to disk before closing
+// the file, returning the first error.
+func (s *FileSink) closeFile() error {
+	err := s.w.Flush()
+	if s.gz != nil {
+		if gzErr := s.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	if syncErr := s.f.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := s.f.Close(); err == nil {
+		err = closeErr
+	}
+	s.f, s.gz, s.w, s.size = nil, nil, nil, 0
+	return err
+}
+
+// Rotate moves the current file aside, if anything has been written to it,
+// so the next event starts a fresh file.
+func (s *FileSink) Rotate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		return nil
+	}
+	return s.rotate()
+}
+
+// RotatedFiles lists the files moved aside by rotation, oldest first.
+func (s *FileSink) RotatedFiles() ([]string, error) {
+	base, ext := splitExt(s.filePath())
+	backups, err := filepath.Glob(base + "-*" + ext)
+	sort.Strings(backups)
+	return backups, err
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.closeFile(); err != nil {
+		return err
+	}
+
+	path := s.filePath()
+	base, ext := splitExt(path)
+	backup := base + "-" + time.Now().Format(rotateTimeFormat) + ext
+	if err := os.Rename(path, backup); err != nil {
+		return err
+	}
+
+	s.prune(base, ext)
+	return nil
+}
+
+// prune removes rotated files beyond MaxFiles or older than MaxAge.
+func (s *FileSink) prune(base, ext string) {
+	if s.MaxFiles <= 0 && s.MaxAge <= 0 {
+		return
+	}
+
+	backups, err := filepath.Glob(base + "-*" + ext)
+	if err != nil {
+		return
+	}
+
+	// Timestamps sort lexically, newest last.
+	sort.Strings(backups)
+
+	cutoff := time.Now().Add(-s.MaxAge)
+	for i, b := range backups {
+		if s.MaxFiles > 0 && i < len(backups)-s.MaxFiles {
+			os.Remove(b)
+			continue
+		}
+		if s.MaxAge > 0 {
+			if info, err := os.Stat(b); err == nil && info.ModTime().Before(cutoff) {
+				os.Remove(b)
+			}
+		}
+	}
+}
+
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.w == nil {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.f == nil {
+		return nil
+	}
+	return s.closeFile()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	*c.n += int64(n)
+	return n, err
+}
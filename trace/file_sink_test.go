@@ -0,0 +1,190 @@
+package trace
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestFileSink(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trace.log")
+	sink := NewFileSink(path)
+
+	_, err = os.Stat(path)
+	a.True(os.IsNotExist(err), "file is created lazily")
+
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "delete"}))
+	a.NoError(sink.Close())
+
+	f, err := os.Open(path)
+	a.NoError(err)
+	defer f.Close()
+
+	var types []string
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e GormEvent
+		a.NoError(json.Unmarshal(sc.Bytes(), &e))
+		types = append(types, e.EventType)
+	}
+	a.Equal([]string{"query", "delete"}, types)
+}
+
+func TestFileSink_Rotation(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := NewFileSink(filepath.Join(dir, "trace.log"))
+	sink.MaxSize = 1
+	sink.MaxFiles = 2
+
+	for i := 0; i < 5; i++ {
+		a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	}
+	a.NoError(sink.Close())
+
+	backups, err := filepath.Glob(filepath.Join(dir, "trace-*.log"))
+	a.NoError(err)
+	a.Len(backups, 2)
+	a.FileExists(filepath.Join(dir, "trace.log"))
+}
+
+func TestFileSink_RotationError(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := NewFileSink(filepath.Join(dir, "trace.log"))
+	sink.MaxSize = 1
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+
+	// Closing the file underneath the sink makes syncing it on rotation
+	// fail.
+	a.NoError(sink.f.Close())
+	a.Error(sink.Write(&GormEvent{EventType: "query"}))
+
+	backups, err := filepath.Glob(filepath.Join(dir, "trace-*.log"))
+	a.NoError(err)
+	a.Empty(backups, "a file that failed to close isn't rotated")
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}), "the next write starts over")
+	a.NoError(sink.Close())
+}
+
+func TestFileSink_Compress(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	sink := NewFileSink(filepath.Join(dir, "trace.log"))
+	sink.Compress = true
+	sink.MaxSize = 1
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "update"}))
+	a.NoError(sink.Close())
+
+	backups, err := filepath.Glob(filepath.Join(dir, "trace-*.log.gz"))
+	a.NoError(err)
+	a.Len(backups, 1)
+
+	f, err := os.Open(filepath.Join(dir, "trace.log.gz"))
+	a.NoError(err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	a.NoError(err)
+
+	var e GormEvent
+	a.NoError(json.NewDecoder(gz).Decode(&e))
+	a.Equal("update", e.EventType)
+}
+
+func TestExpandFileTemplate(t *testing.T) {
+	now := time.Date(2020, 8, 1, 13, 4, 5, 0, time.UTC)
+	name := ExpandFileTemplate("{service}-{date}-{time}-{pid}.log", "billing", now)
+	require.Equal(t, fmt.Sprintf("billing-20200801-130405-%d.log", os.Getpid()), name)
+	require.Equal(t, fmt.Sprintf("gorm.%d.log", now.UnixNano()), ExpandFileTemplate(DefaultFileTemplate, "", now))
+}
+
+func TestTraceDB_FileOptions(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, _ := openFakeDB(t)
+	db, tracer := TraceDB(db, WithTest(t),
+		WithFileDir(filepath.Join(dir, "traces")),
+		WithFileTemplate("{service}.log"),
+		WithFilePerm(0600),
+		WithServiceName("billing"),
+	)
+	a.NoError(db.Delete(&models.Account{Id: 1}).Error)
+	tracer.Close()
+
+	info, err := os.Stat(filepath.Join(dir, "traces", "billing.log"))
+	a.NoError(err)
+	a.Equal(os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestTraceDB_WithFileRotation(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, _ := openFakeDB(t)
+	db, tracer := TraceDB(db, WithTest(t), WithFileDir(dir), WithFileTemplate("gorm.log"), WithFileRotation(512, 2, time.Hour))
+	sink := tracer.sink.(*FileSink)
+	a.Equal(int64(512), sink.MaxSize)
+	a.Equal(2, sink.MaxFiles)
+	a.Equal(time.Hour, sink.MaxAge)
+
+	for i := 0; i < 10; i++ {
+		a.NoError(db.Delete(&models.Account{Id: i + 1}).Error)
+	}
+	tracer.Close()
+
+	files, err := ioutil.ReadDir(dir)
+	a.NoError(err)
+	a.Len(files, 3, "the current file and two rotated ones")
+}
+
+func TestTraceDB_WithFileCompression(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	db, _ := openFakeDB(t)
+	db, tracer := TraceDB(db, WithTest(t), WithFileDir(dir), WithFileTemplate("gorm.log"), WithFileCompression())
+	a.NoError(db.Delete(&models.Account{Id: 1}).Error)
+	tracer.Close()
+
+	f, err := os.Open(filepath.Join(dir, "gorm.log.gz"))
+	a.NoError(err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	a.NoError(err)
+	event, err := NewDecoder(gz).Decode()
+	a.NoError(err)
+	a.Equal("delete", event.EventType)
+}
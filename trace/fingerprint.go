@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+var (
+	fingerprintPlaceholders = regexp.MustCompile(`\$\d+|\?`)
+	fingerprintStrings      = regexp.MustCompile(`'(?:[^']|'')*'`)
+	fingerprintNumbers      = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	fingerprintLists        = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	fingerprintSpace        = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeQuery reduces a statement to its shape: placeholders and
+// literals become ?, IN lists collapse to a single (?), whitespace and
+// case are normalized.
+func NormalizeQuery(query string) string {
+	q := fingerprintStrings.ReplaceAllString(query, "?")
+	q = fingerprintPlaceholders.ReplaceAllString(q, "?")
+	q = fingerprintNumbers.ReplaceAllString(q, "?")
+	q = fingerprintLists.ReplaceAllString(q, "(?)")
+	q = fingerprintSpace.ReplaceAllString(q, " ")
+	return strings.ToLower(strings.TrimSpace(q))
+}
+
+// Fingerprint identifies statements with the same shape regardless of the
+// values they were run with.
+func Fingerprint(query string) string {
+	if query == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(NormalizeQuery(query)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,24 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := require.New(t)
+
+	a.Equal(`select * from "accounts" where (id in (?)) and status = ? limit ?`,
+		NormalizeQuery(`SELECT * FROM "accounts"  WHERE (id IN ($1,$2,$3)) AND status = 'active' LIMIT 10`))
+
+	a.Equal(
+		Fingerprint(`SELECT * FROM "accounts" WHERE (id IN ($1,$2))`),
+		Fingerprint(`select *  from "accounts" where (id in ($1, $2, $3, $4))`),
+	)
+	a.NotEqual(
+		Fingerprint(`SELECT * FROM "accounts" WHERE (id = $1)`),
+		Fingerprint(`SELECT * FROM "organizations" WHERE (id = $1)`),
+	)
+	a.Empty(Fingerprint(""))
+}
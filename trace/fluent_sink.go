@@ -0,0 +1,283 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FluentSink ships events to Fluentd or Fluent Bit using the forward
+// protocol. Events are buffered and sent in Forward mode, one message per
+// tag, when BatchSize events are buffered and on Flush and Close. Each
+// event is tagged "<TagPrefix>.<db_instance_id>" unless Tag is set.
+//
+// With RequireAck every message carries a chunk id and the sink waits for
+// the server to acknowledge it, so failures surface as errors instead of
+// being lost in the socket buffer.
+//
+// Events that couldn't be sent are kept and sent with the next batch, up
+// to MaxPending of them, beyond which the oldest are dropped; see Dropped.
+// After a failure the sink waits ReconnectBackoff before trying again,
+// doubling the wait on each failure up to MaxReconnectBackoff, so writes
+// don't wait on the dial and ack timeouts while the server is down. Close
+// tries once more regardless. The configuration fields must be set before
+// the first event is written.
+type FluentSink struct {
+	TagPrefix           string
+	Tag                 func(*GormEvent) string
+	BatchSize           int
+	RequireAck          bool
+	DialTimeout         time.Duration
+	AckTimeout          time.Duration
+	MaxPending          int
+	ReconnectBackoff    time.Duration
+	MaxReconnectBackoff time.Duration
+
+	network string
+	addr    string
+	dropped uint64
+
+	mu      sync.Mutex
+	conn    net.Conn
+	r       *bufio.Reader
+	pending []*GormEvent
+	// backoff is the wait after the last failure, and retryAt when it
+	// ends, both zero while sends succeed.
+	backoff time.Duration
+	retryAt time.Time
+	lastErr error
+}
+
+// NewFluentSink creates a sink forwarding to addr, e.g. ("tcp",
+// "localhost:24224") or ("unix", "/var/run/fluent.sock").
+func NewFluentSink(network, addr string) *FluentSink {
+	return &FluentSink{
+		TagPrefix:           "gormsanity",
+		BatchSize:           100,
+		DialTimeout:         time.Second,
+		AckTimeout:          5 * time.Second,
+		MaxPending:          10000,
+		ReconnectBackoff:    time.Second,
+		MaxReconnectBackoff: time.Minute,
+		network:             network,
+		addr:                addr,
+	}
+}
+
+// Dropped returns the number of events discarded because MaxPending
+// events were waiting to be sent.
+func (s *FluentSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *FluentSink) tag(event *GormEvent) string {
+	if s.Tag != nil {
+		return s.Tag(event)
+	}
+	return s.TagPrefix + "." + event.InstanceID
+}
+
+func (s *FluentSink) Write(event *GormEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, event)
+	if over := len(s.pending) - s.MaxPending; s.MaxPending > 0 && over > 0 {
+		s.pending = append(s.pending[:0], s.pending[over:]...)
+		atomic.AddUint64(&s.dropped, uint64(over))
+	}
+	if len(s.pending) >= s.BatchSize && !s.backingOff() {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *FluentSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backingOff() && len(s.pending) > 0 {
+		return s.lastErr
+	}
+	return s.flush()
+}
+
+// backingOff reports whether the sink is waiting to try again after a
+// failure. The caller holds s.mu.
+func (s *FluentSink) backingOff() bool {
+	return !s.retryAt.IsZero() && time.Now().Before(s.retryAt)
+}
+
+// flush sends the pending events, keeping those it couldn't send and
+// backing off on failure. The caller holds s.mu.
+func (s *FluentSink) flush() error {
+	err := s.sendPending()
+	if err == nil {
+		s.backoff, s.retryAt, s.lastErr = 0, time.Time{}, nil
+		return nil
+	}
+	switch {
+	case s.backoff == 0:
+		s.backoff = s.ReconnectBackoff
+	case s.backoff < s.MaxReconnectBackoff:
+		s.backoff *= 2
+		if s.backoff > s.MaxReconnectBackoff {
+			s.backoff = s.MaxReconnectBackoff
+		}
+	}
+	s.retryAt = time.Now().Add(s.backoff)
+	s.lastErr = err
+	return err
+}
+
+func (s *FluentSink) sendPending() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+
+	// Group events by tag, keeping the order tags were first seen in.
+	var tags []string
+	byTag := map[string][]*GormEvent{}
+	for _, e := range s.pending {
+		tag := s.tag(e)
+		if _, ok := byTag[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		byTag[tag] = append(byTag[tag], e)
+	}
+
+	sent := map[string]bool{}
+	for _, tag := range tags {
+		if err := s.send(tag, byTag[tag]); err != nil {
+			// Keep the events of the tags yet to be sent, in order.
+			kept := s.pending[:0]
+			for _, e := range s.pending {
+				if !sent[s.tag(e)] {
+					kept = append(kept, e)
+				}
+			}
+			s.pending = kept
+			return err
+		}
+		sent[tag] = true
+	}
+	s.pending = nil
+	return nil
+}
+
+// send writes a Forward mode message, redialing once if the connection
+// broke since the last one.
+func (s *FluentSink) send(tag string, events []*GormEvent) error {
+	var chunk string
+	if s.RequireAck {
+		id := uuid.New()
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+	}
+	msg := appendFluentForward(nil, tag, events, chunk)
+
+	err := s.sendOnce(msg, chunk)
+	if err != nil {
+		s.disconnect()
+		err = s.sendOnce(msg, chunk)
+	}
+	return err
+}
+
+func (s *FluentSink) sendOnce(msg []byte, chunk string) error {
+	if s.conn == nil {
+		conn, err := net.DialTimeout(s.network, s.addr, s.DialTimeout)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+		s.r = bufio.NewReader(conn)
+	}
+
+	if _, err := s.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	s.conn.SetReadDeadline(time.Now().Add(s.AckTimeout))
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	d := &MsgpackDecoder{r: s.r}
+	resp, err := d.decodeValue()
+	if err != nil {
+		return err
+	}
+	if m, ok := resp.(map[string]interface{}); !ok || m["ack"] != chunk {
+		return fmt.Errorf("gormsanity: unexpected fluentd ack %v", resp)
+	}
+	return nil
+}
+
+func (s *FluentSink) disconnect() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn, s.r = nil, nil
+	}
+}
+
+func (s *FluentSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.flush()
+	s.disconnect()
+	return err
+}
+
+// appendFluentForward encodes a Forward mode message:
+//
+//	[tag, [[time, record], ...], option]
+func appendFluentForward(b []byte, tag string, events []*GormEvent, chunk string) []byte {
+	b = appendMsgpackArrayHeader(b, 3)
+	b = appendMsgpackString(b, tag)
+	b = appendMsgpackArrayHeader(b, len(events))
+	for _, e := range events {
+		b = appendMsgpackArrayHeader(b, 2)
+		b = appendFluentEventTime(b, e.StartTime)
+		b = appendFluentRecord(b, e)
+	}
+
+	if chunk == "" {
+		return appendMsgpackMapHeader(b, 0)
+	}
+	b = appendMsgpackMapHeader(b, 1)
+	b = appendMsgpackString(b, "chunk")
+	return appendMsgpackString(b, chunk)
+}
+
+// appendFluentEventTime encodes t as Fluentd's EventTime extension, type 0
+// holding big endian seconds and nanoseconds.
+func appendFluentEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = appendUint32(b, uint32(t.Unix()))
+	return appendUint32(b, uint32(t.Nanosecond()))
+}
+
+// appendFluentRecord encodes event like MsgpackFormatter but with
+// timestamps as RFC 3339 strings, as Fluentd doesn't understand the
+// MessagePack timestamp extension inside records.
+func appendFluentRecord(b []byte, event *GormEvent) []byte {
+	v := reflect.ValueOf(event).Elem()
+	b = appendMsgpackMapHeader(b, len(eventJSONFields))
+	for _, f := range eventJSONFields {
+		b = appendMsgpackString(b, f.name)
+		if t, ok := v.Field(f.index).Interface().(time.Time); ok {
+			b = appendMsgpackString(b, t.Format(time.RFC3339Nano))
+			continue
+		}
+		b = appendMsgpackValue(b, v.Field(f.index))
+	}
+	return b
+}
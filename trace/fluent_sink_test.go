@@ -0,0 +1,124 @@
+package trace
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fluentServer accepts one connection and decodes forward protocol
+// messages from it, acknowledging chunks.
+func fluentServer(t *testing.T) (net.Listener, chan []interface{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	messages := make(chan []interface{}, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		d := &MsgpackDecoder{r: bufio.NewReader(conn)}
+		for {
+			v, err := d.decodeValue()
+			if err != nil {
+				close(messages)
+				return
+			}
+			msg := v.([]interface{})
+			if option := msg[2].(map[string]interface{}); option["chunk"] != nil {
+				var ack []byte
+				ack = appendMsgpackMapHeader(ack, 1)
+				ack = appendMsgpackString(ack, "ack")
+				ack = appendMsgpackString(ack, option["chunk"].(string))
+				conn.Write(ack)
+			}
+			messages <- msg
+		}
+	}()
+	return ln, messages
+}
+
+func TestFluentSink(t *testing.T) {
+	a := require.New(t)
+	ln, messages := fluentServer(t)
+	defer ln.Close()
+
+	sink := NewFluentSink("tcp", ln.Addr().String())
+	sink.RequireAck = true
+
+	start := time.Date(2020, 8, 1, 13, 0, 0, 500, time.UTC)
+	a.NoError(sink.Write(&GormEvent{InstanceID: "a", EventType: "query", Query: "SELECT 1", StartTime: start}))
+	a.NoError(sink.Write(&GormEvent{InstanceID: "b", EventType: "create", StartTime: start}))
+	a.NoError(sink.Write(&GormEvent{InstanceID: "a", EventType: "update", StartTime: start}))
+	a.NoError(sink.Close())
+
+	var got []interface{}
+	for msg := range messages {
+		got = append(got, msg)
+	}
+	a.Len(got, 2, "one message per tag")
+
+	first := got[0].([]interface{})
+	a.Equal("gormsanity.a", first[0])
+	entries := first[1].([]interface{})
+	a.Len(entries, 2)
+
+	entry := entries[0].([]interface{})
+	a.Equal([]byte{0x5f, 0x25, 0x67, 0x50, 0, 0, 0x01, 0xf4}, entry[0], "EventTime extension")
+	event, err := decodeEventMap(entry[1].(map[string]interface{}))
+	a.NoError(err)
+	a.Equal("SELECT 1", event.Query)
+	a.True(start.Equal(event.StartTime))
+
+	a.Equal("gormsanity.b", got[1].([]interface{})[0])
+}
+
+func TestFluentSink_Tag(t *testing.T) {
+	sink := NewFluentSink("tcp", "localhost:24224")
+	sink.Tag = func(e *GormEvent) string { return "db." + e.EventType }
+	require.Equal(t, "db.query", sink.tag(&GormEvent{EventType: "query"}))
+}
+
+func TestFluentSink_ServerDown(t *testing.T) {
+	a := require.New(t)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	a.NoError(err)
+	down := ln.Addr().String()
+	ln.Close()
+
+	sink := NewFluentSink("tcp", down)
+	sink.BatchSize = 1
+	sink.MaxPending = 3
+	sink.ReconnectBackoff = time.Hour
+
+	a.Error(sink.Write(&GormEvent{EventType: "query", Query: "SELECT 1"}))
+	// Backing off, writes are buffered without dialing, dropping the
+	// oldest events beyond MaxPending.
+	for i := 2; i <= 5; i++ {
+		a.NoError(sink.Write(&GormEvent{EventType: "query", Query: fmt.Sprintf("SELECT %d", i)}))
+	}
+	a.Len(sink.pending, 3)
+	a.Equal(uint64(2), sink.Dropped())
+	a.Error(sink.Flush())
+	a.Equal(time.Hour, sink.backoff)
+
+	ln, messages := fluentServer(t)
+	defer ln.Close()
+	sink.addr = ln.Addr().String()
+	a.NoError(sink.Close(), "Close tries again regardless")
+	a.Zero(sink.backoff)
+
+	msg := <-messages
+	var queries []string
+	for _, entry := range msg[1].([]interface{}) {
+		queries = append(queries, entry.([]interface{})[1].(map[string]interface{})["query"].(string))
+	}
+	a.Equal([]string{"SELECT 3", "SELECT 4", "SELECT 5"}, queries)
+}
@@ -0,0 +1,161 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Formatter serializes an event for the stream oriented sinks (WriterSink
+// and FileSink). Each call returns one complete record including any
+// trailing newline.
+type Formatter interface {
+	Format(event *GormEvent) ([]byte, error)
+}
+
+// headerFormatter is implemented by formatters whose output starts with a
+// header, which sinks write once at the start of each stream or file.
+type headerFormatter interface {
+	Header() []byte
+}
+
+// contentTyper is implemented by formatters that know the media type of
+// their output, for sinks sending it over the network.
+type contentTyper interface {
+	ContentType() string
+}
+
+// JSONFormatter writes newline delimited JSON. It's the default.
+type JSONFormatter struct{}
+
+func (JSONFormatter) Format(event *GormEvent) ([]byte, error) {
+	bs, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	return append(bs, '\n'), nil
+}
+
+func (JSONFormatter) ContentType() string {
+	return "application/x-ndjson"
+}
+
+// DefaultCSVColumns are used when NewCSVFormatter isn't given any.
+var DefaultCSVColumns = []string{
+	"start_time",
+	"end_time",
+	"event_type",
+	"table_name",
+	"rows_affected",
+	"query",
+	"warnings",
+}
+
+// CSVFormatter writes one CSV row per event. Columns are named after the
+// event's JSON fields. Slices and maps are written as JSON.
+type CSVFormatter struct {
+	columns []string
+	fields  []int
+}
+
+// NewCSVFormatter creates a formatter writing the given columns.
+func NewCSVFormatter(columns ...string) (*CSVFormatter, error) {
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+
+	f := &CSVFormatter{columns: columns}
+	for _, c := range columns {
+		i, ok := eventFieldIndex(c)
+		if !ok {
+			return nil, fmt.Errorf("gormsanity: unknown CSV column %q", c)
+		}
+		f.fields = append(f.fields, i)
+	}
+	return f, nil
+}
+
+type eventField struct {
+	name  string
+	index int
+}
+
+// eventJSONFields lists GormEvent's serialized fields by JSON name.
+var eventJSONFields = func() []eventField {
+	var fields []eventField
+	typ := reflect.TypeOf(GormEvent{})
+	for i := 0; i < typ.NumField(); i++ {
+		name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields = append(fields, eventField{name: name, index: i})
+		}
+	}
+	return fields
+}()
+
+func eventFieldIndex(name string) (int, bool) {
+	for _, f := range eventJSONFields {
+		if f.name == name {
+			return f.index, true
+		}
+	}
+	return 0, false
+}
+
+func (f *CSVFormatter) ContentType() string {
+	return "text/csv"
+}
+
+func (f *CSVFormatter) Header() []byte {
+	bs, _ := csvRecord(f.columns)
+	return bs
+}
+
+func (f *CSVFormatter) Format(event *GormEvent) ([]byte, error) {
+	v := reflect.ValueOf(event).Elem()
+	record := make([]string, len(f.fields))
+	for i, field := range f.fields {
+		s, err := csvValue(v.Field(field))
+		if err != nil {
+			return nil, err
+		}
+		record[i] = s
+	}
+	return csvRecord(record)
+}
+
+func csvRecord(record []string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(record); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+func csvValue(v reflect.Value) (string, error) {
+	switch x := v.Interface().(type) {
+	case time.Time:
+		if x.IsZero() {
+			return "", nil
+		}
+		return x.Format(time.RFC3339Nano), nil
+	case string:
+		return x, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Struct, reflect.Ptr, reflect.Interface:
+		if (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			return "", nil
+		}
+		bs, err := json.Marshal(v.Interface())
+		return string(bs), err
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
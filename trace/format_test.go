@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVFormatter(t *testing.T) {
+	a := require.New(t)
+
+	f, err := NewCSVFormatter("start_time", "event_type", "rows_affected", "query", "warnings")
+	a.NoError(err)
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	sink.Formatter = f
+
+	a.NoError(sink.Write(&GormEvent{
+		StartTime:    time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC),
+		EventType:    "query",
+		RowsAffected: 3,
+		Query:        `SELECT * FROM "accounts"`,
+		Warnings:     []string{"no_where_clause"},
+	}))
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+
+	a.Equal(`start_time,event_type,rows_affected,query,warnings
+2020-08-01T12:00:00Z,query,3,"SELECT * FROM ""accounts""","[""no_where_clause""]"
+,create,0,,
+`, buf.String())
+}
+
+func TestCSVFormatter_UnknownColumn(t *testing.T) {
+	_, err := NewCSVFormatter("event_type", "nope")
+	require.Error(t, err)
+}
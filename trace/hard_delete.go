@@ -0,0 +1,45 @@
+package trace
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AllowHardDeleteKey is the scope setting marking an Unscoped delete of a
+// model with a DeletedAt field as intended, so it isn't flagged:
+//
+//	trace.AllowHardDelete(db).Unscoped().Delete(&expired)
+const AllowHardDeleteKey = "gormsanity:allow_hard_delete"
+
+// AllowHardDelete returns a handle of db whose deletes may bypass soft
+// deletion without being flagged, for the places that mean to.
+func AllowHardDelete(db *gorm.DB) *gorm.DB {
+	return db.Set(AllowHardDeleteKey, true)
+}
+
+// isHardDelete reports whether a delete removed the rows of a model that
+// is soft deleted, by being Unscoped, without AllowHardDelete.
+func isHardDelete(scope *gorm.Scope, softDelete bool) bool {
+	if softDelete || !scope.HasColumn("DeletedAt") {
+		return false
+	}
+	allowed, _ := scope.Get(AllowHardDeleteKey)
+	return allowed != true
+}
+
+// hardDeleteDetector flags Unscoped deletes of soft deleted models, which
+// are either rare and deliberate, and marked with AllowHardDelete, or a
+// bug.
+type hardDeleteDetector struct{}
+
+func (hardDeleteDetector) rule() string { return "hard_delete" }
+
+func (d hardDeleteDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "delete" || !e.hardDelete {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	msg := fmt.Sprintf("Unscoped delete on %s bypassed soft deletion", e.TableName)
+	return singleViolation(d.rule(), e, msg)
+}
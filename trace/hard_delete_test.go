@@ -0,0 +1,36 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_HardDelete(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	a.NoError(db.Delete(&testNote{ID: 1}).Error)
+	a.NoError(db.Unscoped().Delete(&testNote{ID: 1}).Error)
+	a.NoError(AllowHardDelete(db).Unscoped().Delete(&testNote{ID: 1}).Error)
+	a.NoError(db.Unscoped().Delete(&models.Account{Id: 1}).Error, "not soft deleted anyway")
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "hard_delete"))
+	}
+	a.Equal([]bool{false, true, false, false}, flagged)
+	a.Len(violations, 1)
+	a.Equal("hard_delete", violations[0].Rule)
+	a.Regexp(`^Unscoped delete on test_notes bypassed soft deletion at .*hard_delete_test.go:\d+$`, violations[0].Message)
+}
@@ -0,0 +1,30 @@
+package trace
+
+import "github.com/jinzhu/gorm"
+
+// Hooks are called as operations are traced, for side effects such as
+// alerting or enriching events. Either may be nil.
+type Hooks struct {
+	// OnStart is called when an operation starts, before gorm runs it. It
+	// can stop the operation by adding an error with scope.Err.
+	OnStart func(*GormEvent, *gorm.Scope)
+	// OnComplete is called when an operation completes, before its event
+	// is written.
+	OnComplete func(*GormEvent, *gorm.Scope)
+}
+
+func (t *Tracer) onStart(e *GormEvent, scope *gorm.Scope) {
+	for _, h := range t.hooks {
+		if h.OnStart != nil {
+			h.OnStart(e, scope)
+		}
+	}
+}
+
+func (t *Tracer) onComplete(e *GormEvent, scope *gorm.Scope) {
+	for _, h := range t.hooks {
+		if h.OnComplete != nil {
+			h.OnComplete(e, scope)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultHTTPTimeout bounds each request of an HTTPSink using its default
+// client.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// HTTPSink batches events and POSTs them as a JSON array to URL. When a
+// Formatter is set the body is instead the batch's formatted records
+// concatenated, e.g. a stream of MessagePack maps. Failed
+// requests are retried with exponential backoff; server errors and 429s are
+// retried, any other non-2xx response is not.
+//
+// Full batches are sent by a background goroutine, so a slow collector
+// doesn't hold up queries. While QueueSize batches are waiting to be sent
+// further ones are dropped; see Dropped. Flush sends the events written
+// since the last batch and waits for every batch queued before it. The
+// configuration fields must be set before the first event is written.
+type HTTPSink struct {
+	URL    string
+	Client *http.Client
+	Header http.Header
+
+	Formatter Formatter
+
+	// BatchSize is the number of events sent per request.
+	BatchSize int
+	// MaxRetries is the number of times a failed batch is retried.
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubling on each attempt.
+	Backoff time.Duration
+	// QueueSize is the number of full batches held while earlier ones are
+	// sent.
+	QueueSize int
+	// OnError is called from the background goroutine with the errors of
+	// full batches, which have no caller to return them to.
+	OnError func(error)
+
+	encode      func([]*GormEvent) ([]byte, error)
+	contentType string
+	dropped     uint64
+
+	mu    sync.Mutex
+	batch []*GormEvent
+
+	once    sync.Once
+	queueMu sync.RWMutex
+	closed  bool
+	queue   chan httpBatch
+	done    chan struct{}
+}
+
+type httpBatch struct {
+	events []*GormEvent
+	// sent receives the result of sending the batch, when it's a flush.
+	sent chan error
+}
+
+// NewHTTPSink creates a sink posting to url with default batching and
+// retry settings.
+func NewHTTPSink(url string) *HTTPSink {
+	return &HTTPSink{
+		URL:         url,
+		Client:      &http.Client{Timeout: DefaultHTTPTimeout},
+		Header:      http.Header{},
+		BatchSize:   100,
+		MaxRetries:  3,
+		Backoff:     100 * time.Millisecond,
+		QueueSize:   16,
+		encode:      encodeJSONBatch,
+		contentType: "application/json",
+	}
+}
+
+func encodeJSONBatch(batch []*GormEvent) ([]byte, error) {
+	return json.Marshal(batch)
+}
+
+// Dropped returns the number of events discarded because the queue of
+// batches was full.
+func (s *HTTPSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *HTTPSink) start() {
+	s.once.Do(func() {
+		s.queue = make(chan httpBatch, s.QueueSize)
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *HTTPSink) run() {
+	defer close(s.done)
+	for b := range s.queue {
+		var err error
+		if len(b.events) > 0 {
+			err = s.send(b.events)
+		}
+		switch {
+		case b.sent != nil:
+			b.sent <- err
+		case err != nil && s.OnError != nil:
+			s.OnError(err)
+		}
+	}
+}
+
+func (s *HTTPSink) Write(event *GormEvent) error {
+	s.start()
+
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.closed {
+		return errSinkClosed
+	}
+
+	s.mu.Lock()
+	s.batch = append(s.batch, event)
+	if len(s.batch) < s.BatchSize {
+		s.mu.Unlock()
+		return nil
+	}
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- httpBatch{events: batch}:
+	default:
+		atomic.AddUint64(&s.dropped, uint64(len(batch)))
+	}
+	return nil
+}
+
+func (s *HTTPSink) Flush() error {
+	s.start()
+
+	s.queueMu.RLock()
+	defer s.queueMu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	return s.flush()
+}
+
+// flush sends the pending events after the queued batches, waiting for
+// them. The caller holds queueMu.
+func (s *HTTPSink) flush() error {
+	s.mu.Lock()
+	batch := s.batch
+	s.batch = nil
+	s.mu.Unlock()
+
+	sent := make(chan error, 1)
+	s.queue <- httpBatch{events: batch, sent: sent}
+	return <-sent
+}
+
+func (s *HTTPSink) Close() error {
+	s.start()
+
+	s.queueMu.Lock()
+	if s.closed {
+		s.queueMu.Unlock()
+		return nil
+	}
+	err := s.flush()
+	s.closed = true
+	close(s.queue)
+	s.queueMu.Unlock()
+
+	<-s.done
+	return err
+}
+
+func (s *HTTPSink) send(batch []*GormEvent) error {
+	body, contentType, err := s.encodeBatch(batch)
+	if err != nil {
+		return err
+	}
+
+	backoff := s.Backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body, contentType)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= s.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (s *HTTPSink) encodeBatch(batch []*GormEvent) ([]byte, string, error) {
+	if s.Formatter == nil {
+		body, err := s.encode(batch)
+		return body, s.contentType, err
+	}
+
+	var body []byte
+	for _, e := range batch {
+		record, err := s.Formatter.Format(e)
+		if err != nil {
+			return nil, "", err
+		}
+		body = append(body, record...)
+	}
+
+	contentType := "application/octet-stream"
+	if ct, ok := s.Formatter.(contentTyper); ok {
+		contentType = ct.ContentType()
+	}
+	return body, contentType, nil
+}
+
+func (s *HTTPSink) post(body []byte, contentType string) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests:
+		return true, fmt.Errorf("gormsanity: %s responded %s", s.URL, resp.Status)
+	default:
+		return false, fmt.Errorf("gormsanity: %s responded %s", s.URL, resp.Status)
+	}
+}
@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSink_BatchesAndRetries(t *testing.T) {
+	a := require.New(t)
+
+	var (
+		mu       sync.Mutex
+		requests int
+		received [][]GormEvent
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []GormEvent
+		a.NoError(json.NewDecoder(r.Body).Decode(&batch))
+		received = append(received, batch)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL)
+	sink.BatchSize = 2
+	sink.Backoff = time.Millisecond
+
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "update"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "delete"}))
+	a.NoError(sink.Close())
+
+	a.Equal(3, requests)
+	a.Len(received, 2)
+	a.Len(received[0], 2)
+	a.Equal("delete", received[1][0].EventType)
+}
+
+func TestHTTPSink_ClientErrorIsNotRetried(t *testing.T) {
+	a := require.New(t)
+
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL)
+	sink.Backoff = time.Millisecond
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.Error(sink.Flush())
+	a.Equal(1, requests)
+}
+
+func TestHTTPSink_SendsInBackground(t *testing.T) {
+	a := require.New(t)
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL)
+	sink.BatchSize = 1
+	sink.QueueSize = 1
+
+	// The first batch is being sent and the second is queued, so the rest
+	// are dropped rather than waiting on the collector.
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	}
+	a.Less(int64(time.Since(start)), int64(time.Second))
+	a.Eventually(func() bool { return sink.Dropped() >= 3 }, time.Second, time.Millisecond)
+
+	close(release)
+	a.NoError(sink.Close())
+	a.Equal(errSinkClosed, sink.Write(&GormEvent{}))
+	a.Equal(&http.Client{Timeout: DefaultHTTPTimeout}, NewHTTPSink(srv.URL).Client)
+}
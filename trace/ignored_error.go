@@ -0,0 +1,164 @@
+package trace
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// failedScopeKey holds the ID of the event of a failed operation on the
+// handle gorm returns for it, so operations run on that handle later can
+// tell its error was never handled.
+const failedScopeKey = trackScopeKey + ":failed"
+
+// priorError is the failure of an earlier operation on the handle an
+// operation ran on.
+type priorError struct {
+	event string
+	err   string
+}
+
+// failed reports whether errs include one that isn't gorm telling a record
+// wasn't found, which callers routinely leave unchecked.
+func failed(errs []error) error {
+	for _, err := range errs {
+		if !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// markFailed records on the handle returned for a failed operation that
+// its error is pending.
+func markFailed(e *GormEvent, scope *gorm.Scope) {
+	if failed(e.Errors) != nil {
+		scope.Set(failedScopeKey, e.ID)
+	}
+}
+
+// inheritedError returns the failure of an earlier operation on the handle
+// scope was created from, or nil.
+func inheritedError(scope *gorm.Scope) *priorError {
+	id, _ := scope.Get(failedScopeKey)
+	err := failed(scope.DB().GetErrors())
+	if id == nil || err == nil {
+		return nil
+	}
+	return &priorError{event: id.(string), err: err.Error()}
+}
+
+// ignoredErrorDetector flags operation errors that aren't handled: those
+// of calls whose result is discarded, found by reading the source of the
+// caller, and those still set on the handle of a failed operation when
+// another operation is run on it.
+type ignoredErrorDetector struct {
+	mu    sync.Mutex
+	files map[string]*sourceFile
+}
+
+type sourceFile struct {
+	fset *token.FileSet
+	file *ast.File
+}
+
+func newIgnoredErrorDetector() *ignoredErrorDetector {
+	return &ignoredErrorDetector{files: map[string]*sourceFile{}}
+}
+
+func (d *ignoredErrorDetector) rule() string { return "ignored_error" }
+
+func (d *ignoredErrorDetector) observe(e *GormEvent) []*Violation {
+	var msg string
+	switch err := failed(e.Errors); {
+	case e.priorError != nil:
+		msg = fmt.Sprintf("%s on %s ran on the handle of a failed operation without its error being handled: %s", e.EventType, e.TableName, e.priorError.err)
+	case err != nil && e.ParentID == "" && d.discarded(e.Caller):
+		msg = fmt.Sprintf("%s on %s failed and its result is discarded: %v", e.EventType, e.TableName, err)
+	default:
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	violations := singleViolation(d.rule(), e, msg)
+	if e.priorError != nil {
+		violations[0].Count = 2
+		violations[0].Events = []string{e.priorError.event, e.ID}
+	}
+	return violations
+}
+
+// discarded reports whether the operation called at caller, a file:line,
+// is a statement of its own, leaving its result and error unused. It's false
+// when the source can't be read.
+func (d *ignoredErrorDetector) discarded(caller string) bool {
+	i := strings.LastIndexByte(caller, ':')
+	if i < 0 {
+		return false
+	}
+	line, err := strconv.Atoi(caller[i+1:])
+	if err != nil {
+		return false
+	}
+	src := d.source(caller[:i])
+	if src == nil {
+		return false
+	}
+
+	found := false
+	ast.Inspect(src.file, func(n ast.Node) bool {
+		if found || n == nil {
+			return false
+		}
+		if src.fset.Position(n.Pos()).Line > line || src.fset.Position(n.End()).Line < line {
+			return false
+		}
+		if stmt, ok := n.(*ast.ExprStmt); ok {
+			found = isOperationCall(stmt.X)
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// operationMethods are the methods of gorm.DB running an operation.
+var operationMethods = map[string]bool{
+	"Create": true, "Save": true, "Delete": true, "Update": true, "Updates": true,
+	"UpdateColumn": true, "UpdateColumns": true, "Find": true, "First": true,
+	"Last": true, "Take": true, "Scan": true, "Pluck": true, "Count": true,
+	"Exec": true, "FirstOrCreate": true, "FirstOrInit": true,
+}
+
+// isOperationCall reports whether x calls a method running an operation,
+// rather than passing its result to another call, like an assertion.
+func isOperationCall(x ast.Expr) bool {
+	call, ok := x.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && operationMethods[sel.Sel.Name]
+}
+
+// source parses the file at path once, remembering files that can't be
+// read as nil.
+func (d *ignoredErrorDetector) source(path string) *sourceFile {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if src, ok := d.files[path]; ok {
+		return src
+	}
+	var src *sourceFile
+	fset := token.NewFileSet()
+	if file, err := parser.ParseFile(fset, path, nil, 0); err == nil {
+		src = &sourceFile{fset, file}
+	}
+	d.files[path] = src
+	return src
+}
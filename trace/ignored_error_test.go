@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_IgnoredError(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing_table") {
+			return errors.New("relation does not exist")
+		}
+		return nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithoutRules("no_where_clause", "zero_insert_value"))
+	db.Table("missing_table").Find(&[]models.Account{})
+	a.Error(db.Table("missing_table").Find(&[]models.Account{}).Error, "checked")
+	res := db.Table("missing_table").Where("id = ?", 1).Find(&[]models.Account{})
+	a.Error(res.Where("id = ?", 2).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 3).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*GormEvent
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "ignored_error"))
+	}
+	a.Equal([]bool{true, false, false, true, false}, flagged)
+	a.Len(violations, 2)
+
+	v := violations[0].Violation
+	a.Equal("ignored_error", v.Rule)
+	a.Regexp(`^query on missing_table failed and its result is discarded: relation does not exist at .*ignored_error_test.go:\d+$`, v.Message)
+
+	v = violations[1].Violation
+	a.Contains(v.Message, "query on missing_table ran on the handle of a failed operation without its error being handled: relation does not exist")
+	a.Len(v.Events, 2)
+}
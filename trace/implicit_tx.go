@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// implicitTxDetector advises on creates of single rows made one after
+// another from the same place, each in a transaction gorm began for it,
+// as in a loop. Every one of those transactions costs a BEGIN and a
+// COMMIT, which batching the rows or wrapping the loop in one transaction
+// saves. See WithImplicitTransactionAdvice.
+type implicitTxDetector struct {
+	minRun int
+	maxGap time.Duration
+
+	mu        sync.Mutex
+	runs      map[implicitTxKey]*implicitTxRun
+	lastPrune time.Time
+}
+
+type implicitTxKey struct {
+	request, caller, table string
+}
+
+type implicitTxRun struct {
+	end      time.Time
+	total    time.Duration
+	shortest time.Duration
+	events   []string
+	flagged  bool
+}
+
+func newImplicitTxDetector(minRun int, maxGap time.Duration) *implicitTxDetector {
+	return &implicitTxDetector{minRun: minRun, maxGap: maxGap, runs: map[implicitTxKey]*implicitTxRun{}}
+}
+
+func (d *implicitTxDetector) rule() string { return "implicit_transaction" }
+
+func (d *implicitTxDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "create" || !e.implicitTx || e.ParentID != "" || e.RowsAffected > 1 || d.minRun <= 0 {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(e.StartTime)
+
+	key := implicitTxKey{e.RequestID, e.Caller, e.TableName}
+	r := d.runs[key]
+	if r == nil || e.StartTime.Sub(r.end) > d.maxGap {
+		r = &implicitTxRun{shortest: e.Duration}
+		d.runs[key] = r
+	}
+	r.end = e.EndTime
+	r.total += e.Duration
+	if e.Duration < r.shortest {
+		r.shortest = e.Duration
+	}
+	if r.flagged {
+		e.Warnings = append(e.Warnings, d.rule())
+		return nil
+	}
+	r.events = append(r.events, e.ID)
+	if len(r.events) < d.minRun {
+		return nil
+	}
+
+	r.flagged = true
+	e.Warnings = append(e.Warnings, d.rule())
+	return []*Violation{{
+		Rule: d.rule(),
+		Message: fmt.Sprintf("%d creates on %s ran in a transaction each, taking %v of which about %v was spent beginning and committing them; batch them or run them in one transaction",
+			len(r.events), e.TableName, r.total, r.overhead()),
+		Count:  len(r.events),
+		Events: r.events,
+	}}
+}
+
+// overhead estimates the time the run spent beginning and committing its
+// transactions. The quickest create is taken to be three round trips,
+// BEGIN, INSERT and COMMIT, two of which every create pays.
+func (r *implicitTxRun) overhead() time.Duration {
+	return time.Duration(len(r.events)) * 2 * r.shortest / 3
+}
+
+// prune forgets runs that have ended, at most once per gap.
+func (d *implicitTxDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.maxGap {
+		return
+	}
+	d.lastPrune = now
+	for key, r := range d.runs {
+		if now.Sub(r.end) > d.maxGap {
+			delete(d.runs, key)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_ImplicitTransaction(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithSink(sink), WithoutRules("no_where_clause", "zero_insert_value"), WithImplicitTransactionAdvice(3, time.Second),
+		WithClock(&stepClock{now: epoch, step: 3 * time.Millisecond}))
+	for i := 0; i < 4; i++ {
+		a.NoError(db.Create(&models.Account{EmailAddress: "loop@acme.com", Status: models.Status_Active}).Error)
+	}
+	// Creates in one transaction are what's advised.
+	tx := Begin(db)
+	for i := 0; i < 4; i++ {
+		a.NoError(tx.Create(&models.Account{EmailAddress: "tx@acme.com", Status: models.Status_Active}).Error)
+	}
+	a.NoError(Commit(tx).Error)
+	tracer.Close()
+
+	var violations []*GormEvent
+	var flagged []bool
+	for _, e := range sink.Events() {
+		if e.EventType == ViolationEventType {
+			violations = append(violations, e)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "implicit_transaction"))
+	}
+	a.Equal([]bool{false, false, true, true, false, false, false, false}, flagged)
+	a.Len(violations, 1)
+
+	v := violations[0].Violation
+	a.Equal("implicit_transaction", v.Rule)
+	a.Equal(3, v.Count)
+	a.Len(v.Events, 3)
+	a.True(strings.HasPrefix(v.Message, "3 creates on accounts ran in a transaction each"), v.Message)
+}
+
+func TestImplicitTxDetector_Gap(t *testing.T) {
+	a := require.New(t)
+	d := newImplicitTxDetector(2, time.Second)
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	create := func(at time.Duration, caller string) []*Violation {
+		start := epoch.Add(at)
+		return d.observe(&GormEvent{EventType: "create", TableName: "accounts", Caller: caller, implicitTx: true,
+			StartTime: start, EndTime: start.Add(3 * time.Millisecond), Duration: 3 * time.Millisecond})
+	}
+	a.Empty(create(0, "a.go:1"))
+	a.Empty(create(10*time.Millisecond, "b.go:1"), "from elsewhere")
+	a.Empty(create(2*time.Second, "a.go:1"), "too long after the first")
+	vs := create(2100*time.Millisecond, "a.go:1")
+	a.Len(vs, 1)
+	a.Contains(vs[0].Message, "taking 6ms of which about 4ms was spent beginning and committing them")
+}
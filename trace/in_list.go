@@ -0,0 +1,72 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	inList      = regexp.MustCompile(`(?i)\bIN\s*\(`)
+	placeholder = regexp.MustCompile(`^(?:\?|\$\d+)$`)
+)
+
+// inListDetector flags statements with an IN list of more than maxItems
+// items, which can exceed the planner's and driver's limits on parameters
+// and are better batched or turned into a join, see WithInListLimit.
+type inListDetector struct {
+	maxItems int
+}
+
+func (d inListDetector) rule() string { return "large_in_list" }
+
+func (d inListDetector) observe(e *GormEvent) []*Violation {
+	if e.inListItems <= d.maxItems {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	return singleViolation(d.rule(), e, fmt.Sprintf("%s on %s has an IN list of %d items, more than %d", e.EventType, e.TableName, e.inListItems, d.maxItems))
+}
+
+// largestInList returns the number of values of vars bound to the longest
+// IN list of query. gorm expands a slice given to Where into a placeholder
+// for each of its values, so those are the items counted; literals written
+// into the list aren't, nor are subqueries.
+func largestInList(query string, vars []interface{}) int {
+	query = fingerprintStrings.ReplaceAllString(query, "''")
+	largest := 0
+	for _, loc := range inList.FindAllStringIndex(query, -1) {
+		list := query[loc[1]:]
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(list)), "SELECT") {
+			continue
+		}
+		items, depth, start := 0, 0, 0
+	scan:
+		for i, c := range list {
+			switch c {
+			case '(':
+				depth++
+			case ')', ',':
+				if depth > 0 {
+					if c == ')' {
+						depth--
+					}
+					continue
+				}
+				if item := strings.TrimSpace(list[start:i]); placeholder.MatchString(item) {
+					if _, ok := bindValue(query, loc[1]+start, item, vars); ok {
+						items++
+					}
+				}
+				if c == ')' {
+					break scan
+				}
+				start = i + 1
+			}
+		}
+		if items > largest {
+			largest = items
+		}
+	}
+	return largest
+}
@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_InListLimit(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithInListLimit(3))
+	a.NoError(db.Where("id IN (?)", []int{1, 2, 3}).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id IN (?)", []int{1, 2, 3, 4}).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 3)
+	a.False(hasWarning(events[0], "large_in_list"))
+	a.True(hasWarning(events[1], "large_in_list"))
+	a.Equal("large_in_list", events[2].Violation.Rule)
+	a.Regexp(`^query on accounts has an IN list of 4 items, more than 3 at .*in_list_test.go:\d+$`, events[2].Violation.Message)
+}
+
+func TestLargestInList(t *testing.T) {
+	a := require.New(t)
+	vars := []interface{}{1, 2, 3, 4}
+	a.Equal(0, largestInList(`SELECT * FROM "accounts" WHERE id = $1`, vars))
+	a.Equal(3, largestInList(`SELECT * FROM "accounts" WHERE id IN ($1,$2,$3)`, vars))
+	a.Equal(2, largestInList(`SELECT * FROM "accounts" WHERE id in (?, ?) OR status IN ('a,?', lower(?), 'd', 'e')`, vars), "literals aren't counted")
+	a.Equal(0, largestInList(`SELECT * FROM "accounts" WHERE id IN (1, 2, 3)`, vars))
+	a.Equal(2, largestInList(`DELETE FROM accounts WHERE id IN (SELECT account_id FROM orders WHERE sku IN (?, ?))`, vars), "subqueries aren't counted")
+	a.Equal(1, largestInList(`SELECT * FROM "accounts" WHERE id IN ($4,$5)`, vars), "placeholders without values aren't counted")
+}
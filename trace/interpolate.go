@@ -0,0 +1,104 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// interpolateTokens matches placeholders, and the literals and quoted
+// identifiers that may contain text looking like them.
+var interpolateTokens = regexp.MustCompile("'(?:[^']|'')*'|\"(?:[^\"]|\"\")*\"|`[^`]*`|\\$\\d+|\\?")
+
+// Interpolate renders query with vars substituted for its placeholders,
+// quoted as literals of dialect ("postgres", "mysql", "sqlite3" and so on),
+// so it can be pasted into a database shell. It's meant for reading: the
+// values aren't escaped with the care needed to run untrusted input.
+// Placeholders without a value are left as they are.
+func Interpolate(query string, vars []interface{}, dialect string) string {
+	next := 0
+	return interpolateTokens.ReplaceAllStringFunc(query, func(token string) string {
+		i := -1
+		switch {
+		case token == "?":
+			i = next
+			next++
+		case token[0] == '$':
+			n, _ := strconv.Atoi(token[1:])
+			i = n - 1
+		}
+		if i < 0 || i >= len(vars) {
+			return token
+		}
+		return sqlLiteral(vars[i], dialect)
+	})
+}
+
+// sqlLiteral formats v as a literal of dialect.
+func sqlLiteral(v interface{}, dialect string) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		if nilPointer(v) {
+			return "NULL"
+		}
+		value, err := valuer.Value()
+		if err != nil {
+			return "NULL"
+		}
+		v = value
+	}
+
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if dialect == "postgres" {
+			return strings.ToUpper(strconv.FormatBool(v))
+		}
+		if v {
+			return "1"
+		}
+		return "0"
+	case string:
+		return quoteString(v, dialect)
+	case []byte:
+		if dialect == "postgres" {
+			return `'\x` + hex.EncodeToString(v) + `'`
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		if dialect == "mysql" {
+			return quoteString(v.Format("2006-01-02 15:04:05.999999"), dialect)
+		}
+		return quoteString(v.Format("2006-01-02 15:04:05.999999-07:00"), dialect)
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "NULL"
+		}
+		return sqlLiteral(rv.Elem().Interface(), dialect)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v)
+	case reflect.Bool:
+		return sqlLiteral(rv.Bool(), dialect)
+	case reflect.String:
+		return quoteString(rv.String(), dialect)
+	}
+	return quoteString(fmt.Sprint(v), dialect)
+}
+
+func quoteString(s, dialect string) string {
+	if dialect == "mysql" {
+		s = strings.Replace(s, `\`, `\\`, -1)
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
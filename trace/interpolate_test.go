@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestInterpolate(t *testing.T) {
+	a := require.New(t)
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	a.Equal(
+		`SELECT * FROM "accounts" WHERE (status = 'active' AND nick_name = 'O''Brien' AND id IN (1,2)) AND note = '$1' AND "deleted_at" IS NULL AND created_at > '2020-01-02 03:04:05+00:00' AND admin = TRUE`,
+		Interpolate(`SELECT * FROM "accounts" WHERE (status = $1 AND nick_name = $2 AND id IN ($3,$4)) AND note = '$1' AND "deleted_at" IS NULL AND created_at > $5 AND admin = $6`,
+			[]interface{}{"active", "O'Brien", 1, int64(2), at, true}, "postgres"))
+
+	a.Equal(
+		"INSERT INTO `accounts` (`email`,`data`,`admin`,`nick`) VALUES ('a\\\\b','?',X'cafe',0,NULL)",
+		Interpolate("INSERT INTO `accounts` (`email`,`data`,`admin`,`nick`) VALUES (?,'?',?,?,?)",
+			[]interface{}{`a\b`, []byte{0xca, 0xfe}, false, (*string)(nil)}, "mysql"))
+
+	a.Equal("UPDATE accounts SET email = NULL, nick = 'jo'",
+		Interpolate("UPDATE accounts SET email = ?, nick = ?",
+			[]interface{}{(*sql.NullString)(nil), &sql.NullString{String: "jo", Valid: true}}, "mysql"))
+
+	// Placeholders without values are kept.
+	a.Equal("SELECT $1", Interpolate("SELECT $1", nil, "postgres"))
+}
+
+func TestTracer_InterpolatedSQL(t *testing.T) {
+	a := require.New(t)
+
+	find := func(opts ...Option) string {
+		db, _ := openFakeDB(t)
+		sink := &memorySink{}
+		db, tracer := TraceDB(db, append(opts, WithSink(sink))...)
+		a.NoError(db.Where("email_address = ? AND id > ?", "o'neil@acme.com", 10).Find(&[]models.Account{}).Error)
+		tracer.Close()
+		return sink.Events()[0].Interpolated
+	}
+
+	a.Equal(`SELECT * FROM "accounts"  WHERE (email_address = 'o''neil@acme.com' AND id > 10)`, find(WithInterpolatedSQL()))
+	a.Empty(find())
+	a.Empty(find(WithInterpolatedSQL(), WithRedactedVars()))
+}
+
+func TestTracer_InterpolatedSQL_NilValuer(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithInterpolatedSQL())
+	a.NoError(db.Save(&nullableAccount{ID: 1}).Error)
+	tracer.Close()
+
+	a.Equal(`UPDATE "accounts" SET "email_address" = NULL  WHERE "accounts"."id" = 1`, sink.Events()[0].Interpolated)
+}
@@ -0,0 +1,209 @@
+package trace
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// KafkaMessage is a single record handed to a KafkaProducer.
+type KafkaMessage struct {
+	Topic string
+	Key   []byte
+	Value []byte
+}
+
+// KafkaProducer publishes a batch of messages. It's implemented by adapting
+// whichever Kafka client the application already uses, which keeps the
+// client library out of gormsanity's dependencies.
+type KafkaProducer interface {
+	Produce(messages []KafkaMessage) error
+}
+
+// KafkaSink publishes each event to Topic, as JSON unless a Formatter is
+// set. Events are queued and handed to the producer in batches of
+// BatchSize or every FlushInterval, whichever comes first, a second when
+// it isn't positive. When the queue is full events are dropped rather than
+// blocking the query; see Dropped. The configuration fields must be set
+// before the first event is written.
+type KafkaSink struct {
+	Topic string
+	// Key derives the message key from an event, such as
+	// KafkaKeyByFingerprint. Defaults to KafkaKeyByInstanceID.
+	Key           func(*GormEvent) []byte
+	Formatter     Formatter
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize is the number of events held for the producer, at least
+	// BatchSize.
+	QueueSize int
+	// OnDeliveryError is called with the messages of a batch the producer
+	// failed to publish.
+	OnDeliveryError func(messages []KafkaMessage, err error)
+
+	producer KafkaProducer
+	dropped  uint64
+
+	once   sync.Once
+	mu     sync.RWMutex
+	closed bool
+	queue  chan kafkaOp
+	done   chan struct{}
+}
+
+type kafkaOp struct {
+	msg     KafkaMessage
+	flushed chan struct{}
+}
+
+// NewKafkaSink creates a sink publishing to topic through producer.
+func NewKafkaSink(producer KafkaProducer, topic string) *KafkaSink {
+	return &KafkaSink{
+		Topic:         topic,
+		Key:           KafkaKeyByInstanceID,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		QueueSize:     1024,
+		producer:      producer,
+	}
+}
+
+// KafkaKeyByInstanceID keys messages by the GORM instance that issued them.
+func KafkaKeyByInstanceID(event *GormEvent) []byte {
+	return []byte(event.InstanceID)
+}
+
+// KafkaKeyByFingerprint keys messages by the shape of their query, see
+// Fingerprint, so the events of each query land on the same partition.
+func KafkaKeyByFingerprint(event *GormEvent) []byte {
+	return []byte(event.Fingerprint)
+}
+
+// Dropped returns the number of events discarded because the queue was
+// full.
+func (s *KafkaSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *KafkaSink) start() {
+	s.once.Do(func() {
+		size := s.QueueSize
+		if size < s.BatchSize {
+			size = s.BatchSize
+		}
+		s.queue = make(chan kafkaOp, size)
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *KafkaSink) run() {
+	defer close(s.done)
+
+	interval := s.FlushInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var batch []KafkaMessage
+	for {
+		select {
+		case op, ok := <-s.queue:
+			if !ok {
+				s.produce(batch)
+				return
+			}
+			if op.flushed != nil {
+				s.produce(batch)
+				batch = nil
+				close(op.flushed)
+				continue
+			}
+			batch = append(batch, op.msg)
+			if len(batch) >= s.BatchSize {
+				s.produce(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			s.produce(batch)
+			batch = nil
+		}
+	}
+}
+
+func (s *KafkaSink) produce(batch []KafkaMessage) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.producer.Produce(batch); err != nil && s.OnDeliveryError != nil {
+		s.OnDeliveryError(batch, err)
+	}
+}
+
+func (s *KafkaSink) Write(event *GormEvent) error {
+	value, err := s.encode(event)
+	if err != nil {
+		return err
+	}
+
+	s.start()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return errSinkClosed
+	}
+
+	key := s.Key
+	if key == nil {
+		key = KafkaKeyByInstanceID
+	}
+	select {
+	case s.queue <- kafkaOp{msg: KafkaMessage{Topic: s.Topic, Key: key(event), Value: value}}:
+	default:
+		atomic.AddUint64(&s.dropped, 1)
+	}
+	return nil
+}
+
+func (s *KafkaSink) encode(event *GormEvent) ([]byte, error) {
+	if s.Formatter != nil {
+		return s.Formatter.Format(event)
+	}
+	return json.Marshal(event)
+}
+
+// Flush blocks until every queued event has been handed to the producer.
+func (s *KafkaSink) Flush() error {
+	s.start()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+
+	flushed := make(chan struct{})
+	s.queue <- kafkaOp{flushed: flushed}
+	<-flushed
+	return nil
+}
+
+func (s *KafkaSink) Close() error {
+	s.start()
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+
+	<-s.done
+	return nil
+}
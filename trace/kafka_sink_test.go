@@ -0,0 +1,113 @@
+package trace
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type fakeProducer struct {
+	mu      sync.Mutex
+	batches [][]KafkaMessage
+	err     error
+}
+
+func (p *fakeProducer) Produce(messages []KafkaMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.batches = append(p.batches, messages)
+	return p.err
+}
+
+func TestKafkaSink(t *testing.T) {
+	a := require.New(t)
+	producer := &fakeProducer{}
+
+	sink := NewKafkaSink(producer, "gorm-events")
+	sink.BatchSize = 2
+	sink.FlushInterval = time.Hour
+
+	a.NoError(sink.Write(&GormEvent{EventType: "create", InstanceID: "a"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "update", InstanceID: "b"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "delete", InstanceID: "c"}))
+	a.NoError(sink.Close())
+	a.Error(sink.Write(&GormEvent{}))
+
+	a.Len(producer.batches, 2)
+	a.Len(producer.batches[0], 2)
+	a.Equal("gorm-events", producer.batches[0][0].Topic)
+	a.Equal([]byte("a"), producer.batches[0][0].Key)
+	a.Equal([]byte("c"), producer.batches[1][0].Key)
+}
+
+func TestKafkaSink_Key(t *testing.T) {
+	a := require.New(t)
+
+	for _, tc := range []struct {
+		key  func(*GormEvent) []byte
+		want string
+	}{
+		{KafkaKeyByFingerprint, "35f9cb54e46ccf71"},
+		// Without a key function messages are keyed by instance.
+		{nil, "a"},
+	} {
+		producer := &fakeProducer{}
+		sink := NewKafkaSink(producer, "gorm-events")
+		sink.Key = tc.key
+		a.NoError(sink.Write(&GormEvent{InstanceID: "a", Fingerprint: "35f9cb54e46ccf71"}))
+		a.NoError(sink.Close())
+
+		a.Len(producer.batches, 1)
+		a.Equal([]byte(tc.want), producer.batches[0][0].Key)
+	}
+}
+
+func TestKafkaSink_DeliveryError(t *testing.T) {
+	a := require.New(t)
+	producer := &fakeProducer{err: errors.New("broker down")}
+
+	var failed []KafkaMessage
+	sink := NewKafkaSink(producer, "gorm-events")
+	sink.OnDeliveryError = func(messages []KafkaMessage, err error) {
+		failed = append(failed, messages...)
+	}
+
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.NoError(sink.Flush())
+	a.Len(failed, 1)
+	a.NoError(sink.Close())
+}
+
+type blockingProducer struct {
+	release chan struct{}
+}
+
+func (p blockingProducer) Produce(messages []KafkaMessage) error {
+	<-p.release
+	return nil
+}
+
+func TestKafkaSink_FullQueue(t *testing.T) {
+	a := require.New(t)
+	producer := blockingProducer{release: make(chan struct{})}
+
+	sink := NewKafkaSink(producer, "gorm-events")
+	sink.BatchSize = 1
+	sink.QueueSize = 1
+	sink.FlushInterval = 0
+
+	// The first event is stuck with the producer and the second fills the
+	// queue, so the rest are dropped rather than blocking.
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.Eventually(func() bool { return len(sink.queue) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	}
+	a.Equal(uint64(3), sink.Dropped())
+
+	close(producer.release)
+	a.NoError(sink.Close())
+}
@@ -0,0 +1,79 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// rowsWatcher checks that the *sql.Rows returned by Rows are closed within
+// window of the query, see WithLeakedRowsDetection. Each open cursor holds
+// a connection, so leaked ones exhaust the pool.
+type rowsWatcher struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	timers  map[string]*time.Timer
+	stopped bool
+}
+
+func newRowsWatcher(window time.Duration) *rowsWatcher {
+	return &rowsWatcher{window: window, timers: map[string]*time.Timer{}}
+}
+
+func (w *rowsWatcher) rule() string { return "leaked_rows" }
+
+// watchRows checks, once the window has passed, that the rows returned for
+// the row query e are closed, reporting them as leaked otherwise.
+func (t *Tracer) watchRows(e *GormEvent, scope *gorm.Scope) {
+	w := t.leakedRows
+	if w == nil || e.EventType != "row_query" {
+		return
+	}
+	result, _ := scope.InstanceGet("row_query_result")
+	rows, ok := result.(*gorm.RowsQueryResult)
+	if !ok || rows.Rows == nil {
+		return
+	}
+
+	trigger := *e
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	w.timers[trigger.ID] = time.AfterFunc(w.window, func() {
+		w.mu.Lock()
+		delete(w.timers, trigger.ID)
+		w.mu.Unlock()
+
+		// Columns fails once the rows are closed, which they are too
+		// when they've been read to the end.
+		if _, err := rows.Rows.Columns(); err != nil {
+			return
+		}
+		msg := fmt.Sprintf("rows of a query on %s were still open %v after it ran", trigger.TableName, w.window)
+		if trigger.Caller != "" {
+			msg += ", opened at " + trigger.Caller
+		}
+		t.reportViolation(&trigger, &Violation{
+			Rule:    w.rule(),
+			Message: msg,
+			Count:   1,
+			Events:  []string{trigger.ID},
+		})
+	})
+}
+
+// stop abandons the checks yet to run.
+func (w *rowsWatcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for id, timer := range w.timers {
+		timer.Stop()
+		delete(w.timers, id)
+	}
+}
@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_LeakedRows(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}}
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithLeakedRowsDetection(10*time.Millisecond))
+	closed, err := db.Model(&models.Account{}).Where("id = ?", 1).Rows()
+	a.NoError(err)
+	a.NoError(closed.Close())
+	drained, err := db.Model(&models.Account{}).Where("id = ?", 2).Rows()
+	a.NoError(err)
+	for drained.Next() {
+	}
+	leaked, err := db.Model(&models.Account{}).Where("id = ?", 3).Rows()
+	a.NoError(err)
+
+	violations := func() []*GormEvent {
+		var violations []*GormEvent
+		for _, e := range sink.Events() {
+			if e.Violation != nil {
+				violations = append(violations, e)
+			}
+		}
+		return violations
+	}
+	a.Eventually(func() bool { return len(violations()) > 0 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	tracer.Close()
+	a.NoError(leaked.Close())
+
+	vs := violations()
+	a.Len(vs, 1)
+	a.Equal("leaked_rows", vs[0].Violation.Rule)
+	a.Equal([]interface{}{3}, vs[0].SQLVars)
+	a.Regexp(`^rows of a query on accounts were still open 10ms after it ran, opened at .*leaked_rows_test.go:\d+$`, vs[0].Violation.Message)
+}
@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var likePattern = regexp.MustCompile(`(?i)\bI?LIKE\s+('(?:[^']|'')*'|\$\d+|\?)`)
+
+// leadingWildcardDetector flags LIKE patterns starting with a wildcard,
+// which no ordinary index can answer, so every row is read, see
+// WithLeadingWildcardDetection.
+type leadingWildcardDetector struct{}
+
+func (leadingWildcardDetector) rule() string { return "leading_wildcard" }
+
+func (d leadingWildcardDetector) observe(e *GormEvent) []*Violation {
+	if !e.leadingWildcard {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	msg := fmt.Sprintf("LIKE pattern starting with a wildcard on %s can't use an index; a trigram index or full-text search can", e.TableName)
+	return singleViolation(d.rule(), e, msg)
+}
+
+// hasLeadingWildcard reports whether query has a LIKE or ILIKE pattern
+// starting with % or _, given in the SQL or as one of its vars.
+func hasLeadingWildcard(query string, vars []interface{}) bool {
+	for _, m := range likePattern.FindAllStringSubmatchIndex(query, -1) {
+		operand := query[m[2]:m[3]]
+		var pattern string
+		switch {
+		case strings.HasPrefix(operand, "'"):
+			pattern = operand[1:]
+		case strings.HasPrefix(operand, "$"):
+			n, _ := strconv.Atoi(operand[1:])
+			if n < 1 || n > len(vars) {
+				continue
+			}
+			pattern, _ = vars[n-1].(string)
+		default:
+			// Count the placeholders before this one, outside literals.
+			n := strings.Count(fingerprintStrings.ReplaceAllString(query[:m[2]], "''"), "?")
+			if n >= len(vars) {
+				continue
+			}
+			pattern, _ = vars[n].(string)
+		}
+		if strings.HasPrefix(pattern, "%") || strings.HasPrefix(pattern, "_") {
+			return true
+		}
+	}
+	return false
+}
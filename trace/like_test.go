@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_LeadingWildcard(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithLeadingWildcardDetection())
+	a.NoError(db.Where("email_address LIKE ?", "%@acme.com").Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("email_address LIKE ?", "jane%").Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 3)
+	a.True(hasWarning(events[0], "leading_wildcard"))
+	a.Equal("leading_wildcard", events[1].Violation.Rule)
+	a.Regexp(`^LIKE pattern starting with a wildcard on accounts can't use an index; a trigram index or full-text search can at .*like_test.go:\d+$`, events[1].Violation.Message)
+	a.False(hasWarning(events[2], "leading_wildcard"))
+}
+
+func TestHasLeadingWildcard(t *testing.T) {
+	a := require.New(t)
+	a.True(hasLeadingWildcard(`SELECT * FROM accounts WHERE name LIKE '%son'`, nil))
+	a.True(hasLeadingWildcard(`SELECT * FROM accounts WHERE name ILIKE '_ohn'`, nil))
+	a.False(hasLeadingWildcard(`SELECT * FROM accounts WHERE name LIKE 'jo%'`, nil))
+	a.True(hasLeadingWildcard(`SELECT * FROM accounts WHERE id = $1 AND name NOT LIKE $2`, []interface{}{1, "%x"}))
+	a.False(hasLeadingWildcard(`SELECT * FROM accounts WHERE name LIKE $2`, []interface{}{"%x", "x%"}))
+	a.True(hasLeadingWildcard(`SELECT * FROM accounts WHERE note = '?' AND id = ? AND name LIKE ?`, []interface{}{1, "%x"}))
+	a.False(hasLeadingWildcard(`SELECT * FROM accounts WHERE name LIKE ?`, nil), "values unknown")
+}
@@ -0,0 +1,149 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// staleTransaction is how long a transaction begun with Begin may go
+// without statements before it's assumed to have ended without Commit or
+// Rollback, and is forgotten.
+const staleTransaction = time.Hour
+
+// longTxDetector flags transactions held open longer than maxDuration or
+// running more than maxStatements statements, which hold locks and
+// connections meanwhile. Transactions are judged when they end: when
+// Commit or Rollback is called for those begun with Begin, and when the
+// operation completes for those gorm begins itself.
+type longTxDetector struct {
+	maxDuration   time.Duration
+	maxStatements int
+
+	mu        sync.Mutex
+	txs       map[string]*openTx
+	lastPrune time.Time
+}
+
+type openTx struct {
+	start    time.Time
+	explicit bool
+	events   []string
+	last     *GormEvent
+}
+
+func newLongTxDetector(maxDuration time.Duration, maxStatements int) *longTxDetector {
+	return &longTxDetector{
+		maxDuration:   maxDuration,
+		maxStatements: maxStatements,
+		txs:           map[string]*openTx{},
+	}
+}
+
+func (d *longTxDetector) rule() string { return "long_transaction" }
+
+// begin records the start of a transaction begun with Begin.
+func (d *longTxDetector) begin(id string, at time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txs[id] = &openTx{start: at, explicit: true}
+}
+
+func (d *longTxDetector) observe(e *GormEvent) []*Violation {
+	if e.TransactionID == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(e.StartTime)
+
+	tx := d.txs[e.TransactionID]
+	if tx == nil {
+		tx = &openTx{start: e.StartTime}
+		d.txs[e.TransactionID] = tx
+	}
+	tx.events = append(tx.events, e.ID)
+	tx.last = e
+
+	// Statements gorm runs on behalf of an operation, such as saving its
+	// associations, complete before it does, so the transaction gorm
+	// began for an operation ends with it.
+	if !tx.explicit && e.ParentID == "" {
+		delete(d.txs, e.TransactionID)
+		if v := d.judge(e.TransactionID, tx, e.EndTime); v != nil {
+			e.Warnings = append(e.Warnings, d.rule())
+			return []*Violation{v}
+		}
+	}
+	return nil
+}
+
+// end forgets the transaction id, returning its violation, if any, and
+// the last of its events.
+func (d *longTxDetector) end(id string, at time.Time) (*Violation, *GormEvent) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	tx, ok := d.txs[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(d.txs, id)
+	return d.judge(id, tx, at), tx.last
+}
+
+func (d *longTxDetector) judge(id string, tx *openTx, end time.Time) *Violation {
+	var reasons []string
+	elapsed := end.Sub(tx.start)
+	if d.maxDuration > 0 && elapsed > d.maxDuration {
+		reasons = append(reasons, fmt.Sprintf("open for %v, longer than %v", elapsed, d.maxDuration))
+	}
+	if d.maxStatements > 0 && len(tx.events) > d.maxStatements {
+		reasons = append(reasons, fmt.Sprintf("ran %d statements, more than %d", len(tx.events), d.maxStatements))
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	return &Violation{
+		Rule:    d.rule(),
+		Message: fmt.Sprintf("transaction %s was %s", id, strings.Join(reasons, " and ")),
+		Count:   len(tx.events),
+		Events:  tx.events,
+	}
+}
+
+// prune forgets transactions begun with Begin that have gone stale,
+// presumably ended without Commit or Rollback.
+func (d *longTxDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < staleTransaction {
+		return
+	}
+	d.lastPrune = now
+	for id, tx := range d.txs {
+		last := tx.start
+		if tx.last != nil {
+			last = tx.last.EndTime
+		}
+		if now.Sub(last) > staleTransaction {
+			delete(d.txs, id)
+		}
+	}
+}
+
+// endTransaction judges the transaction id when Commit or Rollback is
+// called, writing its violation, if any.
+func (t *Tracer) endTransaction(id string) {
+	if t.longTx == nil {
+		return
+	}
+	now := t.clock.Now()
+	v, last := t.longTx.end(id, now)
+	if v == nil {
+		return
+	}
+	if last == nil {
+		last = &GormEvent{TransactionID: id, StartTime: now, EndTime: now}
+	}
+	t.reportViolation(last, v)
+}
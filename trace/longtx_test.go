@@ -0,0 +1,69 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_LongTransaction(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithSink(sink), WithLongTransactionDetection(0, 2),
+		WithClock(&stepClock{now: epoch, step: time.Millisecond}))
+	short := Begin(db)
+	a.NoError(short.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(Commit(short).Error)
+	long := Begin(db)
+	for i := 0; i < 3; i++ {
+		a.NoError(long.Where("id = ?", i).Find(&[]models.Account{}).Error)
+	}
+	a.NoError(Rollback(long).Error)
+	// gorm's own transaction for a write covers the writes of its
+	// associations.
+	a.NoError(db.Create(&testOrder{Lines: []testOrderLine{{SKU: "a"}, {SKU: "b"}}}).Error)
+	tracer.Close()
+
+	var violations []*GormEvent
+	for _, e := range sink.Events() {
+		if e.EventType == ViolationEventType {
+			violations = append(violations, e)
+		}
+	}
+	a.Len(violations, 2)
+
+	v := violations[0]
+	a.Equal("long_transaction", v.Violation.Rule)
+	a.Equal(3, v.Violation.Count)
+	a.Len(v.Violation.Events, 3)
+	a.NotEmpty(v.TransactionID)
+	a.Contains(v.Violation.Message, "ran 3 statements, more than 2")
+
+	v = violations[1]
+	a.Equal(3, v.Violation.Count)
+	a.Equal("test_orders", v.TableName, "the operation that began the transaction")
+}
+
+func TestLongTxDetector_Duration(t *testing.T) {
+	a := require.New(t)
+	d := newLongTxDetector(time.Second, 0)
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	d.begin("tx", epoch)
+	a.Empty(d.observe(&GormEvent{ID: "1", EventType: "query", TransactionID: "tx", StartTime: epoch, EndTime: epoch}))
+	v, last := d.end("tx", epoch.Add(2*time.Second))
+	a.NotNil(v)
+	a.Equal("1", last.ID)
+	a.Equal([]string{"1"}, v.Events)
+	a.Contains(v.Message, "open for 2s, longer than 1s")
+
+	v, _ = d.end("tx", epoch.Add(3*time.Second))
+	a.Nil(v, "ended already")
+	a.Empty(d.txs)
+}
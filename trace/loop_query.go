@@ -0,0 +1,153 @@
+package trace
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// loopQueryDetector flags the same query issued from the same place in
+// quick succession with values that keep rising or falling, such as
+// consecutive IDs, the mark of a loop fetching one record at a time that
+// a single query could replace. See WithLoopQueryDetection.
+type loopQueryDetector struct {
+	minRun int
+	maxGap time.Duration
+
+	mu        sync.Mutex
+	runs      map[loopQueryKey]*loopQueryRun
+	lastPrune time.Time
+}
+
+type loopQueryKey struct {
+	caller, fingerprint string
+}
+
+type loopQueryRun struct {
+	end  time.Time
+	last string
+	args []float64
+	// trends are the directions the numeric arguments, by position, have
+	// moved in at every step of the run so far.
+	trends  map[int]float64
+	events  []string
+	flagged bool
+}
+
+func newLoopQueryDetector(minRun int, maxGap time.Duration) *loopQueryDetector {
+	return &loopQueryDetector{minRun: minRun, maxGap: maxGap, runs: map[loopQueryKey]*loopQueryRun{}}
+}
+
+func (d *loopQueryDetector) rule() string { return "loop_query" }
+
+func (d *loopQueryDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" && e.EventType != "row_query" || e.Caller == "" || e.Fingerprint == "" || d.minRun <= 1 {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(e.StartTime)
+
+	key := loopQueryKey{e.Caller, e.Fingerprint}
+	r := d.runs[key]
+	if r != nil && !r.extend(e, d.maxGap) {
+		// A new run may start from the last query of the one ended.
+		r = &loopQueryRun{end: r.end, args: r.args, events: []string{r.last}}
+		if !r.extend(e, d.maxGap) {
+			r = nil
+		}
+	}
+	if r == nil {
+		r = &loopQueryRun{args: e.numericArgs}
+	}
+	d.runs[key] = r
+	r.end = e.EndTime
+	r.last = e.ID
+	if r.flagged {
+		e.Warnings = append(e.Warnings, d.rule())
+		return nil
+	}
+	r.events = append(r.events, e.ID)
+	if len(r.events) < d.minRun {
+		return nil
+	}
+
+	r.flagged = true
+	e.Warnings = append(e.Warnings, d.rule())
+	return []*Violation{{
+		Rule:    d.rule(),
+		Message: fmt.Sprintf("probable loop: the same query on %s ran %d times at %s with steadily changing values; fetch the records at once, such as with IN", e.TableName, len(r.events), e.Caller),
+		Count:   len(r.events),
+		Events:  r.events,
+	}}
+}
+
+// extend reports whether e carries on the run, starting within maxGap of
+// its end with arguments continuing at least one of its trends, and
+// narrows its trends to those e continues.
+func (r *loopQueryRun) extend(e *GormEvent, maxGap time.Duration) bool {
+	if e.StartTime.Sub(r.end) > maxGap || len(e.numericArgs) != len(r.args) {
+		return false
+	}
+	trends := map[int]float64{}
+	for i, v := range e.numericArgs {
+		step := sign(v - r.args[i])
+		if step == 0 || math.IsNaN(step) {
+			continue
+		}
+		if trend, ok := r.trends[i]; r.trends == nil || ok && trend == step {
+			trends[i] = step
+		}
+	}
+	if len(trends) == 0 {
+		return false
+	}
+	r.trends = trends
+	r.args = e.numericArgs
+	return true
+}
+
+func sign(x float64) float64 {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return x
+}
+
+// prune forgets runs that have ended, at most once per gap.
+func (d *loopQueryDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.maxGap {
+		return
+	}
+	d.lastPrune = now
+	for key, r := range d.runs {
+		if now.Sub(r.end) > d.maxGap {
+			delete(d.runs, key)
+		}
+	}
+}
+
+// numericArgs returns the values of a statement's numeric arguments, and
+// NaN for the others.
+func numericArgs(vars []interface{}) []float64 {
+	args := make([]float64, len(vars))
+	for i, v := range vars {
+		args[i] = math.NaN()
+		rv := elem(reflect.ValueOf(v))
+		switch rv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			args[i] = float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			args[i] = float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			args[i] = rv.Float()
+		}
+	}
+	return args
+}
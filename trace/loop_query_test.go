@@ -0,0 +1,64 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_LoopQuery(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithSink(sink), WithLoopQueryDetection(3, 10*time.Millisecond),
+		WithoutRules("n_plus_one"), WithClock(&stepClock{now: epoch, step: time.Millisecond}))
+	for _, id := range []int{7, 3, 9} {
+		a.NoError(db.Where("id = ?", id).Find(&[]models.Account{}).Error)
+	}
+	for id := 1; id <= 4; id++ {
+		a.NoError(db.Where("id = ?", id).Find(&[]models.Account{}).Error)
+	}
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "loop_query"))
+	}
+	a.Equal([]bool{false, false, false, false, false, true, true}, flagged)
+	a.Len(violations, 1)
+	a.Equal("loop_query", violations[0].Rule)
+	a.Equal(3, violations[0].Count)
+	a.Contains(violations[0].Message, "probable loop: the same query on accounts ran 3 times at ")
+}
+
+func TestLoopQueryDetector_Trends(t *testing.T) {
+	a := require.New(t)
+	d := newLoopQueryDetector(3, time.Second)
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	query := func(at time.Duration, args ...interface{}) []*Violation {
+		start := epoch.Add(at)
+		return d.observe(&GormEvent{EventType: "query", Caller: "a.go:1", Fingerprint: "f",
+			StartTime: start, EndTime: start, numericArgs: numericArgs(args)})
+	}
+	// The second argument falls steadily while the first wanders.
+	a.Empty(query(0, 5, "x", 30))
+	a.Empty(query(time.Millisecond, 6, "x", 20))
+	a.Len(query(2*time.Millisecond, 4, "y", 10), 1)
+
+	a.Empty(query(5*time.Second, 1, "x", 1), "the gap ends the run")
+	a.Empty(query(5*time.Second, 1, "x", 1), "nothing changed")
+	a.Empty(query(5*time.Second, 2, "x", 2))
+	a.Empty(query(5*time.Second, 1, "x", 1), "a run may start from the last query of another")
+	a.Len(query(5*time.Second, 0, "x", 0), 1)
+}
@@ -0,0 +1,138 @@
+package trace
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDurationBuckets are the upper bounds of the duration histograms
+// kept by Tracer.Metrics.
+var DefaultDurationBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Metrics aggregates the operations a tracer has seen, keyed by event type
+// and table. Unlike events they include every operation, regardless of
+// sampling and filtering.
+type Metrics struct {
+	Operations []OperationMetrics
+}
+
+// OperationMetrics aggregates one event type on one table.
+type OperationMetrics struct {
+	EventType    string
+	TableName    string
+	Count        uint64
+	Errors       uint64
+	Warnings     uint64
+	RowsAffected int64
+	Duration     Histogram
+}
+
+// Histogram counts durations into buckets. Counts[i] is the number of
+// durations no longer than Bounds[i], excluding those counted in earlier
+// buckets, and the last count is for those longer than every bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Sum    time.Duration
+}
+
+// Count returns the number of durations observed.
+func (h Histogram) Count() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+	h.Sum += d
+}
+
+type metricsKey struct {
+	eventType, table string
+}
+
+type metricsRecorder struct {
+	mu  sync.Mutex
+	ops map[metricsKey]*OperationMetrics
+}
+
+func (r *metricsRecorder) record(e *GormEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := metricsKey{e.EventType, e.TableName}
+	m, ok := r.ops[key]
+	if !ok {
+		if r.ops == nil {
+			r.ops = map[metricsKey]*OperationMetrics{}
+		}
+		m = &OperationMetrics{
+			EventType: e.EventType,
+			TableName: e.TableName,
+			Duration: Histogram{
+				Bounds: DefaultDurationBuckets,
+				Counts: make([]uint64, len(DefaultDurationBuckets)+1),
+			},
+		}
+		r.ops[key] = m
+	}
+
+	m.Count++
+	if len(e.Errors) > 0 {
+		m.Errors++
+	}
+	if len(e.Warnings) > 0 {
+		m.Warnings++
+	}
+	m.RowsAffected += e.RowsAffected
+	m.Duration.observe(e.Duration)
+}
+
+func (r *metricsRecorder) snapshot() Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var metrics Metrics
+	for _, m := range r.ops {
+		op := *m
+		op.Duration.Counts = append([]uint64(nil), m.Duration.Counts...)
+		metrics.Operations = append(metrics.Operations, op)
+	}
+	sort.Slice(metrics.Operations, func(i, j int) bool {
+		a, b := metrics.Operations[i], metrics.Operations[j]
+		if a.EventType != b.EventType {
+			return a.EventType < b.EventType
+		}
+		return a.TableName < b.TableName
+	})
+	return metrics
+}
+
+// Metrics returns the aggregates of the operations completed so far.
+func (t *Tracer) Metrics() Metrics {
+	return t.metrics.snapshot()
+}
+
+// nopSink stands in for a sink when events are only aggregated, see
+// WithMetricsOnly.
+type nopSink struct{}
+
+func (nopSink) Write(*GormEvent) error { return nil }
+func (nopSink) Flush() error           { return nil }
+func (nopSink) Close() error           { return nil }
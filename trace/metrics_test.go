@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTraceDB_WithMetricsOnly(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.rowsAffected = 1
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing") {
+			return errors.New("column does not exist")
+		}
+		return nil
+	}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithMetricsOnly(), WithClock(&stepClock{now: epoch, step: 20 * time.Millisecond}))
+	a.NoError(db.Create(&models.Account{EmailAddress: "metrics@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.Error(db.Where("missing = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	metrics := tracer.Metrics()
+	a.Len(metrics.Operations, 2)
+
+	create := metrics.Operations[0]
+	a.Equal("create", create.EventType)
+	a.Equal("accounts", create.TableName)
+	a.Equal(uint64(1), create.Count)
+	a.Equal(int64(1), create.RowsAffected)
+	a.Equal(uint64(1), create.Warnings, "zero_insert_value")
+
+	query := metrics.Operations[1]
+	a.Equal("query", query.EventType)
+	a.Equal(uint64(2), query.Count)
+	a.Equal(uint64(1), query.Errors)
+	a.Equal(uint64(2), query.Duration.Count())
+	a.Equal(uint64(2), query.Duration.Counts[3], "20ms falls in the 25ms bucket")
+	a.Equal(40*time.Millisecond, query.Duration.Sum)
+
+	a.Equal(TracerStats{}, tracer.Stats(), "nothing is written")
+}
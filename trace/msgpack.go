@@ -0,0 +1,499 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MsgpackFormatter writes each event as a MessagePack map keyed by the
+// event's JSON field names. Timestamps use the MessagePack timestamp
+// extension. Records are self delimiting, so a stream of them can be read
+// back with MsgpackDecoder.
+type MsgpackFormatter struct{}
+
+func (MsgpackFormatter) Format(event *GormEvent) ([]byte, error) {
+	return appendMsgpackEvent(nil, event), nil
+}
+
+func (MsgpackFormatter) ContentType() string {
+	return "application/msgpack"
+}
+
+const msgpackTimestampExt = -1
+
+func appendMsgpackEvent(b []byte, event *GormEvent) []byte {
+	v := reflect.ValueOf(event).Elem()
+	b = appendMsgpackMapHeader(b, len(eventJSONFields))
+	for _, f := range eventJSONFields {
+		b = appendMsgpackString(b, f.name)
+		b = appendMsgpackValue(b, v.Field(f.index))
+	}
+	return b
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	errorType       = reflect.TypeOf((*error)(nil)).Elem()
+	eventErrorsType = reflect.TypeOf(EventErrors(nil))
+)
+
+func appendMsgpackValue(b []byte, v reflect.Value) []byte {
+	if !v.IsValid() {
+		return append(b, 0xc0)
+	}
+
+	if v.Type() == timeType {
+		return appendMsgpackTime(b, v.Interface().(time.Time))
+	}
+	if v.Type() == eventErrorsType && !v.IsNil() {
+		details := []map[string]interface{}{}
+		for _, e := range v.Interface().(EventErrors).details() {
+			details = append(details, map[string]interface{}{"message": e.Message, "type": e.Type})
+		}
+		return appendMsgpackValue(b, reflect.ValueOf(details))
+	}
+	if v.Type().Implements(errorType) && v.Kind() != reflect.Interface {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return append(b, 0xc0)
+		}
+		return appendMsgpackString(b, v.Interface().(error).Error())
+	}
+
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		return appendMsgpackValue(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(b, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		b = append(b, 0xcb)
+		return appendUint64(b, math.Float64bits(v.Float()))
+	case reflect.String:
+		return appendMsgpackString(b, v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendMsgpackBinary(b, v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		b = appendMsgpackArrayHeader(b, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			b = appendMsgpackValue(b, v.Index(i))
+		}
+		return b
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0)
+		}
+		b = appendMsgpackMapHeader(b, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			b = appendMsgpackString(b, fmt.Sprint(iter.Key().Interface()))
+			b = appendMsgpackValue(b, iter.Value())
+		}
+		return b
+	case reflect.Struct:
+		return appendMsgpackStruct(b, v)
+	}
+
+	if v.CanInterface() {
+		return appendMsgpackString(b, fmt.Sprint(v.Interface()))
+	}
+	return append(b, 0xc0)
+}
+
+// appendMsgpackStruct writes v as a map keyed by the JSON names of its
+// fields, leaving out those encoding/json would, so it decodes like the
+// JSON output. Structs marshaling themselves to JSON are written as what
+// they marshal to.
+func appendMsgpackStruct(b []byte, v reflect.Value) []byte {
+	if m, ok := v.Interface().(json.Marshaler); ok {
+		var decoded interface{}
+		data, err := m.MarshalJSON()
+		if err == nil {
+			err = json.Unmarshal(data, &decoded)
+		}
+		if err != nil {
+			return append(b, 0xc0)
+		}
+		return appendMsgpackValue(b, reflect.ValueOf(decoded))
+	}
+
+	var fields []msgpackField
+	for _, f := range msgpackStructFields(v.Type()) {
+		if !f.omitEmpty || !isEmptyValue(v.Field(f.index)) {
+			fields = append(fields, f)
+		}
+	}
+	b = appendMsgpackMapHeader(b, len(fields))
+	for _, f := range fields {
+		b = appendMsgpackString(b, f.name)
+		b = appendMsgpackValue(b, v.Field(f.index))
+	}
+	return b
+}
+
+type msgpackField struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+// msgpackFields caches the fields of the struct types written, by type.
+var msgpackFields sync.Map
+
+// msgpackStructFields lists the exported fields of t by JSON name.
+func msgpackStructFields(t reflect.Type) []msgpackField {
+	if fields, ok := msgpackFields.Load(t); ok {
+		return fields.([]msgpackField)
+	}
+	var fields []msgpackField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := strings.Split(sf.Tag.Get("json"), ",")
+		if sf.PkgPath != "" || tag[0] == "-" {
+			continue
+		}
+		f := msgpackField{name: tag[0], index: i}
+		if f.name == "" {
+			f.name = sf.Name
+		}
+		for _, opt := range tag[1:] {
+			f.omitEmpty = f.omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, f)
+	}
+	msgpackFields.Store(t, fields)
+	return fields
+}
+
+// isEmptyValue reports whether v is empty as encoding/json's omitempty
+// has it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0:
+		return appendMsgpackUint(b, uint64(n))
+	case n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16:
+		return appendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32:
+		return appendUint32(append(b, 0xd2), uint32(n))
+	}
+	return appendUint64(append(b, 0xd3), uint64(n))
+}
+
+func appendMsgpackUint(b []byte, n uint64) []byte {
+	switch {
+	case n < 128:
+		return append(b, byte(n))
+	case n <= math.MaxUint8:
+		return append(b, 0xcc, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xcd), uint16(n))
+	case n <= math.MaxUint32:
+		return appendUint32(append(b, 0xce), uint32(n))
+	}
+	return appendUint64(append(b, 0xcf), n)
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = appendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = appendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b []byte, bs []byte) []byte {
+	n := len(bs)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = appendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = appendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, bs...)
+}
+
+func appendMsgpackArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xdc), uint16(n))
+	}
+	return appendUint32(append(b, 0xdd), uint32(n))
+}
+
+func appendMsgpackMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return appendUint16(append(b, 0xde), uint16(n))
+	}
+	return appendUint32(append(b, 0xdf), uint32(n))
+}
+
+// appendMsgpackTime writes the 96 bit timestamp extension.
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xc7, 12, byte(msgpackTimestampExt&0xff))
+	b = appendUint32(b, uint32(t.Nanosecond()))
+	return appendUint64(b, uint64(t.Unix()))
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+func appendUint32(b []byte, n uint32) []byte {
+	return append(b, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(n>>32)), uint32(n))
+}
+
+// MsgpackDecoder reads events written by MsgpackFormatter.
+type MsgpackDecoder struct {
+	r *bufio.Reader
+}
+
+// NewMsgpackDecoder creates a decoder reading from r.
+func NewMsgpackDecoder(r io.Reader) *MsgpackDecoder {
+	return &MsgpackDecoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads the next event, returning io.EOF when the stream is
+// exhausted.
+func (d *MsgpackDecoder) Decode() (*GormEvent, error) {
+	if _, err := d.r.Peek(1); err != nil {
+		return nil, err
+	}
+
+	v, err := d.decodeValue()
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("gormsanity: expected msgpack map, got %T", v)
+	}
+
+	return decodeEventMap(m)
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (d *MsgpackDecoder) decodeValue() (interface{}, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return d.readString(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLength(c - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.readBytes(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLength(c - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		n, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := d.readUint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.readUint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.readUint(size)
+		shift := uint(64 - 8*size)
+		return int64(n<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLength(c - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		return d.readString(n)
+	case 0xdc, 0xdd:
+		n, err := d.readLength(c - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLength(c - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+	return nil, fmt.Errorf("gormsanity: unsupported msgpack type 0x%x", c)
+}
+
+// readLength reads a 1, 2 or 4 byte length for size classes 0, 1 and 2.
+func (d *MsgpackDecoder) readLength(class byte) (int, error) {
+	n, err := d.readUint(1 << class)
+	return int(n), err
+}
+
+func (d *MsgpackDecoder) readUint(size int) (uint64, error) {
+	bs, err := d.readBytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, b := range bs {
+		n = n<<8 | uint64(b)
+	}
+	return n, nil
+}
+
+func (d *MsgpackDecoder) readBytes(n int) ([]byte, error) {
+	bs := make([]byte, n)
+	_, err := io.ReadFull(d.r, bs)
+	return bs, err
+}
+
+func (d *MsgpackDecoder) readString(n int) (string, error) {
+	bs, err := d.readBytes(n)
+	return string(bs), err
+}
+
+func (d *MsgpackDecoder) decodeArray(n int) ([]interface{}, error) {
+	arr := make([]interface{}, n)
+	for i := range arr {
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		arr[i] = v
+	}
+	return arr, nil
+}
+
+func (d *MsgpackDecoder) decodeMap(n int) (map[string]interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decodeValue()
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+func (d *MsgpackDecoder) decodeExt(n int) (interface{}, error) {
+	typ, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	data, err := d.readBytes(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(typ) != msgpackTimestampExt {
+		return data, nil
+	}
+
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&0x3ffffffff), int64(v>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(binary.BigEndian.Uint32(data))), nil
+	}
+	return nil, fmt.Errorf("gormsanity: invalid msgpack timestamp length %d", n)
+}
@@ -0,0 +1,99 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMsgpack_RoundTrip(t *testing.T) {
+	a := require.New(t)
+
+	start := time.Date(2020, 8, 1, 12, 0, 0, 123456789, time.UTC)
+	in := &GormEvent{
+		StartTime:    start,
+		EndTime:      start.Add(1500 * time.Millisecond),
+		EventType:    "update",
+		Query:        strings.Repeat("x", 300),
+		RowsAffected: 70000,
+		Errors:       []error{errors.New("duplicate key")},
+		IsComplete:   true,
+		Vars:         map[string]interface{}{"gorm:started_transaction": true},
+		Warnings:     []string{"no_where_update"},
+		SQLVars:      []interface{}{int64(-5), int64(-200), 1.5, "acme", []byte("raw"), nil},
+		Transaction:  0xdeadbeef,
+		Violation:    &Violation{Rule: "n_plus_one", Severity: SeverityWarn, Message: "10 queries", Count: 10, Events: []string{"a", "b"}},
+		Search:       &SearchClauses{Where: []SearchCondition{{Query: "id = ?", Args: []interface{}{"7"}}}, Limit: "10"},
+		Changes:      []FieldChange{{Column: "status", Old: "active", New: "closed"}},
+	}
+
+	var buf bytes.Buffer
+	sink := NewWriterSink(&buf)
+	sink.Formatter = MsgpackFormatter{}
+	a.NoError(sink.Write(in))
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+
+	dec := NewMsgpackDecoder(&buf)
+	out, err := dec.Decode()
+	a.NoError(err)
+
+	a.True(in.StartTime.Equal(out.StartTime))
+	a.True(in.EndTime.Equal(out.EndTime))
+	a.Equal(in.EventType, out.EventType)
+	a.Equal(in.Query, out.Query)
+	a.Equal(in.RowsAffected, out.RowsAffected)
+	a.Equal("duplicate key", out.Errors[0].Error())
+	a.Equal(in.IsComplete, out.IsComplete)
+	a.Equal(in.Vars, out.Vars)
+	a.Equal(in.Warnings, out.Warnings)
+	a.Equal([]interface{}{json.Number("-5"), json.Number("-200"), json.Number("1.5"), "acme", "cmF3", nil}, out.SQLVars)
+	a.Equal(in.Transaction, out.Transaction)
+	a.Equal(in.Violation, out.Violation)
+	a.Equal(in.Search, out.Search)
+	a.Equal(in.Changes, out.Changes)
+
+	out, err = dec.Decode()
+	a.NoError(err)
+	a.Equal("query", out.EventType)
+
+	_, err = dec.Decode()
+	a.Equal(io.EOF, err)
+}
+
+func TestHTTPSink_MsgpackFormatter(t *testing.T) {
+	a := require.New(t)
+
+	var contentType string
+	var events []*GormEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		dec := NewMsgpackDecoder(r.Body)
+		for {
+			e, err := dec.Decode()
+			if err == io.EOF {
+				return
+			}
+			a.NoError(err)
+			events = append(events, e)
+		}
+	}))
+	defer srv.Close()
+
+	sink := NewHTTPSink(srv.URL)
+	sink.Formatter = MsgpackFormatter{}
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "delete"}))
+	a.NoError(sink.Close())
+
+	a.Equal("application/msgpack", contentType)
+	a.Len(events, 2)
+	a.Equal("delete", events[1].EventType)
+}
@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MultiSink fans every event out to several sinks. A failing sink doesn't
+// stop the others from receiving the event; failures are collected into a
+// SinkErrors.
+type MultiSink struct {
+	sinks []Sink
+}
+
+// NewMultiSink creates a sink writing to each of sinks in order.
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// SinkErrors collects the failures of the sinks behind a MultiSink.
+type SinkErrors []error
+
+func (e SinkErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (m *MultiSink) each(fn func(Sink) error) error {
+	var errs SinkErrors
+	for i, s := range m.sinks {
+		if err := fn(s); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d (%T): %w", i, s, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Dropped returns the number of events dropped by the sinks that discard
+// events.
+func (m *MultiSink) Dropped() uint64 {
+	var dropped uint64
+	for _, s := range m.sinks {
+		if d, ok := s.(dropCounter); ok {
+			dropped += d.Dropped()
+		}
+	}
+	return dropped
+}
+
+func (m *MultiSink) Write(event *GormEvent) error {
+	return m.each(func(s Sink) error { return s.Write(event) })
+}
+
+func (m *MultiSink) Flush() error {
+	return m.each(func(s Sink) error { return s.Flush() })
+}
+
+func (m *MultiSink) Close() error {
+	return m.each(func(s Sink) error { return s.Close() })
+}
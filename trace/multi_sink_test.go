@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+type failingSink struct {
+	memorySink
+}
+
+func (s *failingSink) Write(event *GormEvent) error {
+	return errors.New("disk full")
+}
+
+func TestMultiSink_IndependentErrors(t *testing.T) {
+	a := require.New(t)
+	bad, good := &failingSink{}, &memorySink{}
+
+	m := NewMultiSink(bad, good)
+	err := m.Write(&GormEvent{EventType: "create"})
+	a.Error(err)
+	a.Len(err.(SinkErrors), 1)
+	a.Contains(err.Error(), "disk full")
+	a.Len(good.Events(), 1)
+
+	a.NoError(m.Close())
+	a.True(bad.closed)
+	a.True(good.closed)
+}
+
+func TestTraceDB_MultipleSinks(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	first, second := &memorySink{}, &memorySink{}
+
+	db, tracer := TraceDB(db, WithTest(t), WithSink(first), WithSink(second))
+	a.NoError(db.Delete(&models.Account{Id: 1}).Error)
+	tracer.Close()
+
+	a.Len(first.Events(), 1)
+	a.Len(second.Events(), 1)
+}
@@ -0,0 +1,122 @@
+package trace
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultNPlusOneThreshold is the number of queries of the same shape,
+	// run with different values, flagged as an N+1, see
+	// WithNPlusOneDetection.
+	DefaultNPlusOneThreshold = 10
+	// DefaultNPlusOneWindow is the window N+1 queries are counted over.
+	DefaultNPlusOneWindow = time.Second
+)
+
+// nPlusOneDetector flags the same query being run over and over with
+// different values, typically once per row of an earlier query, which is
+// better done with a single query or Preload. Queries are counted per
+// transaction, or per request when they carry a request ID, over windows
+// starting with the first of them. Queries belonging to neither aren't
+// counted, as those of unrelated callers would add up.
+type nPlusOneDetector struct {
+	threshold int
+	window    time.Duration
+
+	mu        sync.Mutex
+	counts    map[nPlusOneKey]*nPlusOneCount
+	lastPrune time.Time
+}
+
+type nPlusOneKey struct {
+	scope, fingerprint string
+}
+
+type nPlusOneCount struct {
+	start   time.Time
+	args    map[string]bool
+	events  []string
+	flagged bool
+}
+
+func newNPlusOneDetector(threshold int, window time.Duration) *nPlusOneDetector {
+	return &nPlusOneDetector{
+		threshold: threshold,
+		window:    window,
+		counts:    map[nPlusOneKey]*nPlusOneCount{},
+	}
+}
+
+func (d *nPlusOneDetector) rule() string { return "n_plus_one" }
+
+func (d *nPlusOneDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" && e.EventType != "row_query" || e.Fingerprint == "" || d.threshold <= 0 {
+		return nil
+	}
+
+	scope := windowScope(e)
+	if scope == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.prune(e.StartTime)
+
+	key := nPlusOneKey{scope, e.Fingerprint}
+	c := d.counts[key]
+	if c == nil || e.StartTime.Sub(c.start) > d.window {
+		c = &nPlusOneCount{start: e.StartTime, args: map[string]bool{}}
+		d.counts[key] = c
+	}
+	if c.flagged {
+		e.Warnings = append(e.Warnings, d.rule())
+		return nil
+	}
+
+	c.args[e.argsHash] = true
+	c.events = append(c.events, e.ID)
+	if len(c.args) < d.threshold {
+		return nil
+	}
+
+	c.flagged = true
+	e.Warnings = append(e.Warnings, d.rule())
+	return []*Violation{{
+		Rule:    d.rule(),
+		Message: fmt.Sprintf("the same query ran %d times with different values within %v", len(c.events), d.window),
+		Count:   len(c.events),
+		Events:  c.events,
+	}}
+}
+
+// prune forgets windows that have ended, at most once per window.
+func (d *nPlusOneDetector) prune(now time.Time) {
+	if now.Sub(d.lastPrune) < d.window {
+		return
+	}
+	d.lastPrune = now
+	for key, c := range d.counts {
+		if now.Sub(c.start) > d.window {
+			delete(d.counts, key)
+		}
+	}
+}
+
+// windowScope groups the events of one transaction, or else one request,
+// for detectors looking across them. Transactions begun with db.Begin
+// rather than Begin have no TransactionID and are told apart by their
+// *sql.Tx.
+func windowScope(e *GormEvent) string {
+	switch {
+	case e.TransactionID != "":
+		return "tx:" + e.TransactionID
+	case e.Transaction != 0:
+		return fmt.Sprintf("sql_tx:%x", e.Transaction)
+	case e.RequestID != "":
+		return "request:" + e.RequestID
+	}
+	return ""
+}
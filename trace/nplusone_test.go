@@ -0,0 +1,111 @@
+package trace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_NPlusOne(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithSink(sink), WithNPlusOneDetection(3, time.Minute),
+		WithoutRules("duplicate_query"), WithClock(&stepClock{now: epoch, step: time.Millisecond}))
+	req := WithContext(db, context.WithValue(context.Background(), RequestIDKey, "req-1"))
+	other := WithContext(db, context.WithValue(context.Background(), RequestIDKey, "req-2"))
+
+	// Repeating the same values isn't an N+1, nor are queries of other
+	// requests.
+	a.NoError(req.Where("organization_id = ?", "org-1").Find(&[]models.Account{}).Error)
+	a.NoError(req.Where("organization_id = ?", "org-1").Find(&[]models.Account{}).Error)
+	a.NoError(other.Where("organization_id = ?", "org-2").Find(&[]models.Account{}).Error)
+	a.NoError(req.Where("organization_id = ?", "org-2").Find(&[]models.Account{}).Error)
+	a.NoError(req.Where("organization_id = ?", "org-3").Find(&[]models.Account{}).Error)
+	a.NoError(req.Where("organization_id = ?", "org-4").Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	var violations []*GormEvent
+	var flagged int
+	for _, e := range sink.Events() {
+		if e.EventType == ViolationEventType {
+			violations = append(violations, e)
+		} else if len(e.Warnings) > 0 && e.Warnings[len(e.Warnings)-1] == "n_plus_one" {
+			flagged++
+		}
+	}
+	a.Len(violations, 1)
+	a.Equal(2, flagged)
+
+	v := violations[0]
+	a.Equal("req-1", v.RequestID)
+	a.Equal([]string{"n_plus_one"}, v.Warnings)
+	a.Equal("n_plus_one", v.Violation.Rule)
+	a.Equal(4, v.Violation.Count)
+	a.Len(v.Violation.Events, 4)
+	a.NotEmpty(v.Fingerprint)
+
+	// Disabled like the other rules.
+	sink = &memorySink{}
+	db, tracer = TraceDB(db, WithSink(sink), WithNPlusOneDetection(2, time.Minute), WithoutRules("n_plus_one"))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 2).Find(&[]models.Account{}).Error)
+	tracer.Close()
+	a.Len(sink.Events(), 2)
+}
+
+func TestTracer_NPlusOne_Transaction(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithNPlusOneDetection(3, time.Minute))
+	tx := db.Begin()
+	for j := 1; j <= 5; j++ {
+		a.NoError(tx.Where("id = ?", j).Find(&[]models.Account{}).Error)
+	}
+	a.NoError(tx.Commit().Error)
+	tracer.Close()
+
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+		}
+	}
+	a.Len(violations, 1)
+	a.Equal("n_plus_one", violations[0].Rule)
+	a.Equal(3, violations[0].Count)
+}
+
+func TestNPlusOneDetector_Window(t *testing.T) {
+	a := require.New(t)
+	d := newNPlusOneDetector(2, time.Second)
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	query := func(at time.Duration, args string) []*Violation {
+		return d.observe(&GormEvent{EventType: "query", TransactionID: "tx", Fingerprint: "f", StartTime: epoch.Add(at), argsHash: args})
+	}
+	a.Empty(query(0, "a"))
+	a.Empty(query(2*time.Second, "b"), "the first query's window has ended")
+	a.Len(query(2500*time.Millisecond, "c"), 1)
+	a.Len(d.counts, 1)
+}
+
+func TestNPlusOneDetector_Unscoped(t *testing.T) {
+	a := require.New(t)
+	d := newNPlusOneDetector(2, time.Second)
+
+	// Queries outside any transaction or request may come from unrelated
+	// callers.
+	for _, args := range []string{"a", "b", "c"} {
+		a.Empty(d.observe(&GormEvent{EventType: "query", Fingerprint: "f", argsHash: args}))
+	}
+	a.Empty(d.counts)
+}
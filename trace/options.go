@@ -0,0 +1,676 @@
+package trace
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+// Option configures a Tracer.
+type Option func(*Tracer)
+
+// WithSink sends completed events to sink instead of the default
+// gorm.<timestamp>.log file. The tracer closes the sink when it's closed.
+// Passing several sinks fans events out to all of them.
+func WithSink(sink Sink) Option {
+	return func(t *Tracer) {
+		t.sinks = append(t.sinks, sink)
+	}
+}
+
+// WithWriter writes newline delimited JSON events to w instead of a file.
+func WithWriter(w io.Writer) Option {
+	return WithSink(NewWriterSink(w))
+}
+
+// WithStdout writes newline delimited JSON events to standard output.
+func WithStdout() Option {
+	return WithWriter(os.Stdout)
+}
+
+// WithStderr writes newline delimited JSON events to standard error.
+func WithStderr() Option {
+	return WithWriter(os.Stderr)
+}
+
+// WithPretty writes human readable events to standard output, colored when
+// it's a terminal.
+func WithPretty() Option {
+	return WithSink(newPrettySink())
+}
+
+// WithAsync moves writing to the configured sinks onto a background
+// goroutine, see AsyncSink.
+func WithAsync() Option {
+	return func(t *Tracer) {
+		t.async = true
+	}
+}
+
+// OnError calls fn with every error returned by the sink, which are
+// otherwise only counted in Tracer.Stats. With WithAsync fn is called from
+// the background goroutine.
+func OnError(fn func(error)) Option {
+	return func(t *Tracer) {
+		t.onError = fn
+	}
+}
+
+// WithSampleRate records only the given fraction of operations, between 0
+// and 1, chosen at random. Statements that fail are always recorded.
+func WithSampleRate(rate float64) Option {
+	return func(t *Tracer) {
+		t.sample = rate
+	}
+}
+
+// WithEventTypes records only events of the given types: "create",
+// "query", "row_query", "update" and "delete". Callbacks are only
+// registered for those types, so the others cost nothing.
+func WithEventTypes(types ...string) Option {
+	return func(t *Tracer) {
+		t.eventTypes = map[string]bool{}
+		for _, typ := range types {
+			t.eventTypes[typ] = true
+		}
+	}
+}
+
+// WithTables records only operations on the given tables, along with
+// those of WithModels.
+func WithTables(tables ...string) Option {
+	return func(t *Tracer) {
+		if t.tables == nil {
+			t.tables = map[string]bool{}
+		}
+		for _, table := range tables {
+			t.tables[table] = true
+		}
+	}
+}
+
+// WithModels records only operations on the tables of the given models,
+// e.g. WithModels(&User{}, &Order{}).
+func WithModels(models ...interface{}) Option {
+	return func(t *Tracer) {
+		if t.tables == nil {
+			t.tables = map[string]bool{}
+		}
+		t.models = append(t.models, models...)
+	}
+}
+
+// WithMinDuration records only operations taking at least d, plus those
+// that fail. Faster operations are only counted in Tracer.Stats.
+func WithMinDuration(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.minDuration = d
+	}
+}
+
+// WithErrorsOnly records only operations that fail, keeping a journal of
+// database errors light enough to leave on in production. Other operations
+// are only counted in Tracer.Stats.
+func WithErrorsOnly() Option {
+	return func(t *Tracer) {
+		t.errorsOnly = true
+	}
+}
+
+// WithMaxPendingEvents bounds the events held for operations that haven't
+// completed, such as those interrupted by a panic, at n, DefaultMaxPendingEvents
+// by default. Beyond it the oldest are written as incomplete and counted in
+// Tracer.Stats. Zero removes the bound.
+func WithMaxPendingEvents(n int) Option {
+	return func(t *Tracer) {
+		t.maxPending = n
+	}
+}
+
+// WithMaxPendingAge writes operations that haven't completed after d as
+// incomplete, like WithMaxPendingEvents. They're checked when new
+// operations start.
+func WithMaxPendingAge(d time.Duration) Option {
+	return func(t *Tracer) {
+		t.maxPendingAge = d
+	}
+}
+
+// WithMetricsOnly aggregates operations into Tracer.Metrics without
+// writing events, for the least overhead. Sinks are not used.
+func WithMetricsOnly() Option {
+	return func(t *Tracer) {
+		t.metricsOnly = true
+	}
+}
+
+// WithoutPrimaryKeys leaves the primary keys of the rows written by
+// operations out of events.
+func WithoutPrimaryKeys() Option {
+	return func(t *Tracer) {
+		t.noPrimaryKeys = true
+	}
+}
+
+// WithHashedPrimaryKeys records the primary keys of the rows written by
+// operations as HMAC-SHA256 hashes under key, so events about the same row
+// can be matched without revealing it.
+func WithHashedPrimaryKeys(key []byte) Option {
+	return func(t *Tracer) {
+		t.pkHashKey = key
+	}
+}
+
+// WithChangedColumnsOnly records only the names of the columns updates
+// write in GormEvent.Changes, leaving their values out.
+func WithChangedColumnsOnly() Option {
+	return func(t *Tracer) {
+		t.changeNames = true
+	}
+}
+
+// WithCallerSkip leaves frames of functions starting with the given
+// prefixes, such as "example.com/app/store.", out when looking for the
+// application code that issued an operation, besides gorm's and this
+// package's.
+func WithCallerSkip(prefixes ...string) Option {
+	return func(t *Tracer) {
+		t.callerSkip = append(t.callerSkip, prefixes...)
+	}
+}
+
+// WithoutCaller stops recording the application code that issued each
+// operation, saving walking the stack.
+func WithoutCaller() Option {
+	return func(t *Tracer) {
+		t.noCaller = true
+	}
+}
+
+// WithGoroutineID records the ID of the goroutine issuing each operation,
+// to untangle concurrent work while debugging. Label workers with Worker
+// for names that mean something.
+func WithGoroutineID() Option {
+	return func(t *Tracer) {
+		t.goroutineIDs = true
+	}
+}
+
+// WithContextExtractor adds fn to the functions filling events from the
+// context bound with WithContext, for IDs stored under the application's
+// own context keys.
+func WithContextExtractor(fn ContextExtractor) Option {
+	return func(t *Tracer) {
+		t.extractors = append(t.extractors, fn)
+	}
+}
+
+// WithoutRules turns off the sanity rules with the given names, which are
+// the warnings they add: "no_where_clause", "no_where_update",
+// "no_where_delete", "zero_insert_value", "n_plus_one", "slow_query",
+// "select_star", "unbounded_read", "duplicate_query", "long_transaction",
+// "implicit_transaction", "unindexed_filter", "large_in_list",
+// "cross_join", "hard_delete", "loop_query", "ignored_error",
+// "leaked_rows", "tx_done", "leading_wildcard", "unindexed_sort",
+// "zero_row_write", "full_count" and "type_mismatch".
+func WithoutRules(names ...string) Option {
+	return func(t *Tracer) {
+		if t.disabledRules == nil {
+			t.disabledRules = map[string]bool{}
+		}
+		for _, name := range names {
+			t.disabledRules[name] = true
+		}
+	}
+}
+
+// WithRules turns back on rules turned off by WithoutRules, such as by a
+// config file. Rules taking settings are turned on by their own options.
+func WithRules(names ...string) Option {
+	return func(t *Tracer) {
+		for _, name := range names {
+			delete(t.disabledRules, name)
+		}
+	}
+}
+
+// WithRuleSeverity sets the severity recorded on violations of rule, see
+// Tracer.Rules for the defaults.
+func WithRuleSeverity(rule string, severity Severity) Option {
+	return func(t *Tracer) {
+		if t.severities == nil {
+			t.severities = map[string]Severity{}
+		}
+		t.severities[rule] = severity
+	}
+}
+
+// WithSuppressions silences the violations, and warnings, matching any
+// of suppressions, such as a known N+1 left as it is:
+//
+//	WithSuppressions(Suppression{Rule: "n_plus_one", Fingerprint: "3f1c0d2b9e8a7f60"})
+//
+// The option can be given again to add more. Suppressed violations are
+// counted in TracerStats.
+func WithSuppressions(suppressions ...Suppression) Option {
+	return func(t *Tracer) {
+		t.suppressions = append(t.suppressions, suppressions...)
+	}
+}
+
+// WithRule adds a check of the application's own to the built in rules,
+// see Rule.
+func WithRule(r Rule) Option {
+	return func(t *Tracer) {
+		t.rules = append(t.rules, r)
+	}
+}
+
+// WithStrictWhere fails updates and deletes that would change every row of
+// a table, having neither conditions nor a model with a primary key, with
+// ErrMissingWhere before they run. Otherwise they're only reported, with
+// the no_where_update and no_where_delete warnings and a violation.
+func WithStrictWhere() Option {
+	return func(t *Tracer) {
+		t.strictWhere = true
+	}
+}
+
+// WithSlowThreshold marks operations of the given event types, or of every
+// type when none are given, taking longer than d as slow: they get the
+// "slow_query" warning and a violation is written for them, which
+// MatchViolations routes to a sink of their own.
+func WithSlowThreshold(d time.Duration, eventTypes ...string) Option {
+	return func(t *Tracer) {
+		slow := t.slowDetector()
+		if len(eventTypes) == 0 {
+			slow.types[""] = d
+		}
+		for _, typ := range eventTypes {
+			slow.types[typ] = d
+		}
+	}
+}
+
+// WithSlowTableThreshold is WithSlowThreshold for operations on table,
+// overriding the threshold of their event type.
+func WithSlowTableThreshold(table string, d time.Duration) Option {
+	return func(t *Tracer) {
+		t.slowDetector().tables[table] = d
+	}
+}
+
+// WithSelectStarDetection flags queries selecting every column, as gorm
+// does unless given Select, of models with more than minColumns columns.
+// They get the "select_star" warning and a violation naming the code that
+// issued them is written, to hunt down queries fetching more than they
+// use.
+func WithSelectStarDetection(minColumns int) Option {
+	return func(t *Tracer) {
+		t.selectStar = &selectStarDetector{minColumns}
+	}
+}
+
+// WithUnboundedReadDetection flags queries without a limit that return
+// more than maxRows rows, catching code that loads whole tables into
+// memory. They get the "unbounded_read" warning and a violation is
+// written.
+func WithUnboundedReadDetection(maxRows int64) Option {
+	return func(t *Tracer) {
+		t.unbounded = &unboundedReadDetector{maxRows}
+	}
+}
+
+// WithLongTransactionDetection flags transactions open longer than
+// maxDuration or running more than maxStatements statements, either limit
+// being ignored when zero. Transactions gorm begins for a write are judged
+// when it completes, and those begun with Begin when they're ended with
+// Commit or Rollback. A violation listing every statement of the
+// transaction is written.
+func WithLongTransactionDetection(maxDuration time.Duration, maxStatements int) Option {
+	return func(t *Tracer) {
+		t.longTx = newLongTxDetector(maxDuration, maxStatements)
+	}
+}
+
+// WithImplicitTransactionAdvice flags runs of minRun or more single row
+// creates on the same table from the same place, each in a transaction
+// gorm began for it and starting within maxGap of the previous one ending,
+// as a loop of Create calls does. They get the "implicit_transaction"
+// warning and a violation is written estimating the time spent beginning
+// and committing the transactions, which batching the rows or running the
+// loop in one transaction, see Begin, would save.
+func WithImplicitTransactionAdvice(minRun int, maxGap time.Duration) Option {
+	return func(t *Tracer) {
+		t.implicitTx = newImplicitTxDetector(minRun, maxGap)
+	}
+}
+
+// WithExplain runs EXPLAIN in the background on queries that recur, at
+// most once per interval for each fingerprint, on the first database
+// traced. Filters answered by reading the whole of a table with at least
+// minRows rows, as Postgres' sequential scans and MySQL's ALL access type
+// do, are written as violations carrying the plan, with the
+// "unindexed_filter" rule. So are ORDER BY clauses sorting at least
+// minRows rows rather than reading them in order from an index, with the
+// "unindexed_sort" rule and the estimated cost of the sort where the
+// planner gives one. Queries of other dialects aren't explained.
+func WithExplain(interval time.Duration, minRows int64) Option {
+	return func(t *Tracer) {
+		t.explain = newExplainer(interval, minRows)
+	}
+}
+
+// WithInListLimit flags statements binding more than maxItems values to an
+// IN list, as gorm does with a slice given to Where. Huge lists can exceed
+// the database's limits on parameters and plan poorly, and are better
+// batched or turned into a join. They get the "large_in_list" warning and
+// a violation is written.
+func WithInListLimit(maxItems int) Option {
+	return func(t *Tracer) {
+		t.inList = &inListDetector{maxItems}
+	}
+}
+
+// WithCrossJoinDetection flags queries that probably join tables into
+// their cartesian product by accident: those joining a table with neither
+// ON nor USING, or listing tables in FROM without a WHERE clause, and
+// joins returning fanOut or more times as many rows as distinct records
+// of their model, which 0 leaves unchecked. They get the "cross_join"
+// warning and a violation is written.
+func WithCrossJoinDetection(fanOut int) Option {
+	return func(t *Tracer) {
+		t.crossJoin = &crossJoinDetector{fanOut}
+	}
+}
+
+// WithLoopQueryDetection flags minRun or more queries of the same shape
+// from the same caller, each starting within maxGap of the previous one
+// ending, with a numeric value rising or falling at every step, such as
+// consecutive IDs. That's probably a loop fetching records one at a time,
+// which a single query would fetch at once. They get the "loop_query"
+// warning and a violation is written. Callers aren't known with
+// WithoutCaller, which leaves this off.
+func WithLoopQueryDetection(minRun int, maxGap time.Duration) Option {
+	return func(t *Tracer) {
+		t.loopQuery = newLoopQueryDetector(minRun, maxGap)
+	}
+}
+
+// WithLeakedRowsDetection checks that the *sql.Rows returned by Rows are
+// closed, or read to the end, within window of the query. Each open cursor
+// holds a connection, so leaked ones exhaust the pool. Rows still open are
+// reported in a violation naming the code that opened them, with the
+// "leaked_rows" rule. Checks yet to run when the tracer is closed are
+// abandoned.
+func WithLeakedRowsDetection(window time.Duration) Option {
+	return func(t *Tracer) {
+		t.leakedRows = newRowsWatcher(window)
+	}
+}
+
+// WithLeadingWildcardDetection flags LIKE and ILIKE patterns starting
+// with % or _, given in the SQL or as values, which can't use an ordinary
+// index, so every row of the table is read. They get the
+// "leading_wildcard" warning and a violation naming the table and the
+// code that issued them is written, to find where a trigram index or
+// full-text search is due.
+func WithLeadingWildcardDetection() Option {
+	return func(t *Tracer) {
+		t.wildcards = true
+	}
+}
+
+// WithZeroRowWriteDetection flags updates and deletes that succeeded
+// without affecting any rows, which often means their conditions matched
+// nothing by mistake. Statements expected to, such as idempotent deletes,
+// are allowed by their fingerprints, see Fingerprint. The rest get the
+// "zero_row_write" warning and a violation is written. The option can be
+// given again to allow more fingerprints.
+func WithZeroRowWriteDetection(allowedFingerprints ...string) Option {
+	return func(t *Tracer) {
+		if t.zeroRows == nil {
+			t.zeroRows = &zeroRowDetector{allowed: map[string]bool{}}
+		}
+		for _, f := range allowedFingerprints {
+			t.zeroRows.allowed[f] = true
+		}
+	}
+}
+
+// WithFullCountDetection flags counts of every row of a table, which
+// read all of it, on tables with at least minRows rows, or on every table
+// when minRows is 0. Table sizes are the planner's estimates, read from
+// pg_class on Postgres and information_schema on MySQL in the first
+// database traced. They're looked up in the background the first time a
+// table is counted, and again every ten minutes, so the counts before are
+// let through. Counts on tables of other dialects are only flagged when
+// minRows is 0. They get the
+// "full_count" warning and a violation suggesting an approximate count is
+// written.
+func WithFullCountDetection(minRows int64) Option {
+	return func(t *Tracer) {
+		t.fullCount = newFullCountDetector(minRows)
+	}
+}
+
+// WithTypeMismatchDetection flags conditions comparing a column of the
+// model to a value of another type, such as an integer column to a
+// string, going by the Go types of the model's fields and of the values.
+// The database converts the column to compare them, which can keep it
+// from using its index. They get the "type_mismatch" warning and a
+// violation is written.
+func WithTypeMismatchDetection() Option {
+	return func(t *Tracer) {
+		t.typeChecks = true
+	}
+}
+
+// WithNPlusOneDetection flags threshold or more queries of the same shape
+// run with different values within window, in one transaction or request,
+// as an N+1: a query per row of an earlier result, better done with a
+// single query or Preload. The queries are marked with the "n_plus_one"
+// warning and a violation is written with their count. It's on by default
+// with DefaultNPlusOneThreshold and DefaultNPlusOneWindow.
+func WithNPlusOneDetection(threshold int, window time.Duration) Option {
+	return func(t *Tracer) {
+		t.nPlusOne = newNPlusOneDetector(threshold, window)
+	}
+}
+
+// WithDuplicateQueryDetection flags queries run again with the same values
+// within one transaction, or one request when they carry a request ID, a
+// sign of a missing cache or of loading the same thing twice. The repeats
+// get the "duplicate_query" warning and a violation is written for the
+// first. A transaction or request's queries are forgotten once it has gone
+// window without queries. It's on by default with
+// DefaultDuplicateQueryWindow.
+func WithDuplicateQueryDetection(window time.Duration) Option {
+	return func(t *Tracer) {
+		t.duplicates = newDuplicateDetector(window)
+	}
+}
+
+// WithRedactedVars leaves the values bound to statements, otherwise
+// recorded in GormEvent.SQLVars, Search and Changes, out of events, so no
+// application data reaches the sink.
+func WithRedactedVars() Option {
+	return func(t *Tracer) {
+		t.redactVars = true
+	}
+}
+
+// WithInterpolatedSQL also records statements with their values
+// substituted, in GormEvent.Interpolated, ready to paste into a database
+// shell while debugging. It has no effect with WithRedactedVars.
+func WithInterpolatedSQL() Option {
+	return func(t *Tracer) {
+		t.interpolate = true
+	}
+}
+
+// WithCallbackPlacement positions the callbacks starting and completing
+// events of eventType, so timings include or leave out the work of other
+// plugins' callbacks, e.g.
+//
+//	WithCallbackPlacement("create", First(), Last())
+//
+// By default writes are timed from the start of their transaction to its
+// commit, and queries around gorm's own query callbacks.
+func WithCallbackPlacement(eventType string, start, complete Placement) Option {
+	return func(t *Tracer) {
+		if t.placements == nil {
+			t.placements = map[string]callbackPlacement{}
+		}
+		t.placements[eventType] = callbackPlacement{start, complete}
+	}
+}
+
+// Verbosity sets how much detail events record.
+type Verbosity string
+
+const (
+	// VerbosityFull records the SQL text, bound values and scope settings of
+	// events. It's the default.
+	VerbosityFull Verbosity = "full"
+	// VerbositySummary records only the fingerprint, timing, rows and
+	// errors of statements, for a fraction of the volume.
+	VerbositySummary Verbosity = "summary"
+)
+
+// WithVerbosity sets how much detail events record.
+func WithVerbosity(v Verbosity) Option {
+	return func(t *Tracer) {
+		t.verbosity = v
+	}
+}
+
+// WithName labels the tracer, see New.
+func WithName(name string) Option {
+	return func(t *Tracer) {
+		t.name = name
+	}
+}
+
+// WithFileDir places the default trace file in dir, creating it if needed.
+func WithFileDir(dir string) Option {
+	return func(t *Tracer) {
+		t.file.dir = dir
+	}
+}
+
+// WithFileTemplate names the default trace file using template, see
+// ExpandFileTemplate for the supported placeholders.
+func WithFileTemplate(template string) Option {
+	return func(t *Tracer) {
+		t.file.template = template
+	}
+}
+
+// WithFilePerm sets the mode the default trace file is created with.
+func WithFilePerm(perm os.FileMode) Option {
+	return func(t *Tracer) {
+		t.file.perm = perm
+	}
+}
+
+// WithFileRotation rotates the default trace file once it would grow past
+// maxSize bytes, keeping maxFiles rotated files no older than maxAge,
+// either limit being ignored when zero. See FileSink.
+func WithFileRotation(maxSize int64, maxFiles int, maxAge time.Duration) Option {
+	return func(t *Tracer) {
+		t.file.maxSize = maxSize
+		t.file.maxFiles = maxFiles
+		t.file.maxAge = maxAge
+	}
+}
+
+// WithFileCompression gzips the default trace file, appending .gz to its
+// name. See FileSink.
+func WithFileCompression() Option {
+	return func(t *Tracer) {
+		t.file.compress = true
+	}
+}
+
+// WithServiceName names the service being traced, recorded on every event
+// and filling the {service} placeholder of file templates.
+func WithServiceName(name string) Option {
+	return func(t *Tracer) {
+		t.file.service = name
+	}
+}
+
+// WithServiceVersion records the version of the service being traced,
+// such as a release tag or commit, on every event.
+func WithServiceVersion(version string) Option {
+	return func(t *Tracer) {
+		t.version = version
+	}
+}
+
+// WithHostname records hostname on events instead of the one reported by
+// the kernel, e.g. a pod or instance name.
+func WithHostname(hostname string) Option {
+	return func(t *Tracer) {
+		t.hostname = hostname
+	}
+}
+
+// WithDSN records the host and name of the database in dsn, the data
+// source name it was opened with, on every event, so traces of
+// applications using several databases show which one was hit.
+// Credentials in dsn are left out.
+func WithDSN(dsn string) Option {
+	return func(t *Tracer) {
+		t.target = parseDSN(dsn)
+	}
+}
+
+// WithTags records tags, such as the environment, region or deployment,
+// on every event. Passing several maps merges them, later ones taking
+// precedence.
+func WithTags(tags map[string]string) Option {
+	return func(t *Tracer) {
+		merged := make(map[string]string, len(t.tags)+len(tags))
+		for k, v := range t.tags {
+			merged[k] = v
+		}
+		for k, v := range tags {
+			merged[k] = v
+		}
+		t.tags = merged
+	}
+}
+
+// WithEnricher adds enrichers filling GormEvent.Fields, called in order
+// before each event is written.
+func WithEnricher(enrichers ...Enricher) Option {
+	return func(t *Tracer) {
+		t.enrichers = append(t.enrichers, enrichers...)
+	}
+}
+
+// WithHooks calls hooks as operations are traced. Passing several calls
+// them in order.
+func WithHooks(hooks ...Hooks) Option {
+	return func(t *Tracer) {
+		t.hooks = append(t.hooks, hooks...)
+	}
+}
+
+// WithClock takes the start and end times of events from clock, so tests
+// can produce reproducible traces.
+func WithClock(clock Clock) Option {
+	return func(t *Tracer) {
+		t.clock = clock
+	}
+}
+
+// WithTest records the name of the running test on every event.
+func WithTest(testT *testing.T) Option {
+	return func(t *Tracer) {
+		t.testT = testT
+	}
+}
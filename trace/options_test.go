@@ -0,0 +1,345 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTraceDB_WithTest(t *testing.T) {
+	a := require.New(t)
+
+	for _, tc := range []struct {
+		opts     []Option
+		testName string
+	}{
+		{nil, ""},
+		{[]Option{WithTest(t)}, t.Name()},
+	} {
+		db, _ := openFakeDB(t)
+		sink := &memorySink{}
+
+		db, tracer := TraceDB(db, append(tc.opts, WithSink(sink))...)
+		a.NoError(db.Create(&models.Account{EmailAddress: "opts@acme.com", Status: models.Status_Active}).Error)
+		tracer.Close()
+
+		a.Len(sink.Operations(), 1)
+		a.Equal(tc.testName, sink.Operations()[0].TestName)
+	}
+}
+
+func TestTraceDB_WithSampleRate(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing_table") {
+			return errors.New("relation does not exist")
+		}
+		return nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithSampleRate(0), WithoutRules("no_where_clause", "zero_insert_value"))
+	for i := 0; i < 10; i++ {
+		a.NoError(db.Create(&models.Account{EmailAddress: "sample@acme.com", Status: models.Status_Active}).Error)
+	}
+	a.Error(db.Table("missing_table").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 1, "failed statements are always recorded")
+	a.Equal("query", events[0].EventType)
+	a.NotEmpty(events[0].Errors)
+	a.Equal(uint64(1), tracer.Stats().Written)
+}
+
+func TestTracer_Sampled(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	tracer := New("", WithSink(&memorySink{}), WithSampleRate(0.5))
+
+	recorded := 0
+	for i := 0; i < 1000; i++ {
+		scope := db.NewScope(&models.Account{})
+		if tracer.sampled(scope) {
+			recorded++
+		}
+		a.Equal(tracer.sampled(scope), tracer.sampled(scope), "decided once per operation")
+	}
+	a.InDelta(500, recorded, 100)
+}
+
+func TestTraceDB_WithEventTypes(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithEventTypes("create", "update", "delete"))
+	account := models.Account{EmailAddress: "types@acme.com", Status: models.Status_Active}
+	a.NoError(db.Create(&account).Error)
+	a.NoError(db.Where("id = ?", account.Id).Find(&[]models.Account{}).Error)
+	a.NoError(db.Model(&account).Update("status", models.Status_Disabled).Error)
+
+	for _, name := range []string{trackScopeKey, trackScopeKey + ":complete"} {
+		a.Nil(db.Callback().Query().Get(name), "query callbacks aren't registered")
+		a.NotNil(db.Callback().Create().Get(name))
+	}
+	tracer.Close()
+
+	var types []string
+	for _, e := range sink.Operations() {
+		types = append(types, e.EventType)
+	}
+	a.Equal([]string{"create", "update"}, types)
+}
+
+func TestTraceDB_WithTables(t *testing.T) {
+	a := require.New(t)
+
+	for _, opt := range []Option{WithTables("accounts"), WithModels(&models.Account{})} {
+		db, _ := openFakeDB(t)
+		sink := &memorySink{}
+
+		db, tracer := TraceDB(db, WithSink(sink), opt)
+		a.NoError(db.Create(&models.Account{EmailAddress: "tables@acme.com", Status: models.Status_Active}).Error)
+		a.NoError(db.Table("audit_log").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+		a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+		tracer.Close()
+
+		var tables []string
+		for _, e := range sink.Operations() {
+			tables = append(tables, e.EventType+" "+e.TableName)
+		}
+		a.Equal([]string{"create accounts", "query accounts"}, tables)
+	}
+}
+
+func TestTraceDB_WithTablesAndModels(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithTables("audit_log"), WithModels(&models.Account{}), WithTables("sessions"))
+	a.NoError(db.Table("audit_log").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Table("orders").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	var tables []string
+	for _, e := range sink.Events() {
+		tables = append(tables, e.TableName)
+	}
+	a.Equal([]string{"audit_log", "accounts"}, tables)
+	a.Equal(map[string]bool{"audit_log": true, "sessions": true, "accounts": true}, tracer.tables)
+}
+
+func TestTraceDB_WithMinDuration(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		// Not a failure, just slow.
+		if strings.HasPrefix(query, "SELECT") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithMinDuration(10*time.Millisecond), WithoutRules("no_where_clause", "zero_insert_value"))
+	a.NoError(db.Create(&models.Account{EmailAddress: "fast@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 1)
+	a.Equal("query", events[0].EventType)
+	a.Equal(TracerStats{Written: 1, Filtered: 1}, tracer.Stats())
+}
+
+func TestTraceDB_WithErrorsOnly(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.HasPrefix(query, "SELECT") {
+			return errors.New("relation does not exist")
+		}
+		return nil
+	}
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithErrorsOnly(), WithoutRules("no_where_clause", "zero_insert_value"))
+	a.NoError(db.Create(&models.Account{EmailAddress: "ok@acme.com", Status: models.Status_Active}).Error)
+	a.Error(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 1)
+	a.Equal("query", events[0].EventType)
+	a.NotEmpty(events[0].Errors)
+	a.Equal(TracerStats{Written: 1, Filtered: 1}, tracer.Stats())
+}
+
+func TestTraceDB_WithoutRules(t *testing.T) {
+	a := require.New(t)
+
+	for _, tc := range []struct {
+		opts     []Option
+		warnings []string
+	}{
+		{nil, []string{"no_where_clause"}},
+		{[]Option{WithoutRules("no_where_clause")}, nil},
+	} {
+		db, _ := openFakeDB(t)
+		sink := &memorySink{}
+
+		db, tracer := TraceDB(db, append(tc.opts, WithSink(sink))...)
+		a.NoError(db.Find(&[]models.Account{}).Error)
+		tracer.Close()
+
+		a.Equal(tc.warnings, sink.Events()[0].Warnings)
+	}
+}
+
+func TestTraceDB_WithRedactedVars(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithRedactedVars())
+	a.NoError(db.Create(&models.Account{EmailAddress: "secret@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	a.Contains(sink.Events()[0].Warnings, "zero_insert_value")
+	a.Nil(sink.Events()[0].SQLVars)
+}
+
+func TestTraceDB_WithVerbosity(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithVerbosity(VerbositySummary))
+	a.NoError(db.Create(&models.Account{EmailAddress: "summary@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	event := sink.Events()[0]
+	a.NotEmpty(event.Fingerprint)
+	a.Equal(int64(1), event.RowsAffected)
+	a.False(event.EndTime.IsZero())
+	a.Empty(event.Query)
+	a.Nil(event.SQLVars)
+	a.Nil(event.Vars)
+}
+
+type stepClock struct {
+	mu   sync.Mutex
+	now  time.Time
+	step time.Duration
+}
+
+func (c *stepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(c.step)
+	return c.now
+}
+
+func TestTraceDB_WithClock(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithSink(sink), WithClock(&stepClock{now: epoch, step: time.Second}))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	event := sink.Events()[0]
+	a.Equal(epoch.Add(time.Second), event.StartTime)
+	a.Equal(epoch.Add(2*time.Second), event.EndTime)
+	a.Equal(time.Second, event.Duration)
+
+	// Clock adjustments can't make durations negative.
+	sink = &memorySink{}
+	db, tracer = TraceDB(db, WithSink(sink), WithClock(&stepClock{now: epoch, step: -time.Second}))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+	event = sink.Events()[0]
+	a.Zero(event.Duration)
+	a.Equal(event.StartTime, event.EndTime)
+}
+
+func TestGormEvent_EndMonotonic(t *testing.T) {
+	a := require.New(t)
+	start := time.Now()
+
+	// The end time follows the monotonic reading, not the wall clock.
+	e := &GormEvent{StartTime: start}
+	e.end(start.Add(5 * time.Millisecond))
+	a.Equal(5*time.Millisecond, e.Duration)
+	a.True(e.EndTime.Equal(start.Add(5 * time.Millisecond)))
+
+	// Without monotonic readings a wall clock jump back is clamped.
+	e = &GormEvent{StartTime: start.Round(0)}
+	e.end(start.Round(0).Add(-time.Hour))
+	a.Zero(e.Duration)
+	a.True(e.EndTime.Equal(e.StartTime))
+}
+
+func TestTraceDB_WithHooks(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	sink := &memorySink{}
+
+	var started, completed []string
+	db, tracer := TraceDB(db, WithSink(sink), WithHooks(Hooks{
+		OnStart: func(e *GormEvent, scope *gorm.Scope) {
+			started = append(started, e.EventType)
+			if e.EventType == "delete" {
+				scope.Err(errors.New("deletes are disabled"))
+			}
+		},
+		OnComplete: func(e *GormEvent, scope *gorm.Scope) {
+			completed = append(completed, e.EventType)
+			e.Vars["reviewed"] = true
+		},
+	}))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.EqualError(db.Delete(&models.Account{Id: 1}).Error, "deletes are disabled")
+	tracer.Close()
+
+	a.Equal([]string{"query", "delete"}, started)
+	a.Equal([]string{"query", "delete"}, completed)
+	for _, q := range fdb.queries {
+		a.NotContains(q, "DELETE")
+	}
+	a.Equal(true, sink.Events()[0].Vars["reviewed"])
+}
+
+func TestTraceDB_WithEnricher(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	tenant := EnricherFunc(func(e *GormEvent, scope *gorm.Scope) {
+		if v, ok := scope.Get("tenant_id"); ok {
+			e.Fields["tenant_id"] = v
+		}
+	})
+	flags := EnricherFunc(func(e *GormEvent, scope *gorm.Scope) {
+		e.Fields["new_checkout"] = true
+	})
+
+	db, tracer := TraceDB(db, WithSink(sink), WithEnricher(tenant, flags))
+	a.NoError(db.Set("tenant_id", "acme").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	a.Equal(map[string]interface{}{"tenant_id": "acme", "new_checkout": true}, sink.Events()[0].Fields)
+}
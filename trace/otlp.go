@@ -0,0 +1,193 @@
+package trace
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// OTLP span kind and status codes.
+const (
+	otlpSpanKindClient  = 3
+	otlpStatusCodeOK    = 1
+	otlpStatusCodeError = 2
+)
+
+// NewOTLPSink creates a sink exporting events as spans to an OpenTelemetry
+// collector's OTLP/HTTP receiver, e.g. http://localhost:4318. Spans are
+// JSON encoded, so only the HTTP transport is supported; point gRPC-only
+// setups at a collector with the otlphttp receiver enabled.
+func NewOTLPSink(endpoint, serviceName string) *HTTPSink {
+	s := NewHTTPSink(strings.TrimSuffix(endpoint, "/") + "/v1/traces")
+	s.encode = func(batch []*GormEvent) ([]byte, error) {
+		return json.Marshal(otlpTraces(serviceName, batch))
+	}
+	return s
+}
+
+type otlpExport struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+// otlpValue is an AnyValue. Per the protobuf JSON mapping 64 bit integers
+// are encoded as strings.
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+func otlpString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpInt(key string, value int64) otlpKeyValue {
+	v := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpValue{IntValue: &v}}
+}
+
+func otlpTraces(serviceName string, batch []*GormEvent) otlpExport {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, e := range batch {
+		spans = append(spans, otlpSpanFromEvent(e))
+	}
+
+	return otlpExport{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{otlpString("service.name", serviceName)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "gormsanity"}, Spans: spans}},
+	}}}
+}
+
+func otlpSpanFromEvent(e *GormEvent) otlpSpan {
+	traceID := uuid.New()
+	spanID := uuid.New()
+
+	// Join the caller's trace when the context carried a W3C trace ID.
+	traceIDHex := hex.EncodeToString(traceID[:])
+	if id, err := hex.DecodeString(e.TraceID); err == nil && len(id) == 16 {
+		traceIDHex = hex.EncodeToString(id)
+	}
+
+	attrs := []otlpKeyValue{
+		otlpString("db.system", e.Dialect),
+		otlpString("db.operation", e.EventType),
+		otlpString("db.statement", e.Query),
+		otlpString("db.sql.table", e.TableName),
+		otlpString("gorm.instance_id", e.InstanceID),
+		otlpInt("gorm.rows_affected", e.RowsAffected),
+	}
+	if e.DBName != "" {
+		attrs = append(attrs, otlpString("db.name", e.DBName))
+	}
+	if e.DBHost != "" {
+		attrs = append(attrs, otlpString("net.peer.name", e.DBHost))
+	}
+	if e.Hostname != "" {
+		attrs = append(attrs, otlpString("host.name", e.Hostname))
+	}
+	if e.PID != 0 {
+		attrs = append(attrs, otlpInt("process.pid", int64(e.PID)))
+	}
+	if e.ServiceVersion != "" {
+		attrs = append(attrs, otlpString("service.version", e.ServiceVersion))
+	}
+	if len(e.Warnings) > 0 {
+		attrs = append(attrs, otlpString("gormsanity.warnings", strings.Join(e.Warnings, ",")))
+	}
+	if e.TestName != "" {
+		attrs = append(attrs, otlpString("gormsanity.test_name", e.TestName))
+	}
+	if e.RequestID != "" {
+		attrs = append(attrs, otlpString("gormsanity.request_id", e.RequestID))
+	}
+	if e.UserID != "" {
+		attrs = append(attrs, otlpString("enduser.id", e.UserID))
+	}
+	for _, k := range sortedKeys(e.Tags) {
+		attrs = append(attrs, otlpString("gormsanity.tags."+k, e.Tags[k]))
+	}
+	for _, k := range sortedKeys(e.Fields) {
+		attrs = append(attrs, otlpString("gormsanity.fields."+k, fmt.Sprint(e.Fields[k])))
+	}
+
+	status := otlpStatus{Code: otlpStatusCodeOK}
+	if len(e.Errors) > 0 {
+		msgs := make([]string, 0, len(e.Errors))
+		for _, err := range e.Errors {
+			msgs = append(msgs, err.Error())
+		}
+		status = otlpStatus{Code: otlpStatusCodeError, Message: strings.Join(msgs, "; ")}
+	}
+
+	end := e.EndTime
+	if end.IsZero() {
+		end = e.StartTime
+	}
+
+	return otlpSpan{
+		TraceID:           traceIDHex,
+		SpanID:            hex.EncodeToString(spanID[:8]),
+		Name:              "gorm." + e.EventType + " " + e.TableName,
+		Kind:              otlpSpanKindClient,
+		StartTimeUnixNano: strconv.FormatInt(e.StartTime.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        attrs,
+		Status:            status,
+	}
+}
+
+// sortedKeys returns the keys of m, a map with string keys such as
+// GormEvent.Tags or GormEvent.Fields, in order.
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
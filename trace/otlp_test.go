@@ -0,0 +1,49 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOTLPSink(t *testing.T) {
+	a := require.New(t)
+
+	var path string
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		a.NoError(json.NewDecoder(r.Body).Decode(&body))
+	}))
+	defer srv.Close()
+
+	start := time.Unix(10, 0)
+	sink := NewOTLPSink(srv.URL+"/", "billing")
+	a.NoError(sink.Write(&GormEvent{
+		EventType: "update",
+		TableName: "accounts",
+		StartTime: start,
+		EndTime:   start.Add(time.Millisecond),
+		Errors:    []error{errors.New("deadlock detected")},
+	}))
+	a.NoError(sink.Close())
+
+	a.Equal("/v1/traces", path)
+
+	rs := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	span := rs["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})[0].(map[string]interface{})
+	a.Equal("gorm.update accounts", span["name"])
+	a.Equal("10000000000", span["startTimeUnixNano"])
+	a.Equal("10001000000", span["endTimeUnixNano"])
+	a.Len(span["traceId"], 32)
+	a.Len(span["spanId"], 16)
+
+	status := span["status"].(map[string]interface{})
+	a.Equal(float64(otlpStatusCodeError), status["code"])
+	a.Equal("deadlock detected", status["message"])
+}
@@ -0,0 +1,491 @@
+package trace
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ParquetSink writes events to Parquet files partitioned by the hour the
+// event started in, Hive style:
+//
+//	<dir>/dt=2020-08-01/hour=13/events-<unixnano>.parquet
+//
+// Parquet files can't be appended to, so events are buffered in memory and
+// each flush writes a new file holding a single row group. A file is
+// written when RowGroupSize events are buffered, when an event for a
+// different hour arrives, every FlushInterval, and on Flush and Close. The
+// configuration fields must be set before the first event is written.
+//
+// Columns are flat and required. Timestamps are INT64 microseconds since
+// the epoch, errors and warnings are JSON encoded strings.
+type ParquetSink struct {
+	// RowGroupSize is the most events written to a file, 10000 when it
+	// isn't positive.
+	RowGroupSize int
+	// FlushInterval bounds how long events are buffered, a minute when it
+	// isn't positive.
+	FlushInterval time.Duration
+	// Compress gzips the column data.
+	Compress bool
+	// OnError is called with the errors of the files written every
+	// FlushInterval, which have no caller to return them to.
+	OnError func(error)
+
+	dir string
+
+	once     sync.Once
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+
+	mu   sync.Mutex
+	hour time.Time
+	rows []*GormEvent
+}
+
+const (
+	defaultParquetRowGroupSize  = 10000
+	defaultParquetFlushInterval = time.Minute
+)
+
+// NewParquetSink creates a sink writing partitions under dir.
+func NewParquetSink(dir string) *ParquetSink {
+	return &ParquetSink{
+		RowGroupSize:  defaultParquetRowGroupSize,
+		FlushInterval: defaultParquetFlushInterval,
+		dir:           dir,
+	}
+}
+
+func (s *ParquetSink) start() {
+	s.once.Do(func() {
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *ParquetSink) run() {
+	defer close(s.done)
+
+	interval := s.FlushInterval
+	if interval <= 0 {
+		interval = defaultParquetFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			if err := s.Flush(); err != nil && s.OnError != nil {
+				s.OnError(err)
+			}
+		}
+	}
+}
+
+func (s *ParquetSink) Write(event *GormEvent) error {
+	s.start()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hour := event.StartTime.UTC().Truncate(time.Hour)
+	if len(s.rows) > 0 && !hour.Equal(s.hour) {
+		if err := s.writeFile(); err != nil {
+			return err
+		}
+	}
+
+	s.hour = hour
+	s.rows = append(s.rows, event)
+	size := s.RowGroupSize
+	if size <= 0 {
+		size = defaultParquetRowGroupSize
+	}
+	if len(s.rows) >= size {
+		return s.writeFile()
+	}
+	return nil
+}
+
+func (s *ParquetSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.writeFile()
+}
+
+func (s *ParquetSink) Close() error {
+	s.start()
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+	return s.Flush()
+}
+
+func (s *ParquetSink) writeFile() error {
+	if len(s.rows) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(s.dir, "dt="+s.hour.Format("2006-01-02"), "hour="+s.hour.Format("15"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	bs, err := encodeParquet(s.rows, s.Compress)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary name first so readers never see a partial file.
+	name := filepath.Join(dir, fmt.Sprintf("events-%d.parquet", time.Now().UnixNano()))
+	if err := ioutil.WriteFile(name+".tmp", bs, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(name+".tmp", name); err != nil {
+		return err
+	}
+
+	s.rows = nil
+	return nil
+}
+
+// Parquet physical types, converted types and codecs used by the sink.
+const (
+	parquetBoolean   = 0
+	parquetInt32     = 1
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMicros = 10
+
+	parquetRequired = 0
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetUncompressed = 0
+	parquetGzip         = 2
+
+	parquetDataPage = 0
+)
+
+type parquetColumn struct {
+	name      string
+	typ       int32
+	converted int32 // -1 when there's no converted type
+	value     func(*GormEvent) interface{}
+}
+
+func parquetTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return int64(0)
+	}
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+func parquetJSON(v interface{}) interface{} {
+	bs, _ := json.Marshal(v)
+	if string(bs) == "null" {
+		return ""
+	}
+	return string(bs)
+}
+
+var parquetColumns = []parquetColumn{
+	{"schema_version", parquetInt32, -1, func(e *GormEvent) interface{} { return int32(e.SchemaVersion) }},
+	{"event_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.ID }},
+	{"parent_event_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.ParentID }},
+	{"sequence", parquetInt64, -1, func(e *GormEvent) interface{} { return int64(e.Sequence) }},
+	{"preload", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Preload }},
+	{"start_time", parquetInt64, parquetTimestampMicros, func(e *GormEvent) interface{} { return parquetTime(e.StartTime) }},
+	{"end_time", parquetInt64, parquetTimestampMicros, func(e *GormEvent) interface{} { return parquetTime(e.EndTime) }},
+	{"duration_ns", parquetInt64, -1, func(e *GormEvent) interface{} { return int64(e.Duration) }},
+	{"event_type", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.EventType }},
+	{"table_name", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.TableName }},
+	{"model_type", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.ModelType }},
+	{"primary_keys", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.PrimaryKeys) }},
+	{"changes", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Changes) }},
+	{"fingerprint", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Fingerprint }},
+	{"query", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Query }},
+	{"query_interpolated", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Interpolated }},
+	{"search", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Search) }},
+	{"rows_affected", parquetInt64, -1, func(e *GormEvent) interface{} { return e.RowsAffected }},
+	{"rows_returned", parquetInt64, -1, func(e *GormEvent) interface{} { return e.RowsReturned }},
+	{"result_columns", parquetInt32, -1, func(e *GormEvent) interface{} { return int32(e.ResultColumns) }},
+	{"result_bytes", parquetInt64, -1, func(e *GormEvent) interface{} { return e.ResultBytes }},
+	{"slow", parquetBoolean, -1, func(e *GormEvent) interface{} { return e.Slow }},
+	{"soft_delete", parquetBoolean, -1, func(e *GormEvent) interface{} { return e.SoftDelete }},
+	{"completed", parquetBoolean, -1, func(e *GormEvent) interface{} { return e.IsComplete }},
+	{"errors", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Errors) }},
+	{"warnings", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Warnings) }},
+	{"db_instance_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.InstanceID }},
+	{"dialect", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Dialect }},
+	{"db_host", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.DBHost }},
+	{"db_name", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.DBName }},
+	{"test_name", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.TestName }},
+	{"tx_id", parquetInt64, -1, func(e *GormEvent) interface{} { return int64(e.Transaction) }},
+	{"attempt", parquetInt32, -1, func(e *GormEvent) interface{} { return int32(e.Attempt) }},
+	{"transaction_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.TransactionID }},
+	{"tracer", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Tracer }},
+	{"hostname", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Hostname }},
+	{"pid", parquetInt64, -1, func(e *GormEvent) interface{} { return int64(e.PID) }},
+	{"service", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.Service }},
+	{"service_version", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.ServiceVersion }},
+	{"request_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.RequestID }},
+	{"trace_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.TraceID }},
+	{"user_id", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return e.UserID }},
+	{"tags", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Tags) }},
+	{"fields", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Fields) }},
+	{"violation", parquetByteArray, parquetUTF8, func(e *GormEvent) interface{} { return parquetJSON(e.Violation) }},
+}
+
+type parquetChunk struct {
+	offset           int64
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+// encodeParquet writes rows as a Parquet file with a single row group and
+// one PLAIN encoded data page per column.
+func encodeParquet(rows []*GormEvent, compress bool) ([]byte, error) {
+	codec := int32(parquetUncompressed)
+	if compress {
+		codec = parquetGzip
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("PAR1")
+
+	chunks := make([]parquetChunk, len(parquetColumns))
+	for i, col := range parquetColumns {
+		values := parquetPlainValues(col, rows)
+
+		data := values
+		if compress {
+			var gz bytes.Buffer
+			w := gzip.NewWriter(&gz)
+			w.Write(values)
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			data = gz.Bytes()
+		}
+
+		var header thriftCompact
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(data)))
+		header.structBegin(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.structEnd()
+		header.stop()
+
+		chunks[i] = parquetChunk{
+			offset:           int64(buf.Len()),
+			uncompressedSize: int64(len(header.buf) + len(values)),
+			compressedSize:   int64(len(header.buf) + len(data)),
+		}
+		buf.Write(header.buf)
+		buf.Write(data)
+	}
+
+	meta := parquetFileMetaData(rows, chunks, codec)
+	buf.Write(meta)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(meta)))
+	buf.WriteString("PAR1")
+	return buf.Bytes(), nil
+}
+
+func parquetPlainValues(col parquetColumn, rows []*GormEvent) []byte {
+	var buf bytes.Buffer
+	var bits []byte
+	for i, e := range rows {
+		switch v := col.value(e).(type) {
+		case int32:
+			binary.Write(&buf, binary.LittleEndian, v)
+		case int64:
+			binary.Write(&buf, binary.LittleEndian, v)
+		case string:
+			binary.Write(&buf, binary.LittleEndian, uint32(len(v)))
+			buf.WriteString(v)
+		case bool:
+			// Booleans are bit packed, least significant bit first.
+			if i%8 == 0 {
+				bits = append(bits, 0)
+			}
+			if v {
+				bits[i/8] |= 1 << uint(i%8)
+			}
+		}
+	}
+	if col.typ == parquetBoolean {
+		return bits
+	}
+	return buf.Bytes()
+}
+
+func parquetFileMetaData(rows []*GormEvent, chunks []parquetChunk, codec int32) []byte {
+	var t thriftCompact
+	t.i32(1, 1)
+
+	t.listBegin(2, thriftStruct, len(parquetColumns)+1)
+	t.elemBegin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(parquetColumns)))
+	t.elemEnd()
+	for _, col := range parquetColumns {
+		t.elemBegin()
+		t.i32(1, col.typ)
+		t.i32(3, parquetRequired)
+		t.binary(4, col.name)
+		if col.converted >= 0 {
+			t.i32(6, col.converted)
+		}
+		t.elemEnd()
+	}
+
+	t.i64(3, int64(len(rows)))
+
+	var totalSize int64
+	for _, c := range chunks {
+		totalSize += c.uncompressedSize
+	}
+
+	t.listBegin(4, thriftStruct, 1)
+	t.elemBegin()
+	t.listBegin(1, thriftStruct, len(chunks))
+	for i, col := range parquetColumns {
+		c := chunks[i]
+		t.elemBegin()
+		t.i64(2, c.offset)
+		t.structBegin(3)
+		t.i32(1, col.typ)
+		t.listBegin(2, thriftI32, 2)
+		t.varint(int64(parquetPlain))
+		t.varint(int64(parquetRLE))
+		t.listBegin(3, thriftBinary, 1)
+		t.rawBinary(col.name)
+		t.i32(4, codec)
+		t.i64(5, int64(len(rows)))
+		t.i64(6, c.uncompressedSize)
+		t.i64(7, c.compressedSize)
+		t.i64(9, c.offset)
+		t.structEnd()
+		t.elemEnd()
+	}
+	t.i64(2, totalSize)
+	t.i64(3, int64(len(rows)))
+	t.elemEnd()
+
+	t.binary(6, "gormsanity")
+	t.stop()
+	return t.buf
+}
+
+// Thrift compact protocol type ids.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftCompact is a minimal Thrift compact protocol encoder, just enough
+// to write Parquet metadata.
+type thriftCompact struct {
+	buf   []byte
+	last  int16
+	stack []int16
+}
+
+func (t *thriftCompact) fieldHeader(id int16, typ byte) {
+	if delta := id - t.last; delta > 0 && delta <= 15 {
+		t.buf = append(t.buf, byte(delta)<<4|typ)
+	} else {
+		t.buf = append(t.buf, typ)
+		t.varint(int64(id))
+	}
+	t.last = id
+}
+
+func (t *thriftCompact) varint(n int64) {
+	t.uvarint(uint64((n << 1) ^ (n >> 63)))
+}
+
+func (t *thriftCompact) uvarint(n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf = append(t.buf, b[:binary.PutUvarint(b[:], n)]...)
+}
+
+func (t *thriftCompact) i32(id int16, n int32) {
+	t.fieldHeader(id, thriftI32)
+	t.varint(int64(n))
+}
+
+func (t *thriftCompact) i64(id int16, n int64) {
+	t.fieldHeader(id, thriftI64)
+	t.varint(n)
+}
+
+func (t *thriftCompact) binary(id int16, s string) {
+	t.fieldHeader(id, thriftBinary)
+	t.rawBinary(s)
+}
+
+func (t *thriftCompact) rawBinary(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf = append(t.buf, s...)
+}
+
+func (t *thriftCompact) listBegin(id int16, elemType byte, n int) {
+	t.fieldHeader(id, thriftList)
+	if n < 15 {
+		t.buf = append(t.buf, byte(n)<<4|elemType)
+	} else {
+		t.buf = append(t.buf, 0xf0|elemType)
+		t.uvarint(uint64(n))
+	}
+}
+
+func (t *thriftCompact) structBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.elemBegin()
+}
+
+func (t *thriftCompact) structEnd() {
+	t.elemEnd()
+}
+
+// elemBegin starts a struct that's a list element, which has no field
+// header of its own.
+func (t *thriftCompact) elemBegin() {
+	t.stack = append(t.stack, t.last)
+	t.last = 0
+}
+
+func (t *thriftCompact) elemEnd() {
+	t.stop()
+	t.last = t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+}
+
+func (t *thriftCompact) stop() {
+	t.buf = append(t.buf, 0)
+}
@@ -0,0 +1,177 @@
+package trace
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParquetSink_PartitionsByHour(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 8, 1, 13, 59, 0, 0, time.UTC)
+	sink := NewParquetSink(dir)
+	a.NoError(sink.Write(&GormEvent{StartTime: start, EventType: "query", IsComplete: true}))
+	a.NoError(sink.Write(&GormEvent{StartTime: start.Add(30 * time.Second), EventType: "update"}))
+	a.NoError(sink.Write(&GormEvent{StartTime: start.Add(2 * time.Minute), EventType: "delete"}))
+	a.NoError(sink.Close())
+
+	for hour, eventTypes := range map[string][]string{
+		"13": {"query", "update"},
+		"14": {"delete"},
+	} {
+		files, err := filepath.Glob(filepath.Join(dir, "dt=2020-08-01", "hour="+hour, "events-*.parquet"))
+		a.NoError(err)
+		a.Len(files, 1)
+
+		bs, err := ioutil.ReadFile(files[0])
+		a.NoError(err)
+		a.Equal("PAR1", string(bs[:4]))
+		a.Equal("PAR1", string(bs[len(bs)-4:]))
+
+		footerLen := int(binary.LittleEndian.Uint32(bs[len(bs)-8:]))
+		meta := readThriftStruct(&thriftReader{buf: bs[len(bs)-8-footerLen : len(bs)-8]})
+		a.Equal(int64(len(eventTypes)), meta[3], "num_rows")
+
+		schema := meta[2].([]interface{})
+		a.Len(schema, len(parquetColumns)+1)
+		a.Equal("schema", schema[0].(map[int16]interface{})[4])
+		a.Equal("event_id", schema[2].(map[int16]interface{})[4])
+
+		rowGroup := meta[4].([]interface{})[0].(map[int16]interface{})
+		a.Equal(int64(len(eventTypes)), rowGroup[3])
+
+		var values []string
+		for _, chunk := range rowGroup[1].([]interface{}) {
+			chunkMeta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			if chunkMeta[3].([]interface{})[0] != "event_type" {
+				continue
+			}
+			a.Equal(int64(parquetByteArray), chunkMeta[1])
+			a.Equal(int64(len(eventTypes)), chunkMeta[5])
+
+			r := &thriftReader{buf: bs[chunkMeta[9].(int64):]}
+			page := readThriftStruct(r)
+			a.Equal(int64(len(eventTypes)), page[5].(map[int16]interface{})[1])
+			data := r.buf[:page[3].(int64)]
+			for len(data) > 0 {
+				n := binary.LittleEndian.Uint32(data)
+				values = append(values, string(data[4:4+n]))
+				data = data[4+n:]
+			}
+		}
+		a.Equal(eventTypes, values)
+	}
+}
+
+func TestParquetSink_FlushInterval(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	start := time.Date(2020, 8, 1, 13, 0, 0, 0, time.UTC)
+	files := func() []string {
+		files, err := filepath.Glob(filepath.Join(dir, "dt=2020-08-01", "hour=13", "events-*.parquet"))
+		a.NoError(err)
+		return files
+	}
+
+	sink := NewParquetSink(dir)
+	sink.RowGroupSize = 0
+	sink.FlushInterval = 10 * time.Millisecond
+	a.NoError(sink.Write(&GormEvent{StartTime: start, EventType: "query"}))
+	a.NoError(sink.Write(&GormEvent{StartTime: start, EventType: "update"}))
+	a.Eventually(func() bool { return len(files()) == 1 }, time.Second, 5*time.Millisecond,
+		"buffered events are written without waiting for a full row group")
+	a.NoError(sink.Close())
+	a.Len(files(), 1)
+}
+
+// thriftReader decodes just enough of the Thrift compact protocol to read
+// back Parquet metadata in tests. Structs decode to maps keyed by field id,
+// integers to int64 and binaries to strings.
+type thriftReader struct {
+	buf []byte
+}
+
+func (r *thriftReader) uvarint() uint64 {
+	n, size := binary.Uvarint(r.buf)
+	r.buf = r.buf[size:]
+	return n
+}
+
+func (r *thriftReader) varint() int64 {
+	n := r.uvarint()
+	return int64(n>>1) ^ -int64(n&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 4, thriftI32, thriftI64:
+		return r.varint()
+	case thriftBinary:
+		n := r.uvarint()
+		s := string(r.buf[:n])
+		r.buf = r.buf[n:]
+		return s
+	case thriftList:
+		header := r.buf[0]
+		r.buf = r.buf[1:]
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case thriftStruct:
+		return readThriftStruct(r)
+	}
+	panic("unsupported thrift type")
+}
+
+func readThriftStruct(r *thriftReader) map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var id int16
+	for {
+		header := r.buf[0]
+		r.buf = r.buf[1:]
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.varint())
+		}
+		fields[id] = r.value(header & 0x0f)
+	}
+}
+
+func TestThriftCompact(t *testing.T) {
+	var c thriftCompact
+	c.i32(1, -1)
+	c.i64(20, 300)
+	c.binary(21, "ab")
+	c.stop()
+
+	require.Equal(t, []byte{
+		0x15, 0x01, // field 1 i32, zigzag(-1)
+		0x06, 0x28, 0xd8, 0x04, // long form field 20 i64, zigzag(300)
+		0x18, 0x02, 'a', 'b', // field 21 binary
+		0x00,
+	}, c.buf)
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+// resultSize estimates the size of what a query scanned into its
+// destination: the number of columns of the model and the bytes held by
+// them across the rows returned. Strings and byte slices count their
+// length, other values their size in memory.
+func resultSize(scope *gorm.Scope) (columns int, bytes int64) {
+	if scope.Value == nil {
+		return 0, 0
+	}
+
+	var fields []*gorm.StructField
+	for _, f := range scope.GetModelStruct().StructFields {
+		if f.IsNormal && !f.IsIgnored {
+			fields = append(fields, f)
+		}
+	}
+
+	row := func(v reflect.Value) {
+		v = elem(v)
+		if v.Kind() != reflect.Struct {
+			return
+		}
+		for _, f := range fields {
+			bytes += valueSize(fieldByIndex(v, f.Struct.Index))
+		}
+	}
+
+	v := scope.IndirectValue()
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			row(v.Index(i))
+		}
+	case reflect.Struct:
+		if rowsReturned(scope) > 0 {
+			row(v)
+		}
+	}
+	return len(fields), bytes
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, stopping at nil embedded
+// pointers rather than panicking.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			if v = elem(v); v.Kind() != reflect.Struct {
+				return reflect.Value{}
+			}
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+func valueSize(v reflect.Value) int64 {
+	v = elem(v)
+	if !v.IsValid() {
+		return 0
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len())
+		}
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += valueSize(v.Index(i))
+		}
+		return n
+	}
+	return int64(v.Type().Size())
+}
@@ -0,0 +1,62 @@
+package trace
+
+import (
+	"container/list"
+	"sync/atomic"
+)
+
+// DefaultMaxPendingEvents bounds the events a tracer holds for operations
+// that haven't completed, see WithMaxPendingEvents.
+const DefaultMaxPendingEvents = 10000
+
+// pending tracks the keys of incomplete events, oldest first.
+type pending struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newPending() pending {
+	return pending{order: list.New(), elems: map[string]*list.Element{}}
+}
+
+// addEvent records e under key and evicts the events of operations that
+// have exceeded the pending limits, returning them to be written. Events
+// are turned away once the tracer is closed. The caller holds t.mu.
+func (t *Tracer) addEvent(key string, e *GormEvent) []*GormEvent {
+	if t.closed {
+		return nil
+	}
+	t.Events[key] = e
+	t.pending.elems[key] = t.pending.order.PushBack(key)
+
+	var evicted []*GormEvent
+	for front := t.pending.order.Front(); front != nil; front = t.pending.order.Front() {
+		oldest := t.Events[front.Value.(string)]
+		tooMany := t.maxPending > 0 && t.pending.order.Len() > t.maxPending
+		tooOld := t.maxPendingAge > 0 && e.StartTime.Sub(oldest.StartTime) > t.maxPendingAge
+		if !tooMany && !tooOld {
+			break
+		}
+		t.removeEvent(front.Value.(string))
+		evicted = append(evicted, oldest)
+	}
+	atomic.AddUint64(&t.evicted, uint64(len(evicted)))
+	return evicted
+}
+
+// removeEvent forgets the event recorded under key. The caller holds t.mu.
+func (t *Tracer) removeEvent(key string) {
+	if elem, ok := t.pending.elems[key]; ok {
+		t.pending.order.Remove(elem)
+		delete(t.pending.elems, key)
+	}
+	delete(t.Events, key)
+}
+
+// writeEvicted writes the events of operations that were given up on.
+func (t *Tracer) writeEvicted(events []*GormEvent) {
+	for _, e := range events {
+		e.end(t.clock.Now())
+		t.write(e)
+	}
+}
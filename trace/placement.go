@@ -0,0 +1,97 @@
+package trace
+
+import "github.com/jinzhu/gorm"
+
+// Placement positions one of the tracer's callbacks among the other
+// callbacks of an operation, which decides what work its timings include.
+type Placement struct {
+	before, after string
+	first, last   bool
+}
+
+// Before runs the callback before the one registered as name.
+func Before(name string) Placement {
+	return Placement{before: name}
+}
+
+// After runs the callback after the one registered as name.
+func After(name string) Placement {
+	return Placement{after: name}
+}
+
+// First runs the callback before gorm's own callbacks. Use Before to run it
+// ahead of another plugin's callbacks placed the same way.
+func First() Placement {
+	return Placement{first: true}
+}
+
+// Last runs the callback after gorm's own callbacks and those registered
+// before the tracer's.
+func Last() Placement {
+	return Placement{last: true}
+}
+
+// callbackPlacement positions the callbacks starting and completing an
+// event.
+type callbackPlacement struct {
+	start, complete Placement
+}
+
+// defaultPlacements time gorm's work on a statement, including its
+// transaction for writes.
+var defaultPlacements = map[string]callbackPlacement{
+	"create":    {After("gorm:begin_transaction"), After("gorm:commit_or_rollback_transaction")},
+	"row_query": {Before("gorm:row_query"), After("gorm:row_query")},
+	"query":     {Before("gorm:query"), After("gorm:after_query")},
+	"update":    {After("gorm:begin_transaction"), After("gorm:commit_or_rollback_transaction")},
+	"delete":    {After("gorm:begin_transaction"), After("gorm:commit_or_rollback_transaction")},
+}
+
+// firstCallbacks and lastCallbacks name gorm's first and last callback of
+// each event type.
+var (
+	firstCallbacks = map[string]string{
+		"create":    "gorm:begin_transaction",
+		"row_query": "gorm:row_query",
+		"query":     "gorm:query",
+		"update":    "gorm:assign_updating_attributes",
+		"delete":    "gorm:begin_transaction",
+	}
+	lastCallbacks = map[string]string{
+		"create":    "gorm:commit_or_rollback_transaction",
+		"row_query": "gorm:row_query",
+		"query":     "gorm:after_query",
+		"update":    "gorm:commit_or_rollback_transaction",
+		"delete":    "gorm:commit_or_rollback_transaction",
+	}
+)
+
+// placement returns where the callbacks of eventType are registered.
+func (t *Tracer) placement(eventType string) callbackPlacement {
+	if p, ok := t.placements[eventType]; ok {
+		return p
+	}
+	return defaultPlacements[eventType]
+}
+
+// register adds fn to cp as name at p.
+func (p Placement) register(cp *gorm.CallbackProcessor, eventType, name string, fn func(*gorm.Scope)) {
+	switch {
+	case p.first:
+		cp = cp.Before(firstCallbacks[eventType])
+	case p.last:
+		// Callbacks without an order run after those registered before
+		// them. Row query callbacks can't go without one.
+		if eventType == "row_query" {
+			cp = cp.After(lastCallbacks[eventType])
+		}
+	default:
+		if p.before != "" {
+			cp = cp.Before(p.before)
+		}
+		if p.after != "" {
+			cp = cp.After(p.after)
+		}
+	}
+	cp.Register(name, fn)
+}
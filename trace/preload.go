@@ -0,0 +1,83 @@
+package trace
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// preloadField is an association a query preloads, by the type of its rows.
+type preloadField struct {
+	typ  reflect.Type
+	path string
+}
+
+// preloadFields lists the associations scope's query preloads, including
+// those of the gorm:auto_preload setting, in the order gorm loads them.
+func preloadFields(scope *gorm.Scope) []preloadField {
+	var fields []preloadField
+	seen := map[string]bool{}
+	add := func(f *gorm.StructField, path string) reflect.Type {
+		typ := structType(f.Struct.Type)
+		if !seen[path] {
+			seen[path] = true
+			fields = append(fields, preloadField{typ, path})
+		}
+		return typ
+	}
+
+	if auto, ok := scope.Get("gorm:auto_preload"); ok {
+		if on, isBool := auto.(bool); !isBool || on {
+			for _, f := range scope.GetModelStruct().StructFields {
+				if f.Relationship != nil {
+					add(f, f.Name)
+				}
+			}
+		}
+	}
+
+	for _, schema := range preloadSchemas(scope) {
+		model := scope.GetModelStruct()
+		names := strings.Split(schema, ".")
+		for i, name := range names {
+			f := relationField(model, name)
+			if f == nil {
+				break
+			}
+			typ := add(f, strings.Join(names[:i+1], "."))
+			model = scope.New(reflect.New(typ).Interface()).GetModelStruct()
+		}
+	}
+	return fields
+}
+
+func relationField(model *gorm.ModelStruct, name string) *gorm.StructField {
+	for _, f := range model.StructFields {
+		if f.Name == name && f.Relationship != nil {
+			return f
+		}
+	}
+	return nil
+}
+
+// structType strips slices and pointers from the type of an association.
+func structType(typ reflect.Type) reflect.Type {
+	for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return typ
+}
+
+// takePreload returns the path of the association parent is preloading
+// into rows of typ, and forgets it so the next association of the same
+// type goes to the next query. The caller holds t.mu.
+func (parent *GormEvent) takePreload(typ reflect.Type) string {
+	for i, f := range parent.preloads {
+		if f.typ == typ {
+			parent.preloads = append(parent.preloads[:i:i], parent.preloads[i+1:]...)
+			return f.path
+		}
+	}
+	return ""
+}
@@ -0,0 +1,93 @@
+package trace
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+	ansiCyan   = "\x1b[36m"
+)
+
+// PrettyFormatter writes a single human readable line per event for local
+// development:
+//
+//	12:04:05.123    1.2ms query      accounts   SELECT * FROM "accounts" WHERE ... rows=3
+//
+// followed by indented lines for any errors and warnings.
+type PrettyFormatter struct {
+	// Color enables ANSI colors.
+	Color bool
+	// MaxQueryLen truncates queries longer than this. Zero never truncates.
+	MaxQueryLen int
+}
+
+// NewPrettyFormatter creates a formatter that colors its output when f is a
+// terminal and NO_COLOR isn't set.
+func NewPrettyFormatter(f *os.File) *PrettyFormatter {
+	return &PrettyFormatter{Color: isTerminal(f), MaxQueryLen: 120}
+}
+
+func isTerminal(f *os.File) bool {
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *PrettyFormatter) paint(color, s string) string {
+	if !p.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+func (p *PrettyFormatter) Format(event *GormEvent) ([]byte, error) {
+	var buf bytes.Buffer
+
+	duration := "-"
+	if event.IsComplete {
+		duration = formatDuration(event.EndTime.Sub(event.StartTime))
+	}
+
+	query := strings.Join(strings.Fields(event.Query), " ")
+	if p.MaxQueryLen > 0 && len(query) > p.MaxQueryLen {
+		query = query[:p.MaxQueryLen] + "..."
+	}
+
+	fmt.Fprintf(&buf, "%s %8s %s %-10s %s %s\n",
+		p.paint(ansiDim, event.StartTime.Format("15:04:05.000")),
+		duration,
+		p.paint(ansiCyan, fmt.Sprintf("%-10s", event.EventType)),
+		event.TableName,
+		query,
+		p.paint(ansiDim, fmt.Sprintf("rows=%d", event.RowsAffected)),
+	)
+
+	for _, err := range event.Errors {
+		fmt.Fprintf(&buf, "    %s\n", p.paint(ansiRed, "error: "+err.Error()))
+	}
+	for _, w := range event.Warnings {
+		fmt.Fprintf(&buf, "    %s\n", p.paint(ansiYellow, "warning: "+w))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return fmt.Sprintf("%.2fs", d.Seconds())
+	case d >= time.Millisecond:
+		return fmt.Sprintf("%.1fms", float64(d)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%dµs", d/time.Microsecond)
+}
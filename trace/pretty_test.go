@@ -0,0 +1,37 @@
+package trace
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrettyFormatter(t *testing.T) {
+	a := require.New(t)
+
+	start := time.Date(2020, 8, 1, 12, 4, 5, 123000000, time.UTC)
+	f := &PrettyFormatter{MaxQueryLen: 20}
+	out, err := f.Format(&GormEvent{
+		StartTime:    start,
+		EndTime:      start.Add(1500 * time.Microsecond),
+		IsComplete:   true,
+		EventType:    "query",
+		TableName:    "accounts",
+		Query:        "SELECT *\n  FROM \"accounts\" WHERE id = $1",
+		RowsAffected: 1,
+		Errors:       []error{errors.New("connection reset")},
+		Warnings:     []string{"no_where_clause"},
+	})
+	a.NoError(err)
+	a.Equal(`12:04:05.123    1.5ms query      accounts   SELECT * FROM "accou... rows=1
+    error: connection reset
+    warning: no_where_clause
+`, string(out))
+
+	f.Color = true
+	out, err = f.Format(&GormEvent{EventType: "query", Errors: []error{errors.New("boom")}})
+	a.NoError(err)
+	a.Contains(string(out), ansiRed+"error: boom"+ansiReset)
+}
@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+// primaryKeys returns the primary key values of the row a write affected,
+// by column, or nil when the model has none set. Keys are hashed with
+// hashKey when it's given.
+func primaryKeys(scope *gorm.Scope, hashKey []byte) map[string]interface{} {
+	if scope.Value == nil || scope.IndirectValue().Kind() != reflect.Struct {
+		return nil
+	}
+
+	var keys map[string]interface{}
+	for _, f := range scope.PrimaryFields() {
+		if f.IsBlank {
+			continue
+		}
+		if keys == nil {
+			keys = map[string]interface{}{}
+		}
+		v := f.Field.Interface()
+		if hashKey != nil {
+			mac := hmac.New(sha256.New, hashKey)
+			fmt.Fprint(mac, v)
+			v = hex.EncodeToString(mac.Sum(nil))
+		}
+		keys[f.DBName] = v
+	}
+	return keys
+}
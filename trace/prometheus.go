@@ -0,0 +1,68 @@
+package trace
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PrometheusCollector exposes the Metrics of tracers to Prometheus:
+//
+//	prometheus.MustRegister(trace.NewPrometheusCollector(tracer))
+//
+// Every series is labeled with the event type and table of the operations,
+// and with the name of the tracer, see New, as "tracer", since Prometheus
+// sets "instance" itself to the target scraped.
+type PrometheusCollector struct {
+	tracers []*Tracer
+
+	operations   *prometheus.Desc
+	errors       *prometheus.Desc
+	warnings     *prometheus.Desc
+	rowsAffected *prometheus.Desc
+	duration     *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*PrometheusCollector)(nil)
+
+// NewPrometheusCollector returns a collector for the metrics of tracers,
+// which should have different names.
+func NewPrometheusCollector(tracers ...*Tracer) *PrometheusCollector {
+	labels := []string{"tracer", "event_type", "table"}
+	return &PrometheusCollector{
+		tracers:      tracers,
+		operations:   prometheus.NewDesc("gormsanity_operations_total", "Operations completed.", labels, nil),
+		errors:       prometheus.NewDesc("gormsanity_errors_total", "Operations that failed.", labels, nil),
+		warnings:     prometheus.NewDesc("gormsanity_warnings_total", "Operations that broke a sanity rule.", labels, nil),
+		rowsAffected: prometheus.NewDesc("gormsanity_rows_affected_total", "Rows returned or changed by operations.", labels, nil),
+		duration:     prometheus.NewDesc("gormsanity_operation_duration_seconds", "Time operations took.", labels, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *PrometheusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.operations
+	ch <- c.errors
+	ch <- c.warnings
+	ch <- c.rowsAffected
+	ch <- c.duration
+}
+
+// Collect implements prometheus.Collector.
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, t := range c.tracers {
+		for _, op := range t.Metrics().Operations {
+			labels := []string{t.Name(), op.EventType, op.TableName}
+			ch <- prometheus.MustNewConstMetric(c.operations, prometheus.CounterValue, float64(op.Count), labels...)
+			ch <- prometheus.MustNewConstMetric(c.errors, prometheus.CounterValue, float64(op.Errors), labels...)
+			ch <- prometheus.MustNewConstMetric(c.warnings, prometheus.CounterValue, float64(op.Warnings), labels...)
+			ch <- prometheus.MustNewConstMetric(c.rowsAffected, prometheus.CounterValue, float64(op.RowsAffected), labels...)
+
+			buckets := map[float64]uint64{}
+			var cumulative uint64
+			for i, bound := range op.Duration.Bounds {
+				cumulative += op.Duration.Counts[i]
+				buckets[bound.Seconds()] = cumulative
+			}
+			ch <- prometheus.MustNewConstHistogram(c.duration, op.Duration.Count(), op.Duration.Sum.Seconds(), buckets, labels...)
+		}
+	}
+}
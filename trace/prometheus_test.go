@@ -0,0 +1,55 @@
+package trace
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestPrometheusCollector(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	fdb.fail = func(query string) error {
+		if strings.Contains(query, "missing") {
+			return errors.New("column does not exist")
+		}
+		return nil
+	}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, tracer := TraceDB(db, WithMetricsOnly(), WithName("primary"), WithClock(&stepClock{now: epoch, step: 20 * time.Millisecond}))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.Error(db.Where("missing = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	registry := prometheus.NewPedanticRegistry()
+	a.NoError(registry.Register(NewPrometheusCollector(tracer)))
+	a.NoError(testutil.GatherAndCompare(registry, strings.NewReader(`
+# HELP gormsanity_errors_total Operations that failed.
+# TYPE gormsanity_errors_total counter
+gormsanity_errors_total{event_type="query",table="accounts",tracer="primary"} 1
+# HELP gormsanity_operation_duration_seconds Time operations took.
+# TYPE gormsanity_operation_duration_seconds histogram
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.001"} 0
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.005"} 0
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.01"} 0
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.025"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.05"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.1"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.25"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="0.5"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="1"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="5"} 2
+gormsanity_operation_duration_seconds_bucket{event_type="query",table="accounts",tracer="primary",le="+Inf"} 2
+gormsanity_operation_duration_seconds_sum{event_type="query",table="accounts",tracer="primary"} 0.04
+gormsanity_operation_duration_seconds_count{event_type="query",table="accounts",tracer="primary"} 2
+`), "gormsanity_errors_total", "gormsanity_operation_duration_seconds"))
+	a.Equal(5, testutil.CollectAndCount(NewPrometheusCollector(tracer)))
+}
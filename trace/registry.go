@@ -0,0 +1,56 @@
+package trace
+
+import (
+	"database/sql"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+// GORM keeps callbacks per connection, shared by every handle derived from
+// it, but gives no way to tell which tracer registered them. The registry
+// remembers that by the connection's *sql.DB.
+var (
+	registryMu sync.Mutex
+	registry   = map[*sql.DB]*Tracer{}
+)
+
+func connection(db *gorm.DB) *sql.DB {
+	sqlDB, _ := db.CommonDB().(*sql.DB)
+	return sqlDB
+}
+
+// isTraced reports whether tracer callbacks are registered on db.
+func isTraced(db *gorm.DB) bool {
+	cb := db.Callback()
+	for _, cp := range []func() *gorm.CallbackProcessor{cb.Create, cb.RowQuery, cb.Query, cb.Update, cb.Delete} {
+		if cp().Get(trackScopeKey) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tracerOf returns the tracer whose callbacks are registered on db, or nil.
+func tracerOf(db *gorm.DB) *Tracer {
+	if !isTraced(db) {
+		return nil
+	}
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	return registry[connection(db)]
+}
+
+func register(db *gorm.DB, t *Tracer) {
+	if conn := connection(db); conn != nil {
+		registryMu.Lock()
+		registry[conn] = t
+		registryMu.Unlock()
+	}
+}
+
+func unregister(db *gorm.DB) {
+	registryMu.Lock()
+	delete(registry, connection(db))
+	registryMu.Unlock()
+}
@@ -0,0 +1,169 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+)
+
+// Reload re-reads the config file the tracer was created with, see
+// LoadConfig, and applies its sample rate, minimum duration, disabled
+// rules, rule severities and suppressions on top of those set in code,
+// with options or Tracer methods. Settings the file no longer sets go back
+// to those set in code. The rest of the config only takes effect when the
+// tracer is created.
+func (t *Tracer) Reload() error {
+	if t.configPath == "" {
+		return errors.New("gormsanity: tracer has no config file to reload")
+	}
+
+	cfg, err := readConfig(t.configPath)
+	if err != nil {
+		return err
+	}
+
+	if cfg.SampleRate != nil && (*cfg.SampleRate < 0 || *cfg.SampleRate > 1) {
+		return fmt.Errorf("gormsanity: %s: sample_rate %v is not between 0 and 1", t.configPath, *cfg.SampleRate)
+	}
+
+	var minDuration time.Duration
+	if cfg.MinDuration != "" {
+		if minDuration, err = time.ParseDuration(cfg.MinDuration); err != nil {
+			return fmt.Errorf("gormsanity: %s: min_duration: %v", t.configPath, err)
+		}
+	}
+
+	disabled, severities, err := cfg.ruleSettings()
+	if err != nil {
+		return fmt.Errorf("gormsanity: %s: %v", t.configPath, err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.configBase.rebase(t.reloadSettings(), t.configApplied)
+	s := t.configBase.copy()
+	if cfg.SampleRate != nil {
+		s.sample = *cfg.SampleRate
+	}
+	if cfg.MinDuration != "" {
+		s.minDuration = minDuration
+	}
+	for name, off := range disabled {
+		if off {
+			s.disabled[name] = true
+		} else {
+			delete(s.disabled, name)
+		}
+	}
+	for name, severity := range severities {
+		s.severities[name] = severity
+	}
+	s.suppressions = append(s.suppressions, cfg.Suppress...)
+
+	t.sample = s.sample
+	t.minDuration = s.minDuration
+	t.disabledRules = s.disabled
+	t.severities = s.severities
+	t.suppressions = s.suppressions
+	t.configApplied = t.reloadSettings()
+	return nil
+}
+
+// reloadSettings are the settings Reload changes.
+type reloadSettings struct {
+	sample       float64
+	minDuration  time.Duration
+	disabled     map[string]bool
+	severities   map[string]Severity
+	suppressions []Suppression
+}
+
+// reloadSettings copies the tracer's current settings. t.mu must be held
+// once the tracer is in use.
+func (t *Tracer) reloadSettings() reloadSettings {
+	s := reloadSettings{
+		sample:       t.sample,
+		minDuration:  t.minDuration,
+		disabled:     t.disabledRules,
+		severities:   t.severities,
+		suppressions: t.suppressions,
+	}
+	return s.copy()
+}
+
+func (s reloadSettings) copy() reloadSettings {
+	c := s
+	c.disabled = map[string]bool{}
+	for name, off := range s.disabled {
+		if off {
+			c.disabled[name] = true
+		}
+	}
+	c.severities = map[string]Severity{}
+	for name, severity := range s.severities {
+		c.severities[name] = severity
+	}
+	c.suppressions = append([]Suppression(nil), s.suppressions...)
+	return c
+}
+
+// rebase records in s the changes made in code since applied, the
+// settings of the config file, was applied, giving current.
+func (s *reloadSettings) rebase(current, applied reloadSettings) {
+	if current.sample != applied.sample {
+		s.sample = current.sample
+	}
+	if current.minDuration != applied.minDuration {
+		s.minDuration = current.minDuration
+	}
+	for name := range current.disabled {
+		if !applied.disabled[name] {
+			s.disabled[name] = true
+		}
+	}
+	for name := range applied.disabled {
+		if !current.disabled[name] {
+			delete(s.disabled, name)
+		}
+	}
+	for name := range current.severities {
+		if current.severities[name] != applied.severities[name] {
+			s.severities[name] = current.severities[name]
+		}
+	}
+	for name := range applied.severities {
+		if _, ok := current.severities[name]; !ok {
+			delete(s.severities, name)
+		}
+	}
+	// Suppressions are only ever added.
+	if len(current.suppressions) > len(applied.suppressions) {
+		s.suppressions = append(s.suppressions, current.suppressions[len(applied.suppressions):]...)
+	}
+}
+
+// ReloadOnSignal reloads the tracer's config whenever one of sigs, usually
+// syscall.SIGHUP, is received, until the tracer is closed. Errors are
+// reported like other configuration problems, see OnError.
+func (t *Tracer) ReloadOnSignal(sigs ...os.Signal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	t.stopReload = append(t.stopReload, func() { signal.Stop(c); close(c) })
+
+	go func() {
+		for range c {
+			if err := t.Reload(); err != nil {
+				t.reportConfigErrors([]error{err})
+			}
+		}
+	}()
+}
@@ -0,0 +1,98 @@
+package trace
+
+import (
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracer_Reload(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, "gormsanity.yaml", "sample_rate: 0.5\nmin_duration: 50ms\nsinks: [{type: stdout}]\n")
+	opt, err := LoadConfig(path)
+	a.NoError(err)
+	tracer := New("", opt)
+	defer tracer.Close()
+
+	writeConfig(t, dir, "gormsanity.yaml", "sample_rate: 0.1\ndisable_rules: [no_where_clause]\nrules: {slow_query: {severity: info}}\n")
+	a.NoError(tracer.Reload())
+	a.Equal(0.1, tracer.sample)
+	a.Zero(tracer.minDuration)
+	a.Equal(map[string]bool{"no_where_clause": true}, tracer.disabledRules)
+	a.Equal(SeverityInfo, tracer.severity("slow_query"))
+
+	writeConfig(t, dir, "gormsanity.yaml", "min_duration: soon\n")
+	a.Error(tracer.Reload())
+	a.Equal(0.1, tracer.sample, "invalid configs are not applied")
+
+	a.Error(New("", WithStdout()).Reload(), "no config file")
+}
+
+func TestTracer_ReloadKeepsCodeSettings(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	known := Suppression{Rule: "n_plus_one", Caller: "reports/export.go"}
+	path := writeConfig(t, dir, "gormsanity.yaml", "min_duration: 50ms\ndisable_rules: [no_where_clause]\nsinks: [{type: stdout}]\n")
+	opt, err := LoadConfig(path)
+	a.NoError(err)
+	tracer := New("", WithoutRules("hard_delete"), opt, WithSampleRate(0.2), WithSuppressions(known))
+	defer tracer.Close()
+
+	writeConfig(t, dir, "gormsanity.yaml", "min_duration: 10ms\n")
+	a.NoError(tracer.Reload())
+	a.Equal(0.2, tracer.sample)
+	a.Equal(10*time.Millisecond, tracer.minDuration)
+	a.Equal(map[string]bool{"hard_delete": true}, tracer.disabledRules, "rules the file no longer turns off are back on")
+	a.Equal([]Suppression{known}, tracer.suppressions)
+
+	// Settings the file sets win, and changes made since in code are kept.
+	tracer.SetSampleRate(0.7)
+	writeConfig(t, dir, "gormsanity.yaml", "rules: {hard_delete: {enabled: true}}\nsuppress: [{rule: select_star}]\n")
+	a.NoError(tracer.Reload())
+	a.Equal(0.7, tracer.sample)
+	a.Zero(tracer.minDuration)
+	a.Empty(tracer.disabledRules)
+	a.Equal([]Suppression{known, {Rule: "select_star"}}, tracer.suppressions)
+
+	writeConfig(t, dir, "gormsanity.yaml", "sample_rate: 0.1\n")
+	a.NoError(tracer.Reload())
+	a.Equal(0.1, tracer.sample)
+	a.Equal(map[string]bool{"hard_delete": true}, tracer.disabledRules)
+	a.Equal([]Suppression{known}, tracer.suppressions)
+}
+
+func TestTracer_ReloadOnSignal(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfig(t, dir, "gormsanity.yaml", "sample_rate: 0.5\nsinks: [{type: stdout}]\n")
+	opt, err := LoadConfig(path)
+	a.NoError(err)
+	tracer := New("", opt)
+	defer tracer.Close()
+	tracer.ReloadOnSignal(syscall.SIGHUP)
+
+	writeConfig(t, dir, "gormsanity.yaml", "sample_rate: 0.2\n")
+	p, err := os.FindProcess(os.Getpid())
+	a.NoError(err)
+	a.NoError(p.Signal(syscall.SIGHUP))
+
+	a.Eventually(func() bool {
+		tracer.mu.Lock()
+		defer tracer.mu.Unlock()
+		return tracer.sample == 0.2
+	}, time.Second, 10*time.Millisecond)
+}
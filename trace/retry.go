@@ -0,0 +1,35 @@
+package trace
+
+import "github.com/jinzhu/gorm"
+
+// AttemptKey is the scope setting numbering the attempts of an operation
+// that's retried, such as after a serialization failure, from 1, so its
+// events tell retries apart from independent operations:
+//
+//	for attempt := 1; ; attempt++ {
+//		err := trace.Attempt(db, attempt).Save(&account).Error
+//		...
+//	}
+//
+// The attempt can also be stored in the context bound with WithContext,
+// under AttemptContextKey.
+const AttemptKey = "gormsanity:attempt"
+
+// AttemptContextKey is the context key the attempt of an operation is read
+// from when it isn't set on the scope, see AttemptKey.
+const AttemptContextKey contextKey = "gormsanity.attempt"
+
+// Attempt returns a handle of db whose operations are recorded as attempt
+// n of a retry loop.
+func Attempt(db *gorm.DB, n int) *gorm.DB {
+	return db.Set(AttemptKey, n)
+}
+
+func attemptOf(scope *gorm.Scope) int {
+	if v, ok := scope.Get(AttemptKey); ok {
+		if n, ok := v.(int); ok {
+			return n
+		}
+	}
+	return 0
+}
@@ -0,0 +1,72 @@
+package trace
+
+import "sync"
+
+// RingSink keeps the most recent events in memory, discarding the oldest
+// once it holds its capacity. It's meant for crash dumps and debug
+// endpoints that want the last few queries without writing to disk.
+type RingSink struct {
+	mu    sync.Mutex
+	buf   []*GormEvent
+	start int
+	n     int
+}
+
+// NewRingSink creates a sink holding the last n events.
+func NewRingSink(n int) *RingSink {
+	if n < 1 {
+		n = 1
+	}
+	return &RingSink{buf: make([]*GormEvent, n)}
+}
+
+func (s *RingSink) Write(event *GormEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.n < len(s.buf) {
+		s.buf[(s.start+s.n)%len(s.buf)] = event
+		s.n++
+		return nil
+	}
+	s.buf[s.start] = event
+	s.start = (s.start + 1) % len(s.buf)
+	return nil
+}
+
+func (s *RingSink) Flush() error {
+	return nil
+}
+
+func (s *RingSink) Close() error {
+	return nil
+}
+
+// Events returns the buffered events, oldest first, leaving them in the
+// buffer.
+func (s *RingSink) Events() []*GormEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.events()
+}
+
+// Drain returns the buffered events, oldest first, and empties the buffer.
+func (s *RingSink) Drain() []*GormEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := s.events()
+	for i := range s.buf {
+		s.buf[i] = nil
+	}
+	s.start, s.n = 0, 0
+	return events
+}
+
+func (s *RingSink) events() []*GormEvent {
+	events := make([]*GormEvent, s.n)
+	for i := range events {
+		events[i] = s.buf[(s.start+i)%len(s.buf)]
+	}
+	return events
+}
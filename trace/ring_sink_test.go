@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestRingSink(t *testing.T) {
+	a := require.New(t)
+	sink := NewRingSink(3)
+	a.Empty(sink.Events())
+
+	queries := func(events []*GormEvent) []string {
+		var qs []string
+		for _, e := range events {
+			qs = append(qs, e.Query)
+		}
+		return qs
+	}
+
+	for _, q := range []string{"a", "b"} {
+		a.NoError(sink.Write(&GormEvent{Query: q}))
+	}
+	a.Equal([]string{"a", "b"}, queries(sink.Events()))
+
+	for _, q := range []string{"c", "d", "e"} {
+		a.NoError(sink.Write(&GormEvent{Query: q}))
+	}
+	a.Equal([]string{"c", "d", "e"}, queries(sink.Events()))
+	a.Equal([]string{"c", "d", "e"}, queries(sink.Drain()))
+	a.Empty(sink.Events())
+
+	a.NoError(sink.Write(&GormEvent{Query: "f"}))
+	a.Equal([]string{"f"}, queries(sink.Events()))
+}
+
+func TestRingSink_TraceDB(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := NewRingSink(10)
+
+	db, tracer := TraceDB(db, WithTest(t), WithSink(sink), WithoutRules("no_where_clause", "zero_insert_value"))
+	var accounts []models.Account
+	a.NoError(db.Find(&accounts).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 1)
+	a.Equal("query", events[0].EventType)
+}
@@ -0,0 +1,162 @@
+package trace
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Matcher selects the events a route applies to.
+type Matcher func(*GormEvent) bool
+
+// MatchEventType matches events of any of the given types, e.g. "query".
+func MatchEventType(types ...string) Matcher {
+	return func(e *GormEvent) bool {
+		for _, typ := range types {
+			if e.EventType == typ {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchErrors matches events whose statement failed.
+func MatchErrors() Matcher {
+	return func(e *GormEvent) bool {
+		return len(e.Errors) > 0
+	}
+}
+
+// MatchWarnings matches events that broke a sanity rule.
+func MatchWarnings() Matcher {
+	return func(e *GormEvent) bool {
+		return len(e.Warnings) > 0
+	}
+}
+
+// MatchViolations matches the violations found by the tracer's detectors,
+// see Violation.
+func MatchViolations() Matcher {
+	return func(e *GormEvent) bool {
+		return e.Violation != nil
+	}
+}
+
+// MatchSeverity matches violations at least as serious as min.
+func MatchSeverity(min Severity) Matcher {
+	return func(e *GormEvent) bool {
+		return e.Violation != nil && e.Violation.Severity.rank() >= min.rank()
+	}
+}
+
+// MatchSlowerThan matches completed events that took longer than d.
+func MatchSlowerThan(d time.Duration) Matcher {
+	return func(e *GormEvent) bool {
+		return e.IsComplete && e.EndTime.Sub(e.StartTime) > d
+	}
+}
+
+// MatchAny matches events matched by any of matchers.
+func MatchAny(matchers ...Matcher) Matcher {
+	return func(e *GormEvent) bool {
+		for _, m := range matchers {
+			if m(e) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// RouterSink dispatches each event to the sinks of every route matching
+// it, so different kinds of events can go to different places:
+//
+//	sink := trace.NewRouterSink().
+//		Route(trace.MatchEventType("query"), fileSink).
+//		Route(trace.MatchAny(trace.MatchErrors(), trace.MatchWarnings()), alertSink)
+//
+// A sink on several matching routes receives the event once, provided it's
+// comparable, as pointers are; sinks that aren't, such as struct values
+// holding a map, receive it once per route. Events matching no route are
+// discarded. As with MultiSink a failing sink doesn't stop the others.
+// Routes must be added before the first event is written.
+type RouterSink struct {
+	routes []route
+	sinks  []Sink
+}
+
+type route struct {
+	match Matcher
+	sinks []int
+}
+
+// NewRouterSink creates a sink without any routes.
+func NewRouterSink() *RouterSink {
+	return &RouterSink{}
+}
+
+// Route sends events matched by match to sinks.
+func (r *RouterSink) Route(match Matcher, sinks ...Sink) *RouterSink {
+	rt := route{match: match}
+	for _, s := range sinks {
+		rt.sinks = append(rt.sinks, r.index(s))
+	}
+	r.routes = append(r.routes, rt)
+	return r
+}
+
+// index returns the position of sink among the routed sinks, adding it if
+// new. Sinks of types that can't be compared, such as structs holding maps,
+// are added anew each time, as == would panic on them.
+func (r *RouterSink) index(sink Sink) int {
+	if reflect.TypeOf(sink).Comparable() {
+		for i, s := range r.sinks {
+			if s == sink {
+				return i
+			}
+		}
+	}
+	r.sinks = append(r.sinks, sink)
+	return len(r.sinks) - 1
+}
+
+func (r *RouterSink) Write(event *GormEvent) error {
+	matched := make([]bool, len(r.sinks))
+	for _, rt := range r.routes {
+		if !rt.match(event) {
+			continue
+		}
+		for _, i := range rt.sinks {
+			matched[i] = true
+		}
+	}
+
+	var errs SinkErrors
+	for i, s := range r.sinks {
+		if !matched[i] {
+			continue
+		}
+		if err := s.Write(event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d (%T): %w", i, s, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// Dropped returns the number of events dropped by the routed sinks that
+// discard events.
+func (r *RouterSink) Dropped() uint64 {
+	return NewMultiSink(r.sinks...).Dropped()
+}
+
+func (r *RouterSink) Flush() error {
+	return NewMultiSink(r.sinks...).Flush()
+}
+
+func (r *RouterSink) Close() error {
+	return NewMultiSink(r.sinks...).Close()
+}
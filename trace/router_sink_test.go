@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestRouterSink(t *testing.T) {
+	a := require.New(t)
+	queries, alerts, slow := &memorySink{}, &memorySink{}, &memorySink{}
+
+	sink := NewRouterSink().
+		Route(MatchEventType("query", "row_query"), queries).
+		Route(MatchErrors(), alerts).
+		Route(MatchWarnings(), alerts).
+		Route(MatchSlowerThan(time.Second), slow)
+
+	start := time.Now()
+	events := []*GormEvent{
+		{EventType: "query", StartTime: start, EndTime: start.Add(time.Millisecond), IsComplete: true},
+		{EventType: "create", Errors: []error{errors.New("duplicate key")}, Warnings: []string{"insert_with_blanks"}},
+		{EventType: "update", StartTime: start, EndTime: start.Add(2 * time.Second), IsComplete: true},
+		{EventType: "delete"},
+	}
+	for _, e := range events {
+		a.NoError(sink.Write(e))
+	}
+
+	a.Equal(events[:1], queries.Events())
+	a.Equal(events[1:2], alerts.Events(), "routes sharing a sink deliver once")
+	a.Equal(events[2:3], slow.Events())
+
+	a.NoError(sink.Close())
+	a.True(queries.closed)
+	a.True(alerts.closed)
+	a.True(slow.closed)
+}
+
+// mapSink is a sink that can't be compared with ==.
+type mapSink struct {
+	counts map[string]int
+}
+
+func (s mapSink) Write(e *GormEvent) error { s.counts[e.EventType]++; return nil }
+func (s mapSink) Flush() error             { return nil }
+func (s mapSink) Close() error             { return nil }
+
+func TestRouterSink_UncomparableSink(t *testing.T) {
+	a := require.New(t)
+	counts := mapSink{counts: map[string]int{}}
+
+	sink := NewRouterSink().
+		Route(MatchEventType("query"), counts).
+		Route(MatchErrors(), counts)
+	a.NoError(sink.Write(&GormEvent{EventType: "query"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "create", Errors: []error{errors.New("boom")}}))
+	a.Equal(map[string]int{"query": 1, "create": 1}, counts.counts)
+}
+
+func TestRouterSink_Errors(t *testing.T) {
+	a := require.New(t)
+	bad, good := &failingSink{}, &memorySink{}
+
+	sink := NewRouterSink().Route(MatchAny(MatchEventType("create"), MatchErrors()), bad, good)
+	err := sink.Write(&GormEvent{EventType: "create"})
+	a.Error(err)
+	a.Len(err.(SinkErrors), 1)
+	a.Len(good.Events(), 1)
+}
+
+func TestTraceDB_WithRouterSink(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	queries, writes := &memorySink{}, &memorySink{}
+
+	sink := NewRouterSink().
+		Route(MatchEventType("query"), queries).
+		Route(MatchEventType("create", "update", "delete"), writes)
+
+	db, tracer := TraceDB(db, WithTest(t), WithSink(sink))
+	a.NoError(db.Create(&models.Account{EmailAddress: "route@acme.com", Status: models.Status_Active}).Error)
+	var accounts []models.Account
+	a.NoError(db.Where("organization_id = ?", "acme").Find(&accounts).Error)
+	tracer.Close()
+
+	a.Len(queries.Events(), 1)
+	a.Len(writes.Events(), 1)
+	a.Equal("create", writes.Events()[0].EventType)
+}
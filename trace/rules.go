@@ -0,0 +1,138 @@
+package trace
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity ranks how serious breaking a rule is, see WithRuleSeverity.
+type Severity string
+
+const (
+	// SeverityInfo marks advice, such as a query that could be cheaper.
+	SeverityInfo Severity = "info"
+	// SeverityWarn marks what is likely a problem, such as an N+1.
+	SeverityWarn Severity = "warn"
+	// SeverityError marks what is almost certainly a bug, such as an
+	// update of every row of a table.
+	SeverityError Severity = "error"
+)
+
+// rank orders severities, unknown ones ranking lowest.
+func (s Severity) rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityWarn:
+		return 2
+	case SeverityError:
+		return 3
+	}
+	return 0
+}
+
+func parseSeverity(s string) (Severity, error) {
+	switch v := Severity(strings.ToLower(s)); v {
+	case SeverityInfo, SeverityWarn, SeverityError:
+		return v, nil
+	}
+	return "", fmt.Errorf("expected %q, %q or %q", SeverityInfo, SeverityWarn, SeverityError)
+}
+
+// defaultSeverities are the severities of the rules the tracer knows, by
+// ID.
+var defaultSeverities = map[string]Severity{
+	"no_where_clause":      SeverityInfo,
+	"no_where_update":      SeverityError,
+	"no_where_delete":      SeverityError,
+	"zero_insert_value":    SeverityInfo,
+	"n_plus_one":           SeverityWarn,
+	"slow_query":           SeverityWarn,
+	"select_star":          SeverityInfo,
+	"unbounded_read":       SeverityWarn,
+	"duplicate_query":      SeverityInfo,
+	"long_transaction":     SeverityWarn,
+	"implicit_transaction": SeverityInfo,
+	"unindexed_filter":     SeverityWarn,
+	"unindexed_sort":       SeverityWarn,
+	"large_in_list":        SeverityWarn,
+	"cross_join":           SeverityError,
+	"hard_delete":          SeverityWarn,
+	"loop_query":           SeverityWarn,
+	"ignored_error":        SeverityError,
+	"leaked_rows":          SeverityError,
+	"tx_done":              SeverityError,
+	"leading_wildcard":     SeverityWarn,
+	"zero_row_write":       SeverityWarn,
+	"full_count":           SeverityInfo,
+	"type_mismatch":        SeverityWarn,
+}
+
+// RuleInfo describes one of a tracer's sanity rules.
+type RuleInfo struct {
+	// ID names the rule, as in warnings, Violation.Rule and WithoutRules.
+	ID       string
+	Severity Severity
+	// Enabled is whether the rule is checked: rules taking settings are
+	// only checked once turned on by their options, and any rule can be
+	// turned off with WithoutRules.
+	Enabled bool
+}
+
+// Rules lists the rules the tracer knows, including those added with
+// WithRule, sorted by ID.
+func (t *Tracer) Rules() []RuleInfo {
+	active := map[string]bool{}
+	for _, r := range allGenericRules {
+		active[r.name] = true
+	}
+	for _, d := range t.detectors {
+		active[d.rule()] = true
+	}
+	if t.explain != nil {
+		active["unindexed_filter"] = true
+		active["unindexed_sort"] = true
+	}
+	if t.leakedRows != nil {
+		active["leaked_rows"] = true
+	}
+
+	ids := map[string]bool{}
+	for id := range defaultSeverities {
+		ids[id] = true
+	}
+	for id := range active {
+		ids[id] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var rules []RuleInfo
+	for id := range ids {
+		rules = append(rules, RuleInfo{
+			ID:       id,
+			Severity: t.severityLocked(id),
+			Enabled:  active[id] && !t.disabledRules[id],
+		})
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// severity is the severity of breaking rule.
+func (t *Tracer) severity(rule string) Severity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.severityLocked(rule)
+}
+
+func (t *Tracer) severityLocked(rule string) Severity {
+	if s, ok := t.severities[rule]; ok {
+		return s
+	}
+	if s, ok := defaultSeverities[rule]; ok {
+		return s
+	}
+	return SeverityWarn
+}
@@ -0,0 +1,54 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_Rules(t *testing.T) {
+	a := require.New(t)
+	tracer := New("", WithStdout(), WithLeadingWildcardDetection(), WithoutRules("hard_delete"), WithRuleSeverity("n_plus_one", SeverityError))
+
+	rules := map[string]RuleInfo{}
+	for _, r := range tracer.Rules() {
+		rules[r.ID] = r
+	}
+	a.Len(rules, len(defaultSeverities))
+	a.Equal(RuleInfo{"n_plus_one", SeverityError, true}, rules["n_plus_one"])
+	a.Equal(RuleInfo{"hard_delete", SeverityWarn, false}, rules["hard_delete"])
+	a.Equal(RuleInfo{"leading_wildcard", SeverityWarn, true}, rules["leading_wildcard"])
+	a.Equal(RuleInfo{"no_where_clause", SeverityInfo, true}, rules["no_where_clause"])
+	a.False(rules["slow_query"].Enabled, "needs a threshold")
+
+	tracer = New("", WithStdout(), WithoutRules("hard_delete", "tx_done"), WithRules("hard_delete"))
+	a.Equal(map[string]bool{"tx_done": true}, tracer.disabledRules)
+}
+
+func TestTracer_ViolationSeverity(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithRuleSeverity("hard_delete", SeverityInfo))
+	a.NoError(db.Unscoped().Delete(&testNote{ID: 1}).Error)
+	a.NoError(db.Model(&models.Account{}).UpdateColumn("status", "closed").Error)
+	tracer.Close()
+
+	var severities []Severity
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			severities = append(severities, e.Violation.Severity)
+		}
+	}
+	a.Equal([]Severity{SeverityInfo, SeverityError}, severities)
+
+	errors := MatchSeverity(SeverityError)
+	warnings := MatchSeverity(SeverityWarn)
+	a.True(errors(&GormEvent{Violation: &Violation{Severity: SeverityError}}))
+	a.False(errors(&GormEvent{Violation: &Violation{Severity: SeverityWarn}}))
+	a.True(warnings(&GormEvent{Violation: &Violation{Severity: SeverityWarn}}))
+	a.False(warnings(&GormEvent{}))
+}
@@ -0,0 +1,253 @@
+package trace
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ObjectUploader stores an object under key.
+type ObjectUploader interface {
+	Upload(key string, body []byte, contentType string) error
+}
+
+// S3Sink spools events to gzipped NDJSON chunks on local disk and uploads
+// them to object storage. A chunk is cut when it reaches ChunkSize bytes
+// and every UploadInterval, and pending chunks are uploaded at those times
+// and on Flush and Close. Chunks are only removed from the spool directory
+// once uploaded, so chunks left behind by a crashed process are uploaded by
+// the next one using the same directory.
+//
+// Objects are stored under <Prefix><YYYY>/<MM>/<DD>/<chunk file name>. The
+// configuration fields must be set before the first event is written.
+type S3Sink struct {
+	Prefix         string
+	ChunkSize      int64
+	UploadInterval time.Duration
+
+	uploader ObjectUploader
+	spool    *FileSink
+
+	once     sync.Once
+	stopOnce sync.Once
+	uploads  sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewS3Sink creates a sink spooling chunks in spoolDir and uploading them
+// with uploader. Chunks default to 8MiB and are uploaded at least once a
+// minute.
+func NewS3Sink(uploader ObjectUploader, spoolDir, prefix string) *S3Sink {
+	spool := NewFileSink(filepath.Join(spoolDir, "gorm.ndjson"))
+	spool.Compress = true
+	return &S3Sink{
+		Prefix:         prefix,
+		ChunkSize:      8 << 20,
+		UploadInterval: time.Minute,
+		uploader:       uploader,
+		spool:          spool,
+	}
+}
+
+func (s *S3Sink) start() {
+	s.once.Do(func() {
+		s.spool.MaxSize = s.ChunkSize
+		s.stop = make(chan struct{})
+		s.done = make(chan struct{})
+		go s.run()
+	})
+}
+
+func (s *S3Sink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.UploadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.Flush()
+		}
+	}
+}
+
+func (s *S3Sink) Write(event *GormEvent) error {
+	s.start()
+	return s.spool.Write(event)
+}
+
+// Flush cuts the current chunk and uploads every pending chunk.
+func (s *S3Sink) Flush() error {
+	if err := s.spool.Rotate(); err != nil {
+		return err
+	}
+	return s.upload()
+}
+
+func (s *S3Sink) upload() error {
+	s.uploads.Lock()
+	defer s.uploads.Unlock()
+
+	chunks, err := s.spool.RotatedFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		body, err := ioutil.ReadFile(chunk)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(chunk)
+		if err != nil {
+			return err
+		}
+
+		key := s.Prefix + info.ModTime().UTC().Format("2006/01/02/") + filepath.Base(chunk)
+		if err := s.uploader.Upload(key, body, "application/gzip"); err != nil {
+			return err
+		}
+		os.Remove(chunk)
+	}
+	return nil
+}
+
+func (s *S3Sink) Close() error {
+	s.start()
+	s.stopOnce.Do(func() { close(s.stop) })
+	<-s.done
+
+	err := s.Flush()
+	s.spool.Close()
+	return err
+}
+
+// S3Uploader uploads objects to S3 or an S3 compatible store (MinIO, R2,
+// GCS interop, ...) with path style requests signed with AWS Signature
+// Version 4.
+type S3Uploader struct {
+	// Endpoint is the base URL of the store, e.g.
+	// https://s3.us-east-1.amazonaws.com or http://localhost:9000.
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Client          *http.Client
+
+	now func() time.Time
+}
+
+func (u *S3Uploader) Upload(key string, body []byte, contentType string) error {
+	endpoint, err := url.Parse(u.Endpoint)
+	if err != nil {
+		return err
+	}
+	endpoint.Path = path.Join("/", endpoint.Path, u.Bucket, key)
+
+	req, err := http.NewRequest(http.MethodPut, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if u.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.SessionToken)
+	}
+
+	now := time.Now
+	if u.now != nil {
+		now = u.now
+	}
+	signV4(req, sha256Hex(body), u.Region, "s3", u.AccessKeyID, u.SecretAccessKey, now())
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("gormsanity: uploading %s: %s: %s", key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, signing the host and
+// every header already set on it.
+func signV4(req *http.Request, payloadHash, region, service, accessKey, secretKey string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
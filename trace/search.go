@@ -0,0 +1,182 @@
+package trace
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+// SearchClauses are the conditions an operation was built from, so the
+// shape of queries can be analyzed without parsing SQL.
+type SearchClauses struct {
+	Where    []SearchCondition `json:"where,omitempty"`
+	Or       []SearchCondition `json:"or,omitempty"`
+	Not      []SearchCondition `json:"not,omitempty"`
+	Having   []SearchCondition `json:"having,omitempty"`
+	Joins    []SearchCondition `json:"joins,omitempty"`
+	Select   string            `json:"select,omitempty"`
+	Omit     []string          `json:"omit,omitempty"`
+	Order    []string          `json:"order,omitempty"`
+	Group    string            `json:"group,omitempty"`
+	Preload  []string          `json:"preload,omitempty"`
+	Limit    string            `json:"limit,omitempty"`
+	Offset   string            `json:"offset,omitempty"`
+	Unscoped bool              `json:"unscoped,omitempty"`
+}
+
+// SearchCondition is one condition, as given to methods like Where. Query
+// is written with fmt when it isn't SQL, such as a struct or map.
+type SearchCondition struct {
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// searchClauses reads the clauses of scope's search, leaving out their
+// arguments when redact is set. gorm keeps them unexported, so they're
+// read with reflection, and nil is returned when there are none.
+func searchClauses(scope *gorm.Scope, redact bool) *SearchClauses {
+	if scope.Search == nil {
+		return nil
+	}
+	s := reflect.ValueOf(scope.Search).Elem()
+	field := func(name string) reflect.Value {
+		return s.FieldByName(name)
+	}
+	conditions := func(name string) []SearchCondition {
+		var conds []SearchCondition
+		list := field(name)
+		if !list.IsValid() {
+			return nil
+		}
+		for i := 0; i < list.Len(); i++ {
+			conds = append(conds, searchCondition(list.Index(i), redact))
+		}
+		return conds
+	}
+
+	c := &SearchClauses{
+		Where:   conditions("whereConditions"),
+		Or:      conditions("orConditions"),
+		Not:     conditions("notConditions"),
+		Having:  conditions("havingConditions"),
+		Joins:   conditions("joinConditions"),
+		Group:   stringField(field("group")),
+		Limit:   plainString(field("limit")),
+		Offset:  plainString(field("offset")),
+		Preload: preloadSchemas(scope),
+	}
+	if v := field("Unscoped"); v.IsValid() {
+		c.Unscoped = v.Bool()
+	}
+	if selects := field("selects"); selects.IsValid() && selects.Len() > 0 {
+		c.Select = plainString(selects.MapIndex(reflect.ValueOf("query")))
+	}
+	if omits := field("omits"); omits.IsValid() {
+		for i := 0; i < omits.Len(); i++ {
+			c.Omit = append(c.Omit, omits.Index(i).String())
+		}
+	}
+	if orders := field("orders"); orders.IsValid() {
+		for i := 0; i < orders.Len(); i++ {
+			c.Order = append(c.Order, plainString(orders.Index(i)))
+		}
+	}
+
+	if reflect.DeepEqual(c, &SearchClauses{}) {
+		return nil
+	}
+	return c
+}
+
+// preloadSchemas lists the associations given to Preload, such as
+// "Lines.Product".
+func preloadSchemas(scope *gorm.Scope) []string {
+	if scope.Search == nil {
+		return nil
+	}
+	var schemas []string
+	preload := reflect.ValueOf(scope.Search).Elem().FieldByName("preload")
+	for i := 0; i < preload.Len(); i++ {
+		schemas = append(schemas, stringField(preload.Index(i).FieldByName("schema")))
+	}
+	return schemas
+}
+
+// searchCondition converts one of gorm's {"query", "args"} maps.
+func searchCondition(m reflect.Value, redact bool) SearchCondition {
+	cond := SearchCondition{Query: plainString(m.MapIndex(reflect.ValueOf("query")))}
+	if redact {
+		return cond
+	}
+	if args := elem(m.MapIndex(reflect.ValueOf("args"))); args.IsValid() && args.Kind() == reflect.Slice {
+		for i := 0; i < args.Len(); i++ {
+			cond.Args = append(cond.Args, plainValue(args.Index(i)))
+		}
+	}
+	return cond
+}
+
+func stringField(v reflect.Value) string {
+	if !v.IsValid() || v.Kind() != reflect.String {
+		return ""
+	}
+	return v.String()
+}
+
+// elem unwraps interfaces and pointers.
+func elem(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// plainString formats v, which may have been read from an unexported
+// field, or returns "" if it's nil.
+func plainString(v reflect.Value) string {
+	v = elem(v)
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.String {
+		return v.String()
+	}
+	return fmt.Sprint(v)
+}
+
+// plainValue copies v, which may have been read from an unexported field
+// and so can't be turned back into an interface directly, into a value
+// that can be serialized.
+func plainValue(v reflect.Value) interface{} {
+	v = elem(v)
+	if !v.IsValid() {
+		return nil
+	}
+	if v.CanInterface() {
+		return v.Interface()
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		values := make([]interface{}, v.Len())
+		for i := range values {
+			values[i] = plainValue(v.Index(i))
+		}
+		return values
+	}
+	return fmt.Sprint(v)
+}
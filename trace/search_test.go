@@ -0,0 +1,59 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_SearchClauses(t *testing.T) {
+	a := require.New(t)
+
+	find := func(opts ...Option) *GormEvent {
+		db, _ := openFakeDB(t)
+		sink := &memorySink{}
+		db, tracer := TraceDB(db, append(opts, WithSink(sink))...)
+		a.NoError(db.
+			Select("accounts.id, accounts.email_address").
+			Joins("JOIN organizations ON organizations.id = accounts.organization_id AND organizations.plan = ?", "pro").
+			Where("status = ?", models.Status_Active).
+			Where(&models.Account{NickName: "ace"}).
+			Not("email_address", []string{"a@acme.com", "b@acme.com"}).
+			Order("id desc").
+			Limit(10).
+			Offset(20).
+			Find(&[]models.Account{}).Error)
+		tracer.Close()
+		return sink.Events()[0]
+	}
+
+	search := find().Search
+	a.NotNil(search)
+	a.Equal("accounts.id, accounts.email_address", search.Select)
+	a.Equal([]SearchCondition{{Query: "JOIN organizations ON organizations.id = accounts.organization_id AND organizations.plan = ?", Args: []interface{}{"pro"}}}, search.Joins)
+	a.Len(search.Where, 2)
+	a.Equal(SearchCondition{Query: "status = ?", Args: []interface{}{models.Status_Active}}, search.Where[0])
+	a.Contains(search.Where[1].Query, "ace")
+	a.Equal([]SearchCondition{{Query: "email_address", Args: []interface{}{[]interface{}{"a@acme.com", "b@acme.com"}}}}, search.Not)
+	a.Equal([]string{"id desc"}, search.Order)
+	a.Equal("10", search.Limit)
+	a.Equal("20", search.Offset)
+
+	redacted := find(WithRedactedVars()).Search
+	a.Equal("status = ?", redacted.Where[0].Query)
+	a.Nil(redacted.Where[0].Args)
+}
+
+func TestTracer_SearchClausesEmpty(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	a.NoError(db.Create(&models.Account{EmailAddress: "search@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	a.Nil(sink.Events()[0].Search)
+}
@@ -0,0 +1,27 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var selectStar = regexp.MustCompile(`(?i)^\s*SELECT\s+(?:DISTINCT\s+)?(?:"?\w+"?\.)?\*\s+FROM\b`)
+
+// selectStarDetector flags queries selecting every column of models with
+// many of them, which usually fetch more than the code needs, see
+// WithSelectStarDetection.
+type selectStarDetector struct {
+	minColumns int
+}
+
+func (d selectStarDetector) rule() string { return "select_star" }
+
+func (d selectStarDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" || e.ResultColumns <= d.minColumns || !selectStar.MatchString(e.Query) {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+
+	msg := fmt.Sprintf("SELECT * on %s fetches all %d columns", e.TableName, e.ResultColumns)
+	return singleViolation(d.rule(), e, msg)
+}
@@ -0,0 +1,40 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_SelectStar(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithSelectStarDetection(3))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Select("id, email_address").Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]testNote{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 4)
+	a.Equal([]string{"select_star"}, events[0].Warnings)
+	a.Empty(events[2].Warnings)
+	a.Empty(events[3].Warnings, "test_notes has too few columns")
+
+	v := events[1]
+	a.Equal("select_star", v.Violation.Rule)
+	a.Contains(v.Violation.Message, "accounts")
+	a.Contains(v.Violation.Message, "select_star_test.go:")
+}
+
+func TestSelectStar(t *testing.T) {
+	a := require.New(t)
+	a.True(selectStar.MatchString(`SELECT * FROM "accounts"  WHERE (id = $1)`))
+	a.True(selectStar.MatchString(`SELECT "accounts".* FROM "accounts" JOIN orgs ON orgs.id = accounts.organization_id`))
+	a.False(selectStar.MatchString(`SELECT id, email_address FROM "accounts"`))
+	a.False(selectStar.MatchString(`SELECT count(*) FROM "accounts"`))
+}
@@ -0,0 +1,139 @@
+package trace
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink receives completed events from a Tracer.
+type Sink interface {
+	Write(event *GormEvent) error
+	Flush() error
+	Close() error
+}
+
+var errSinkClosed = errors.New("gormsanity: sink is closed")
+
+// WriterSink writes events to an io.Writer, as newline delimited JSON
+// unless another Formatter is set. Closing the sink flushes it but leaves
+// the writer open.
+type WriterSink struct {
+	Formatter Formatter
+
+	mu          sync.Mutex
+	w           *bufio.Writer
+	wroteHeader bool
+}
+
+// NewWriterSink creates a sink writing to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{Formatter: JSONFormatter{}, w: bufio.NewWriter(w)}
+}
+
+func (s *WriterSink) Write(event *GormEvent) error {
+	record, err := s.Formatter.Format(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.wroteHeader {
+		if h, ok := s.Formatter.(headerFormatter); ok {
+			s.w.Write(h.Header())
+		}
+		s.wroteHeader = true
+	}
+
+	s.w.Write(record)
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Flush()
+}
+
+func (s *WriterSink) Close() error {
+	return s.Flush()
+}
+
+// SinkEnvVar selects the sink used when TraceDB isn't given one. It may be
+// "stdout", "stderr", "pretty" (human readable output on stdout) or "file"
+// (the default). See env.go for the other environment variables.
+const SinkEnvVar = "GORMSANITY_SINK"
+
+// DefaultFileTemplate names the trace file when no template is configured.
+const DefaultFileTemplate = "gorm.{ts}.log"
+
+type fileConfig struct {
+	dir      string
+	template string
+	perm     os.FileMode
+	service  string
+	maxSize  int64
+	maxFiles int
+	maxAge   time.Duration
+	compress bool
+}
+
+func defaultSink(cfg fileConfig) Sink {
+	switch strings.ToLower(os.Getenv(SinkEnvVar)) {
+	case "stdout":
+		return NewWriterSink(os.Stdout)
+	case "stderr":
+		return NewWriterSink(os.Stderr)
+	case "pretty":
+		return newPrettySink()
+	}
+	template := cfg.template
+	if template == "" {
+		template = DefaultFileTemplate
+	}
+
+	s := NewFileSink(filepath.Join(cfg.dir, ExpandFileTemplate(template, cfg.service, time.Now())))
+	if cfg.perm != 0 {
+		s.Perm = cfg.perm
+	}
+	s.MaxSize = cfg.maxSize
+	s.MaxFiles = cfg.maxFiles
+	s.MaxAge = cfg.maxAge
+	s.Compress = cfg.compress
+	return s
+}
+
+// ExpandFileTemplate fills in a trace file name template. Supported
+// placeholders are:
+//
+//	{service}  the service name, see WithServiceName
+//	{date}     the date as YYYYMMDD
+//	{time}     the time as HHMMSS
+//	{pid}      the process ID
+//	{ts}       the Unix time in nanoseconds
+func ExpandFileTemplate(template, service string, now time.Time) string {
+	if service == "" {
+		service = "gorm"
+	}
+	return strings.NewReplacer(
+		"{service}", service,
+		"{date}", now.Format("20060102"),
+		"{time}", now.Format("150405"),
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{ts}", strconv.FormatInt(now.UnixNano(), 10),
+	).Replace(template)
+}
+
+func newPrettySink() Sink {
+	s := NewWriterSink(os.Stdout)
+	s.Formatter = NewPrettyFormatter(os.Stdout)
+	return s
+}
@@ -0,0 +1,89 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTraceDB_WithSink(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithTest(t), WithSink(sink))
+	a.NoError(db.Create(&models.Account{EmailAddress: "sink@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	events := sink.Operations()
+	a.Len(events, 1)
+	a.Equal("create", events[0].EventType)
+	a.Equal("accounts", events[0].TableName)
+	a.True(events[0].IsComplete)
+	a.True(sink.closed)
+}
+
+func TestTraceDB_WithWriter(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	var buf bytes.Buffer
+
+	db, tracer := TraceDB(db, WithTest(t), WithWriter(&buf))
+	var accounts []models.Account
+	a.NoError(db.Where("organization_id = ?", "acme").Find(&accounts).Error)
+	tracer.Close()
+
+	var e GormEvent
+	a.NoError(json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &e))
+	a.Equal("query", e.EventType)
+	a.Contains(e.Query, "organization_id = $1")
+}
+
+func TestDefaultSink_Env(t *testing.T) {
+	a := require.New(t)
+	defer os.Setenv(SinkEnvVar, os.Getenv(SinkEnvVar))
+
+	os.Setenv(SinkEnvVar, "stdout")
+	a.IsType(&WriterSink{}, defaultSink(fileConfig{}))
+
+	os.Setenv(SinkEnvVar, "")
+	a.IsType(&FileSink{}, defaultSink(fileConfig{}))
+}
+
+func TestTraceDB_OnError(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	good := &memorySink{}
+
+	var errs []error
+	db, tracer := TraceDB(db, WithTest(t), WithSink(&failingSink{}), WithSink(good), WithoutRules("no_where_clause", "zero_insert_value"), OnError(func(err error) {
+		errs = append(errs, err)
+	}))
+	a.NoError(db.Create(&models.Account{EmailAddress: "err@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	a.Len(errs, 1)
+	a.Contains(errs[0].Error(), "disk full")
+	a.Equal(TracerStats{Written: 0, Failed: 1}, tracer.Stats())
+	a.Len(good.Events(), 1)
+}
+
+func TestTraceDB_StatsAsync(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+
+	var errs []error
+	db, tracer := TraceDB(db, WithTest(t), WithSink(&failingSink{}), WithAsync(), WithoutRules("no_where_clause", "zero_insert_value"), OnError(func(err error) {
+		errs = append(errs, err)
+	}))
+	a.NoError(db.Create(&models.Account{EmailAddress: "async@acme.com", Status: models.Status_Active}).Error)
+	tracer.Close()
+
+	a.Len(errs, 1)
+	a.Equal(TracerStats{Written: 1, Failed: 1}, tracer.Stats())
+}
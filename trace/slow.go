@@ -0,0 +1,45 @@
+package trace
+
+import (
+	"fmt"
+	"time"
+)
+
+// slowDetector marks operations taking longer than their threshold as
+// slow and reports them as violations, see WithSlowThreshold.
+type slowDetector struct {
+	types  map[string]time.Duration
+	tables map[string]time.Duration
+}
+
+func (d *slowDetector) rule() string { return "slow_query" }
+
+// threshold returns the threshold for e, that of its table taking
+// precedence over that of its event type.
+func (d *slowDetector) threshold(e *GormEvent) (time.Duration, bool) {
+	if th, ok := d.tables[e.TableName]; ok {
+		return th, true
+	}
+	if th, ok := d.types[e.EventType]; ok {
+		return th, true
+	}
+	th, ok := d.types[""]
+	return th, ok
+}
+
+func (d *slowDetector) observe(e *GormEvent) []*Violation {
+	th, ok := d.threshold(e)
+	if !ok || !e.IsComplete || e.Duration <= th {
+		return nil
+	}
+	e.Slow = true
+	e.Warnings = append(e.Warnings, d.rule())
+	return singleViolation(d.rule(), e, fmt.Sprintf("%s on %s took %v, longer than %v", e.EventType, e.TableName, e.Duration, th))
+}
+
+func (t *Tracer) slowDetector() *slowDetector {
+	if t.slow == nil {
+		t.slow = &slowDetector{types: map[string]time.Duration{}, tables: map[string]time.Duration{}}
+	}
+	return t.slow
+}
@@ -0,0 +1,42 @@
+package trace
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_SlowThreshold(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	events, violations := &memorySink{}, &memorySink{}
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	sink := NewRouterSink().
+		Route(MatchViolations(), violations).
+		Route(func(e *GormEvent) bool { return e.Violation == nil }, events)
+	db, tracer := TraceDB(db, WithSink(sink), WithoutRules("no_where_clause", "zero_insert_value"),
+		WithClock(&stepClock{now: epoch, step: 10 * time.Millisecond}),
+		WithSlowThreshold(5*time.Millisecond, "query"),
+		WithSlowTableThreshold("accounts", 20*time.Millisecond))
+	a.NoError(db.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ?", 1).Find(&[]testNote{}).Error)
+	a.NoError(db.Create(&testNote{}).Error)
+	tracer.Close()
+
+	var slow []bool
+	for _, e := range events.Events() {
+		slow = append(slow, e.Slow)
+	}
+	a.Equal([]bool{false, true, false}, slow)
+	a.Contains(events.Events()[1].Warnings, "slow_query")
+
+	a.Len(violations.Events(), 1)
+	v := violations.Events()[0]
+	a.Equal("slow_query", v.Violation.Rule)
+	a.Equal("test_notes", v.TableName)
+	a.Equal([]string{events.Events()[1].ID}, v.Violation.Events)
+}
@@ -0,0 +1,91 @@
+package trace
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// SocketSink streams events to a listening socket, as newline delimited
+// JSON unless another Formatter is set. The connection is dialed on the
+// first write and redialed if it breaks, so the consumer can be restarted
+// without restarting the application.
+type SocketSink struct {
+	Formatter   Formatter
+	DialTimeout time.Duration
+
+	network string
+	addr    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewUnixSink creates a sink streaming to the Unix domain socket at path.
+func NewUnixSink(path string) *SocketSink {
+	return NewSocketSink("unix", path)
+}
+
+// NewSocketSink creates a sink streaming to addr, e.g. ("tcp",
+// "localhost:7070").
+func NewSocketSink(network, addr string) *SocketSink {
+	return &SocketSink{
+		Formatter:   JSONFormatter{},
+		DialTimeout: time.Second,
+		network:     network,
+		addr:        addr,
+	}
+}
+
+func (s *SocketSink) dial() error {
+	conn, err := net.DialTimeout(s.network, s.addr, s.DialTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *SocketSink) Write(event *GormEvent) error {
+	record, err := s.Formatter.Format(event)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.dial(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.conn.Write(record); err != nil {
+		// The consumer may have restarted, try a fresh connection once.
+		s.conn.Close()
+		s.conn = nil
+		if dialErr := s.dial(); dialErr != nil {
+			return err
+		}
+		_, err = s.conn.Write(record)
+		return err
+	}
+	return nil
+}
+
+func (s *SocketSink) Flush() error {
+	return nil
+}
+
+func (s *SocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
@@ -0,0 +1,53 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSink(t *testing.T) {
+	a := require.New(t)
+	dir, err := ioutil.TempDir("", "gormsanity")
+	a.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "trace.sock")
+	l, err := net.Listen("unix", path)
+	a.NoError(err)
+	defer l.Close()
+
+	received := make(chan GormEvent, 2)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		sc := bufio.NewScanner(conn)
+		for sc.Scan() {
+			var e GormEvent
+			json.Unmarshal(sc.Bytes(), &e)
+			received <- e
+		}
+	}()
+
+	sink := NewUnixSink(path)
+	a.NoError(sink.Write(&GormEvent{EventType: "create"}))
+	a.NoError(sink.Write(&GormEvent{EventType: "update"}))
+	a.NoError(sink.Close())
+
+	a.Equal("create", (<-received).EventType)
+	a.Equal("update", (<-received).EventType)
+}
+
+func TestUnixSink_NoListener(t *testing.T) {
+	sink := NewUnixSink(filepath.Join(os.TempDir(), "gormsanity-missing.sock"))
+	require.Error(t, sink.Write(&GormEvent{EventType: "create"}))
+}
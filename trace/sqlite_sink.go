@@ -0,0 +1,128 @@
+package trace
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// sqliteTimeFormat is fixed width so timestamps sort lexically and are
+// understood by SQLite's date functions.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z"
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS gorm_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		start_time TEXT NOT NULL,
+		end_time TEXT,
+		event_type TEXT NOT NULL,
+		table_name TEXT,
+		fingerprint TEXT,
+		query TEXT,
+		rows_affected INTEGER,
+		errors TEXT,
+		warnings TEXT,
+		instance_id TEXT,
+		test_name TEXT,
+		tx_id INTEGER,
+		event TEXT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS gorm_events_start_time ON gorm_events (start_time)`,
+	`CREATE INDEX IF NOT EXISTS gorm_events_event_type ON gorm_events (event_type)`,
+	`CREATE INDEX IF NOT EXISTS gorm_events_fingerprint ON gorm_events (fingerprint)`,
+}
+
+const sqliteInsert = `INSERT INTO gorm_events (
+	start_time, end_time, event_type, table_name, fingerprint, query,
+	rows_affected, errors, warnings, instance_id, test_name, tx_id, event
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+// SQLiteSink stores one row per event in a gorm_events table, indexed on
+// start time, event type and fingerprint. The full event is kept as JSON in
+// the event column.
+//
+// The database handle is opened by the caller with whichever SQLite driver
+// the application uses (mattn/go-sqlite3, modernc.org/sqlite, ...), and
+// isn't closed by the sink.
+type SQLiteSink struct {
+	mu   sync.Mutex
+	db   *sql.DB
+	stmt *sql.Stmt
+}
+
+// NewSQLiteSink creates the gorm_events table and its indexes if they don't
+// exist yet.
+func NewSQLiteSink(db *sql.DB) (*SQLiteSink, error) {
+	for _, ddl := range sqliteSchema {
+		if _, err := db.Exec(ddl); err != nil {
+			return nil, err
+		}
+	}
+
+	stmt, err := db.Prepare(sqliteInsert)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteSink{db: db, stmt: stmt}, nil
+}
+
+func sqliteTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func sqliteJSON(v interface{}) (interface{}, error) {
+	bs, err := json.Marshal(v)
+	if err != nil || string(bs) == "null" {
+		return nil, err
+	}
+	return string(bs), nil
+}
+
+func (s *SQLiteSink) Write(event *GormEvent) error {
+	full, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	errs, err := sqliteJSON(event.Errors)
+	if err != nil {
+		return err
+	}
+	warnings, err := sqliteJSON(event.Warnings)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.stmt.Exec(
+		sqliteTime(event.StartTime),
+		sqliteTime(event.EndTime),
+		event.EventType,
+		event.TableName,
+		event.Fingerprint,
+		event.Query,
+		event.RowsAffected,
+		errs,
+		warnings,
+		event.InstanceID,
+		event.TestName,
+		int64(event.Transaction),
+		string(full),
+	)
+	return err
+}
+
+func (s *SQLiteSink) Flush() error {
+	return nil
+}
+
+func (s *SQLiteSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stmt.Close()
+}
@@ -0,0 +1,23 @@
+package trace
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteSink(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+
+	sink, err := NewSQLiteSink(db.DB())
+	a.NoError(err)
+	a.NoError(sink.Write(&GormEvent{StartTime: time.Now(), EventType: "query", Fingerprint: "abc"}))
+	a.NoError(sink.Close())
+
+	a.True(strings.HasPrefix(fdb.queries[0], "CREATE TABLE IF NOT EXISTS gorm_events"))
+	a.Contains(fdb.queries, "CREATE INDEX IF NOT EXISTS gorm_events_fingerprint ON gorm_events (fingerprint)")
+	a.True(strings.HasPrefix(fdb.queries[len(fdb.queries)-1], "INSERT INTO gorm_events"))
+}
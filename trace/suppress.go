@@ -0,0 +1,91 @@
+package trace
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Suppression silences violations known to be accepted, so new ones
+// stand out. It matches the violations, and warnings, of Rule, or of every
+// rule when empty, raised by operations with the fingerprint Fingerprint,
+// see Fingerprint, and called from Caller, each being ignored when empty.
+// Caller is the end of a file path, such as "reports/export.go", a file
+// and line, such as "export.go:42", or a function, such as
+// "reports.Export" or "(*Exporter).Run". An empty Suppression matches
+// nothing.
+type Suppression struct {
+	Rule        string `json:"rule" yaml:"rule"`
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+	Caller      string `json:"caller" yaml:"caller"`
+}
+
+// matches reports whether s silences rule on e.
+func (s Suppression) matches(rule string, e *GormEvent) bool {
+	if s.Rule == "" && s.Fingerprint == "" && s.Caller == "" {
+		return false
+	}
+	return (s.Rule == "" || s.Rule == rule) &&
+		(s.Fingerprint == "" || s.Fingerprint == e.Fingerprint) &&
+		(s.Caller == "" || matchCaller(s.Caller, e.Caller, e.CallerFunc))
+}
+
+// matchCaller reports whether pattern names the file:line or function of
+// a caller, see Suppression.
+func matchCaller(pattern, fileLine, fn string) bool {
+	if fileLine != "" {
+		file := fileLine
+		if i := strings.LastIndexByte(file, ':'); i >= 0 {
+			file = file[:i]
+		}
+		for _, f := range []string{fileLine, file} {
+			if f == pattern || strings.HasSuffix(f, "/"+pattern) {
+				return true
+			}
+		}
+	}
+	return fn != "" && (fn == pattern || strings.HasSuffix(fn, "/"+pattern) || strings.HasSuffix(fn, "."+pattern))
+}
+
+// suppresses reports whether one of the tracer's suppressions
+// silences rule on e.
+func (t *Tracer) suppresses(rule string, e *GormEvent) bool {
+	t.mu.Lock()
+	suppressions := t.suppressions
+	t.mu.Unlock()
+
+	for _, s := range suppressions {
+		if s.matches(rule, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// suppressViolations drops the violations found on e that are silenced,
+// along with their warnings on e.
+func (t *Tracer) suppressViolations(e *GormEvent, violations []*GormEvent) []*GormEvent {
+	t.mu.Lock()
+	none := len(t.suppressions) == 0
+	t.mu.Unlock()
+	if none {
+		return violations
+	}
+
+	warnings := e.Warnings[:0]
+	for _, w := range e.Warnings {
+		if !t.suppresses(w, e) {
+			warnings = append(warnings, w)
+		}
+	}
+	e.Warnings = warnings
+
+	kept := violations[:0]
+	for _, v := range violations {
+		if t.suppresses(v.Violation.Rule, e) {
+			atomic.AddUint64(&t.suppressed, 1)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	return kept
+}
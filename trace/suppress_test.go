@@ -0,0 +1,51 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/require"
+)
+
+func purgeNote(db *gorm.DB, id int) error {
+	return db.Unscoped().Delete(&testNote{ID: id}).Error
+}
+
+func TestTracer_Suppressions(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithSuppressions(Suppression{Rule: "hard_delete", Caller: "trace.purgeNote"}))
+	a.NoError(purgeNote(db, 1))
+	a.NoError(db.Unscoped().Delete(&testNote{ID: 2}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 3)
+	a.False(hasWarning(events[0], "hard_delete"))
+	a.True(hasWarning(events[1], "hard_delete"))
+	a.Equal("hard_delete", events[2].Violation.Rule)
+	a.Equal(uint64(1), tracer.Stats().Suppressed)
+}
+
+func TestSuppression_Matches(t *testing.T) {
+	a := require.New(t)
+	e := &GormEvent{
+		Fingerprint: "abc123",
+		Caller:      "/src/app/reports/export.go:42",
+		CallerFunc:  "example.com/app/reports.(*Exporter).Run",
+	}
+
+	a.True(Suppression{Rule: "n_plus_one", Fingerprint: "abc123"}.matches("n_plus_one", e))
+	a.False(Suppression{Rule: "n_plus_one", Fingerprint: "abc123"}.matches("slow_query", e))
+	a.False(Suppression{Rule: "n_plus_one", Fingerprint: "def456"}.matches("n_plus_one", e))
+	a.False(Suppression{}.matches("n_plus_one", e))
+
+	for _, caller := range []string{"reports/export.go", "export.go", "export.go:42", "/src/app/reports/export.go:42", "(*Exporter).Run", "reports.(*Exporter).Run", "example.com/app/reports.(*Exporter).Run"} {
+		a.True(Suppression{Caller: caller}.matches("slow_query", e), caller)
+	}
+	for _, caller := range []string{"port.go", "export.go:43", "Run2", "reports"} {
+		a.False(Suppression{Caller: caller}.matches("slow_query", e), caller)
+	}
+}
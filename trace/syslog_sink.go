@@ -0,0 +1,168 @@
+package trace
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SyslogFacility is an RFC 5424 facility code.
+type SyslogFacility int
+
+const (
+	SyslogUser   SyslogFacility = 1
+	SyslogDaemon SyslogFacility = 3
+	SyslogLocal0 SyslogFacility = 16
+	SyslogLocal1 SyslogFacility = 17
+	SyslogLocal2 SyslogFacility = 18
+	SyslogLocal3 SyslogFacility = 19
+	SyslogLocal4 SyslogFacility = 20
+	SyslogLocal5 SyslogFacility = 21
+	SyslogLocal6 SyslogFacility = 22
+	SyslogLocal7 SyslogFacility = 23
+)
+
+const (
+	syslogSeverityError   = 3
+	syslogSeverityWarning = 4
+	syslogSeverityInfo    = 6
+)
+
+// Local syslog sockets, in the order they're tried.
+var syslogLocalAddrs = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogSink writes events as RFC 5424 messages whose body is the JSON
+// encoded event. Events with errors are logged at error severity, events
+// with warnings at warning severity, everything else at info.
+//
+// An empty network connects to the local syslog daemon. Over tcp messages
+// are framed with octet counting (RFC 6587).
+type SyslogSink struct {
+	Facility SyslogFacility
+	Tag      string
+	Hostname string
+
+	network string
+	addr    string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink creates a sink writing to the syslog server at addr.
+func NewSyslogSink(network, addr string, facility SyslogFacility, tag string) *SyslogSink {
+	hostname, _ := os.Hostname()
+	return &SyslogSink{
+		Facility: facility,
+		Tag:      tag,
+		Hostname: hostname,
+		network:  network,
+		addr:     addr,
+	}
+}
+
+func (s *SyslogSink) dial() (net.Conn, error) {
+	if s.network != "" {
+		return net.Dial(s.network, s.addr)
+	}
+
+	for _, addr := range syslogLocalAddrs {
+		for _, network := range []string{"unixgram", "unix"} {
+			if conn, err := net.Dial(network, addr); err == nil {
+				s.network = network
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.New("gormsanity: no local syslog socket found")
+}
+
+func (s *SyslogSink) format(event *GormEvent) ([]byte, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	severity := syslogSeverityInfo
+	if len(event.Errors) > 0 {
+		severity = syslogSeverityError
+	} else if len(event.Warnings) > 0 {
+		severity = syslogSeverityWarning
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s",
+		int(s.Facility)*8+severity,
+		time.Now().Format(time.RFC3339Nano),
+		syslogHeaderValue(s.Hostname),
+		syslogHeaderValue(s.Tag),
+		os.Getpid(),
+		syslogHeaderValue(event.EventType),
+		body,
+	)
+
+	if s.network == "tcp" || s.network == "tcp4" || s.network == "tcp6" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	return []byte(msg), nil
+}
+
+// syslogHeaderValue replaces an empty header field with the nil value.
+func syslogHeaderValue(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+func (s *SyslogSink) Write(event *GormEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	msg, err := s.format(event)
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.conn.Write(msg); err != nil {
+		// Reconnect once in case the daemon restarted.
+		s.conn.Close()
+		s.conn = nil
+		conn, dialErr := s.dial()
+		if dialErr != nil {
+			return err
+		}
+		s.conn = conn
+		_, err = s.conn.Write(msg)
+		return err
+	}
+	return nil
+}
+
+func (s *SyslogSink) Flush() error {
+	return nil
+}
+
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
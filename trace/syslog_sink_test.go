@@ -0,0 +1,37 @@
+package trace
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyslogSink(t *testing.T) {
+	a := require.New(t)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	a.NoError(err)
+	defer conn.Close()
+
+	sink := NewSyslogSink("udp", conn.LocalAddr().String(), SyslogLocal3, "gormsanity")
+	sink.Hostname = "db-host"
+	a.NoError(sink.Write(&GormEvent{EventType: "delete", Errors: []error{errors.New("boom")}}))
+	a.NoError(sink.Close())
+
+	buf := make([]byte, 4096)
+	n, _, err := conn.ReadFrom(buf)
+	a.NoError(err)
+
+	// local3 (19) * 8 + error (3)
+	msg := string(buf[:n])
+	a.True(strings.HasPrefix(msg, "<155>1 "), msg)
+	fields := strings.SplitN(msg, " ", 8)
+	a.Equal("db-host", fields[2])
+	a.Equal("gormsanity", fields[3])
+	a.Equal("delete", fields[5])
+	a.Equal("-", fields[6])
+	a.Contains(fields[7], `"event_type":"delete"`)
+}
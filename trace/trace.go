@@ -4,14 +4,15 @@ import (
 	"bufio"
 	"bytes"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"reflect"
 	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -19,101 +20,473 @@ import (
 	"github.com/jinzhu/gorm"
 )
 
-const trackScopeKey = "gorm_tracer"
+const (
+	trackScopeKey  = "gorm_tracer"
+	sampleScopeKey = trackScopeKey + ":sampled"
+)
 
-var writer *bufio.Writer
+// sequence numbers events in the order they start, across every tracer in
+// the process, see GormEvent.Sequence.
+var sequence uint64
 
-func getWriter() *bufio.Writer {
-	if writer == nil {
-		f, err := os.Create(fmt.Sprintf("gorm.%d.log", time.Now().UnixNano()))
-		if err != nil {
-			return nil
-		}
-		writer = bufio.NewWriter(f)
+type GormEvent struct {
+	SchemaVersion  int                    `json:"schema_version"`
+	ID             string                 `json:"event_id"`
+	ParentID       string                 `json:"parent_event_id"`
+	Sequence       uint64                 `json:"sequence"`
+	Preload        string                 `json:"preload"`
+	StartTime      time.Time              `json:"start_time"`
+	Query          string                 `json:"query"`
+	Interpolated   string                 `json:"query_interpolated"`
+	Fingerprint    string                 `json:"fingerprint"`
+	EndTime        time.Time              `json:"end_time"`
+	Duration       time.Duration          `json:"duration_ns"`
+	EventType      string                 `json:"event_type"`
+	RowsAffected   int64                  `json:"rows_affected"`
+	SoftDelete     bool                   `json:"soft_delete"`
+	Slow           bool                   `json:"slow"`
+	RowsReturned   int64                  `json:"rows_returned"`
+	ResultColumns  int                    `json:"result_columns"`
+	ResultBytes    int64                  `json:"result_bytes"`
+	Errors         EventErrors            `json:"errors"`
+	HasError       bool                   `json:"has_error"`
+	InstanceID     string                 `json:"db_instance_id"`
+	Dialect        string                 `json:"dialect"`
+	DBHost         string                 `json:"db_host"`
+	DBName         string                 `json:"db_name"`
+	IsComplete     bool                   `json:"completed"`
+	Vars           map[string]interface{} `json:"settings"`
+	InitialFields  []gorm.Field           `json:"-"`
+	Warnings       []string               `json:"warnings"`
+	TableName      string                 `json:"table_name"`
+	ModelType      string                 `json:"model_type"`
+	PrimaryKeys    map[string]interface{} `json:"primary_keys"`
+	Changes        []FieldChange          `json:"changes"`
+	TestName       string                 `json:"test_name"`
+	SQLVars        []interface{}          `json:"sql_vars"`
+	Search         *SearchClauses         `json:"search"`
+	StackTrace     string                 `json:"stack_trace"`
+	Caller         string                 `json:"caller"`
+	CallerFunc     string                 `json:"caller_func"`
+	GoroutineID    uint64                 `json:"goroutine_id"`
+	Worker         string                 `json:"worker"`
+	Attempt        int                    `json:"attempt"`
+	Transaction    uintptr                `json:"tx_id"`
+	TransactionID  string                 `json:"transaction_id"`
+	Tracer         string                 `json:"tracer"`
+	Hostname       string                 `json:"hostname"`
+	PID            int                    `json:"pid"`
+	Service        string                 `json:"service"`
+	ServiceVersion string                 `json:"service_version"`
+	RequestID      string                 `json:"request_id"`
+	TraceID        string                 `json:"trace_id"`
+	UserID         string                 `json:"user_id"`
+	TimeToDeadline *time.Duration         `json:"time_to_deadline_ns"`
+	Tags           map[string]string      `json:"tags"`
+	Fields         map[string]interface{} `json:"fields"`
+	Violation      *Violation             `json:"violation"`
+
+	// unsampled events are only written if they fail.
+	unsampled bool
+	// preloads are the associations a query has yet to preload.
+	preloads []preloadField
+	// initialValues are the model's columns when an update started.
+	initialValues map[string]interface{}
+	// implicitTx is set when gorm began a transaction for the operation.
+	implicitTx bool
+	// leadingWildcard is set when a LIKE pattern starts with a wildcard.
+	leadingWildcard bool
+	// typeMismatches are the columns the statement compares to values of
+	// another type, when they're looked for.
+	typeMismatches []typeMismatch
+	// priorError is the unhandled failure of an earlier operation on the
+	// handle the operation ran on.
+	priorError *priorError
+	// numericArgs are the values of the statement's numeric arguments,
+	// when it's looked for in loops.
+	numericArgs []float64
+	// inListItems is the number of values bound to the statement's longest
+	// IN list, when large lists are looked for.
+	inListItems int
+	// hardDelete is set when a delete bypassed soft deletion, see
+	// AllowHardDelete.
+	hardDelete bool
+	// distinctRows is the number of distinct records a query returned,
+	// when it's looked for joins multiplying rows.
+	distinctRows int
+	// argsHash identifies the values the statement ran with, even when
+	// they're redacted.
+	argsHash string
+}
+
+// end records when the operation ended. The duration is measured on the
+// monotonic clock when there is one, and is never negative. The end time
+// is derived from it rather than read from the wall clock, so a clock
+// adjustment mid-operation can't make it precede the start time.
+func (e *GormEvent) end(t time.Time) {
+	e.Duration = t.Sub(e.StartTime)
+	if e.Duration < 0 {
+		e.Duration = 0
 	}
-	return writer
+	e.EndTime = e.StartTime.Add(e.Duration)
 }
 
-func writeEntry(gormEvent *GormEvent) {
-	bs, err := json.Marshal(gormEvent)
-	if err != nil {
-		return
+type Tracer struct {
+	ID            string
+	name          string
+	traced        []*gorm.DB
+	closed        bool
+	closeOnce     sync.Once
+	sinkMu        sync.RWMutex
+	sinkClosed    bool
+	Events        map[string]*GormEvent
+	Errors        []error
+	mu            *sync.Mutex
+	dontFail      bool
+	testT         *testing.T
+	db            *gorm.DB
+	sink          Sink
+	sinks         []Sink
+	async         bool
+	sample        float64
+	minDuration   time.Duration
+	errorsOnly    bool
+	eventTypes    map[string]bool
+	tables        map[string]bool
+	models        []interface{}
+	file          fileConfig
+	onError       func(error)
+	extractors    []ContextExtractor
+	disabledRules map[string]bool
+	severities    map[string]Severity
+	suppressions  []Suppression
+	placements    map[string]callbackPlacement
+	redactVars    bool
+	verbosity     Verbosity
+	configPath    string
+	// configBase are the settings Reload applies the config file on top
+	// of, those made in code, and configApplied those it last applied.
+	configBase    reloadSettings
+	configApplied reloadSettings
+	stopReload    []func()
+	written       uint64
+	failed        uint64
+	filtered      uint64
+	evicted       uint64
+	suppressed    uint64
+	seq           uint64
+	pending       pending
+	maxPending    int
+	maxPendingAge time.Duration
+	clock         Clock
+	hooks         []Hooks
+	enrichers     []Enricher
+	metrics       metricsRecorder
+	metricsOnly   bool
+	noCaller      bool
+	callerSkip    []string
+	goroutineIDs  bool
+	noPrimaryKeys bool
+	pkHashKey     []byte
+	changeNames   bool
+	interpolate   bool
+	hostname      string
+	pid           int
+	version       string
+	target        dbTarget
+	tags          map[string]string
+	strictWhere   bool
+	slow          *slowDetector
+	selectStar    *selectStarDetector
+	unbounded     *unboundedReadDetector
+	inList        *inListDetector
+	crossJoin     *crossJoinDetector
+	loopQuery     *loopQueryDetector
+	wildcards     bool
+	zeroRows      *zeroRowDetector
+	fullCount     *fullCountDetector
+	typeChecks    bool
+	rules         []Rule
+	ruleWindows   *ruleWindows
+	detectors     []detector
+	nPlusOne      *nPlusOneDetector
+	duplicates    *duplicateDetector
+	longTx        *longTxDetector
+	implicitTx    *implicitTxDetector
+	explain       *explainer
+	leakedRows    *rowsWatcher
+}
+
+// TracerStats counts what happened to the events handed to a tracer's sink.
+type TracerStats struct {
+	// Written events were accepted by the sink.
+	Written uint64
+	// Failed events, flushes and closes returned an error from the sink.
+	Failed uint64
+	// Dropped events were discarded by a sink that sheds load rather than
+	// blocking, such as AsyncSink.
+	Dropped uint64
+	// Filtered events were left out by sampling, WithMinDuration or
+	// WithErrorsOnly.
+	Filtered uint64
+	// Evicted events belonged to operations that never completed and were
+	// written early to bound memory, see WithMaxPendingEvents.
+	Evicted uint64
+	// Suppressed violations were silenced, see WithSuppressions.
+	Suppressed uint64
+}
+
+// dropCounter is implemented by sinks that can discard events.
+type dropCounter interface {
+	Dropped() uint64
+}
+
+// TraceDB registers tracing callbacks on db and returns it along with the
+// tracer. Close the tracer to remove the callbacks and flush its sink. If
+// db is already traced the existing tracer is returned and opts are
+// ignored.
+func TraceDB(db *gorm.DB, opts ...Option) (*gorm.DB, *Tracer) {
+	if t := tracerOf(db); t != nil {
+		return db, t
 	}
-	w := getWriter()
-	w.Write(bs)
-	w.WriteByte('\n')
-	w.Flush()
+	t := New("", opts...)
+	return t.Trace(db), t
 }
 
-type GormEvent struct {
-	StartTime     time.Time              `json:"start_time"`
-	Query         string                 `json:"query"`
-	EndTime       time.Time              `json:"end_time"`
-	EventType     string                 `json:"event_type"`
-	RowsAffected  int64                  `json:"rows_affected"`
-	Errors        []error                `json:"errors"`
-	InstanceID    string                 `json:"db_instance_id"`
-	IsComplete    bool                   `json:"completed"`
-	Vars          map[string]interface{} `json:"settings"`
-	InitialFields []gorm.Field           `json:"-"`
-	Warnings      []string               `json:"warnings"`
-	TableName     string                 `json:"table_name"`
-	TestName      string                 `json:"test_name"`
-	SQLVars       []interface{}          `json:"sql_vars"`
-	StackTrace    string                 `json:"stack_trace"`
-	Transaction   uintptr                `json:"tx_id"`
+// New creates a tracer labelled name, which is recorded on every event so
+// the output of tracers for different databases can be told apart when
+// they share a sink. Attach it to a database with Trace.
+func New(name string, opts ...Option) *Tracer {
+	t := &Tracer{
+		Events:     make(map[string]*GormEvent),
+		mu:         &sync.Mutex{},
+		name:       name,
+		seq:        atomic.AddUint64(&tracerSeq, 1),
+		sample:     1,
+		pending:    newPending(),
+		maxPending: DefaultMaxPendingEvents,
+		clock:      systemClock{},
+		pid:        os.Getpid(),
+		nPlusOne:   newNPlusOneDetector(DefaultNPlusOneThreshold, DefaultNPlusOneWindow),
+		duplicates: newDuplicateDetector(DefaultDuplicateQueryWindow),
+	}
+	t.hostname, _ = os.Hostname()
+
+	envOpts, envErrs := envOptions(os.Getenv)
+	for _, opt := range append(envOpts, opts...) {
+		opt(t)
+	}
+	t.reportConfigErrors(envErrs)
+
+	t.detectors = append(t.detectors,
+		t.nPlusOne,
+		t.duplicates,
+		missingWhereDetector{"query", "no_where_clause"},
+		missingWhereDetector{"update", "no_where_update"},
+		missingWhereDetector{"delete", "no_where_delete"},
+		blankInsertDetector{},
+		hardDeleteDetector{},
+		newIgnoredErrorDetector(),
+		txDoneDetector{},
+	)
+	if t.slow != nil {
+		t.detectors = append(t.detectors, t.slow)
+	}
+	if t.selectStar != nil {
+		t.detectors = append(t.detectors, *t.selectStar)
+	}
+	if t.unbounded != nil {
+		t.detectors = append(t.detectors, *t.unbounded)
+	}
+	if t.inList != nil {
+		t.detectors = append(t.detectors, *t.inList)
+	}
+	if t.crossJoin != nil {
+		t.detectors = append(t.detectors, *t.crossJoin)
+	}
+	if t.loopQuery != nil {
+		t.detectors = append(t.detectors, t.loopQuery)
+	}
+	if t.wildcards {
+		t.detectors = append(t.detectors, leadingWildcardDetector{})
+	}
+	if t.zeroRows != nil {
+		t.detectors = append(t.detectors, t.zeroRows)
+	}
+	if t.fullCount != nil {
+		t.detectors = append(t.detectors, t.fullCount)
+	}
+	if t.typeChecks {
+		t.detectors = append(t.detectors, typeMismatchDetector{})
+	}
+	if len(t.rules) > 0 {
+		t.ruleWindows = newRuleWindows()
+		for _, r := range t.rules {
+			t.detectors = append(t.detectors, customRule{r, t.ruleWindows})
+		}
+	}
+	if t.longTx != nil {
+		t.detectors = append(t.detectors, t.longTx)
+	}
+	if t.implicitTx != nil {
+		t.detectors = append(t.detectors, t.implicitTx)
+	}
+
+	switch {
+	case t.metricsOnly:
+		t.sink = nopSink{}
+	case len(t.sinks) == 0:
+		t.sink = defaultSink(t.file)
+	case len(t.sinks) == 1:
+		t.sink = t.sinks[0]
+	default:
+		t.sink = NewMultiSink(t.sinks...)
+	}
+
+	if t.async && !t.metricsOnly {
+		async := NewAsyncSink(t.sink)
+		async.OnError = t.sinkError
+		t.sink = async
+	}
+
+	return t
 }
 
-type Tracer struct {
-	ID       string
-	Events   map[string]*GormEvent
-	Errors   []error
-	mu       *sync.Mutex
-	dontFail bool
-	testT    *testing.T
-	db       *gorm.DB
+// Name returns the label the tracer was created with.
+func (t *Tracer) Name() string {
+	return t.name
 }
 
-func TraceDB(db *gorm.DB, testT *testing.T) (*gorm.DB, *Tracer, func()) {
-	t := Tracer{
-		Events: make(map[string]*GormEvent),
-		mu:     &sync.Mutex{},
-		testT:  testT,
-		db:     db,
+// Trace registers the tracer's callbacks on db, which are shared by every
+// handle opened from the same connection, and returns db. Close removes
+// them again. Tracing a database twice is a no-op, and the callbacks of
+// another tracer are replaced.
+func (t *Tracer) Trace(db *gorm.DB) *gorm.DB {
+	if isTraced(db) {
+		if tracerOf(db) == t {
+			return db
+		}
+		Untrace(db)
 	}
+	register(db, t)
 
-	t.DescribeTables()
+	t.mu.Lock()
+	t.db = db
+	t.traced = append(t.traced, db)
+	t.mu.Unlock()
+	if t.explain != nil {
+		t.explain.use(connection(db))
+	}
+	if t.fullCount != nil {
+		t.fullCount.use(connection(db))
+	}
 
-	// Create
-	db.Callback().Create().After("gorm:begin_transaction").Register(trackScopeKey, t.CreateEvent) // INSERT
-	db.Callback().Create().After("gorm:commit_or_rollback_transaction").Register(trackScopeKey+":complete", t.GenericAfterComplete)
+	for _, model := range t.models {
+		t.tables[db.NewScope(model).TableName()] = true
+	}
 
-	// RowQuery
-	db.Callback().RowQuery().Before("gorm:row_query").Register(trackScopeKey, t.RowQueryEvent)
-	db.Callback().RowQuery().After("gorm:row_query").Register(trackScopeKey+":complete", t.GenericAfterComplete)
+	t.DescribeTables()
 
-	// Query
-	db.Callback().Query().Before("gorm:query").Register(trackScopeKey, t.QueryEvent) // SELECT
-	db.Callback().Query().After("gorm:after_query").Register(trackScopeKey+":complete", t.GenericAfterComplete)
+	callbacks := []struct {
+		eventType string
+		processor func() *gorm.CallbackProcessor
+		start     func(*gorm.Scope)
+	}{
+		{"create", func() *gorm.CallbackProcessor { return db.Callback().Create() }, t.CreateEvent},        // INSERT
+		{"row_query", func() *gorm.CallbackProcessor { return db.Callback().RowQuery() }, t.RowQueryEvent}, // Raw
+		{"query", func() *gorm.CallbackProcessor { return db.Callback().Query() }, t.QueryEvent},           // SELECT
+		{"update", func() *gorm.CallbackProcessor { return db.Callback().Update() }, t.UpdateEvent},        // UPDATE
+		{"delete", func() *gorm.CallbackProcessor { return db.Callback().Delete() }, t.DeleteEvent},        // DELETE
+	}
+	for _, cb := range callbacks {
+		if !t.traces(cb.eventType) {
+			continue
+		}
+		p := t.placement(cb.eventType)
+		p.start.register(cb.processor(), cb.eventType, trackScopeKey, cb.start)
+		p.complete.register(cb.processor(), cb.eventType, trackScopeKey+":complete", t.GenericAfterComplete)
+	}
+	if t.strictWhere {
+		db.Callback().Update().Before("gorm:update").Register(trackScopeKey+":require_where", requireWhere)
+		db.Callback().Delete().Before("gorm:delete").Register(trackScopeKey+":require_where", requireWhere)
+	}
 
-	// Update
-	db.Callback().Update().After("gorm:begin_transaction").Register(trackScopeKey, t.UpdateEvent) // UPDATE
-	db.Callback().Update().After("gorm:commit_or_rollback_transaction").Register(trackScopeKey+":complete", t.GenericAfterComplete)
+	return db
+}
 
-	// Delete
-	db.Callback().Delete().After("gorm:begin_transaction").Register(trackScopeKey, t.DeleteEvent) // DELETE
-	db.Callback().Delete().After("gorm:commit_or_rollback_transaction").Register(trackScopeKey+":complete", t.GenericAfterComplete)
+// Untrace removes the callbacks TraceDB registered on db, and every handle
+// sharing its connection. Tracer.Close calls it for every database the
+// tracer traces.
+func Untrace(db *gorm.DB) {
+	cb := db.Callback()
+	for _, cp := range []func() *gorm.CallbackProcessor{cb.Create, cb.RowQuery, cb.Query, cb.Update, cb.Delete} {
+		for _, name := range []string{trackScopeKey, trackScopeKey + ":complete", trackScopeKey + ":require_where"} {
+			if cp().Get(name) != nil {
+				cp().Remove(name)
+			}
+		}
+	}
+	unregister(db)
+}
 
-	return db, &t, func() {
-		t.Close()
+// traces reports whether events of eventType are recorded.
+func (t *Tracer) traces(eventType string) bool {
+	if t.eventTypes == nil {
+		return true
 	}
+	return t.eventTypes[eventType]
 }
 
 func (t *Tracer) GenericAfterComplete(scope *gorm.Scope) {
 	// General rules here
-	key, _ := scope.Get(trackScopeKey)
-	entry := t.Events[key.(string)]
+	entry := t.event(scope)
+	if entry == nil {
+		return
+	}
 	extractFromScope(entry, scope)
+	if entry.TransactionID == "" {
+		// The event started before gorm began the transaction.
+		entry.TransactionID = transactionID(scope)
+	}
+	_, entry.implicitTx = scope.InstanceGet("gorm:started_transaction")
+	if !t.redactVars {
+		entry.SQLVars = append([]interface{}(nil), scope.SQLVars...)
+	}
+	entry.argsHash = argsHash(scope.SQLVars)
+	if t.loopQuery != nil {
+		entry.numericArgs = numericArgs(scope.SQLVars)
+	}
+	if t.wildcards {
+		entry.leadingWildcard = hasLeadingWildcard(scope.SQL, scope.SQLVars)
+	}
+	if t.typeChecks {
+		entry.typeMismatches = typeMismatches(scope)
+	}
+	if t.inList != nil {
+		entry.inListItems = largestInList(scope.SQL, scope.SQLVars)
+	}
+	if t.interpolate && !t.redactVars {
+		entry.Interpolated = Interpolate(scope.SQL, scope.SQLVars, entry.Dialect)
+	}
+	entry.Search = searchClauses(scope, t.redactVars)
+	if entry.EventType == "query" {
+		entry.RowsReturned = rowsReturned(scope)
+		entry.ResultColumns, entry.ResultBytes = resultSize(scope)
+		if t.crossJoin != nil {
+			entry.distinctRows = distinctRows(scope)
+		}
+	}
+	if entry.EventType != "query" && entry.EventType != "row_query" && !t.noPrimaryKeys {
+		entry.PrimaryKeys = primaryKeys(scope, t.pkHashKey)
+	}
+	if entry.EventType == "delete" {
+		entry.SoftDelete = isSoftDelete(scope)
+		entry.hardDelete = isHardDelete(scope, entry.SoftDelete)
+	}
+	if entry.EventType == "update" {
+		entry.Changes = fieldChanges(scope, entry.initialValues, t.changeNames || t.redactVars)
+	}
+	markFailed(entry, scope)
 	t.RunGenericRules(entry, scope)
 	t.CompleteEvent(scope)
 }
@@ -133,10 +506,19 @@ func (t *Tracer) DescribeTables() {
 }
 
 func (t *Tracer) RunGenericRules(event *GormEvent, scope *gorm.Scope) {
+	t.mu.Lock()
+	disabled := t.disabledRules
+	t.mu.Unlock()
+
 	for _, r := range allGenericRules {
-		err := r(event, scope)
+		if disabled[r.name] {
+			continue
+		}
+		err := r.fn(event, scope)
 		if err != nil {
+			t.mu.Lock()
 			t.Errors = append(t.Errors, err)
+			t.mu.Unlock()
 		}
 	}
 }
@@ -167,18 +549,73 @@ func (t *Tracer) EventGenerator(eventType string) func(scope *gorm.Scope) {
 	}
 }
 
+// event returns the event recorded for scope, or nil if it isn't traced.
+func (t *Tracer) event(scope *gorm.Scope) *GormEvent {
+	key, ok := scope.Get(trackScopeKey)
+	if !ok {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.Events[key.(string)]
+}
+
 func (t *Tracer) AddEvent(eventType string, scope *gorm.Scope) {
+	if t.tables != nil && !t.tables[scope.TableName()] {
+		// Clear any key inherited from an enclosing operation.
+		scope.Set(trackScopeKey, "")
+		return
+	}
+
+	// Operations gorm runs on behalf of another, such as saving
+	// associations, inherit its key.
+	parent, _ := scope.Get(trackScopeKey)
+	parentID, _ := parent.(string)
+
 	key := uuid.New().String()
 	scope.Set(trackScopeKey, key)
 
 	e := &GormEvent{
-		StartTime:  time.Now(),
-		EventType:  eventType,
-		InstanceID: scope.InstanceID(),
-		TableName:  scope.TableName(),
-		TestName:   t.testT.Name(),
-		StackTrace: excludeGormStack(debug.Stack()),
+		SchemaVersion:  SchemaVersion,
+		ID:             key,
+		ParentID:       parentID,
+		Sequence:       atomic.AddUint64(&sequence, 1),
+		StartTime:      t.clock.Now(),
+		EventType:      eventType,
+		Tracer:         t.name,
+		Hostname:       t.hostname,
+		PID:            t.pid,
+		Service:        t.file.service,
+		ServiceVersion: t.version,
+		InstanceID:     scope.InstanceID(),
+		Dialect:        scope.Dialect().GetName(),
+		DBHost:         t.target.host,
+		DBName:         t.target.name,
+		Tags:           t.tags,
+		TableName:      scope.TableName(),
+		ModelType:      modelType(scope.Value),
+	}
+	if !t.metricsOnly {
+		e.StackTrace = excludeGormStack(debug.Stack())
+	}
+	if !t.metricsOnly && !t.noCaller {
+		e.Caller, e.CallerFunc = caller(t.callerSkip)
+	}
+	if t.goroutineIDs {
+		e.GoroutineID = goroutineID()
+	}
+	e.Worker = workerOf(scope)
+	e.TransactionID = transactionID(scope)
+	e.priorError = inheritedError(scope)
+
+	if t.testT != nil {
+		e.TestName = t.testT.Name()
+	}
+	t.applyContext(e, scope)
+	if n := attemptOf(scope); n != 0 {
+		e.Attempt = n
 	}
+	e.unsampled = !t.sampled(scope)
 
 	extractFromScope(e, scope)
 
@@ -187,26 +624,147 @@ func (t *Tracer) AddEvent(eventType string, scope *gorm.Scope) {
 		e.Transaction = p.Pointer()
 	}
 
-	for _, f := range scope.Fields() {
-		e.InitialFields = append(e.InitialFields, *f)
+	if !t.metricsOnly {
+		for _, f := range scope.Fields() {
+			e.InitialFields = append(e.InitialFields, *f)
+		}
+	}
+	if eventType == "update" && !t.metricsOnly && !t.changeNames && !t.redactVars {
+		e.initialValues = fieldValues(scope)
+	}
+
+	var rowType reflect.Type
+	if eventType == "query" {
+		e.preloads = preloadFields(scope)
+	}
+	if parentID != "" && (eventType == "query" || eventType == "row_query") {
+		rowType = scope.GetModelStruct().ModelType
 	}
 
+	t.onStart(e, scope)
+
 	t.mu.Lock()
-	defer t.mu.Unlock()
-	t.Events[key] = e
+	if parent := t.Events[parentID]; parent != nil && rowType != nil {
+		e.Preload = parent.takePreload(rowType)
+	}
+	evicted := t.addEvent(key, e)
+	t.mu.Unlock()
+
+	t.writeEvicted(evicted)
 }
 
 func (t *Tracer) CompleteEvent(scope *gorm.Scope) {
 	// Complete the event
-	key, _ := scope.Get(trackScopeKey)
-	entry := t.Events[key.(string)]
-	if entry.IsComplete {
+	key, ok := scope.Get(trackScopeKey)
+	if !ok {
 		return
 	}
 
-	entry.EndTime = time.Now()
+	t.mu.Lock()
+	entry := t.Events[key.(string)]
+	if entry == nil {
+		t.mu.Unlock()
+		return
+	}
+	entry.end(t.clock.Now())
 	entry.IsComplete = true
-	writeEntry(entry)
+	t.removeEvent(key.(string))
+	t.mu.Unlock()
+
+	t.enrich(entry, scope)
+	t.onComplete(entry, scope)
+	violations := t.detect(entry)
+
+	t.metrics.record(entry)
+	t.write(entry)
+	for _, v := range violations {
+		t.write(v)
+	}
+	t.considerExplain(entry, scope)
+	t.watchRows(entry, scope)
+}
+
+// sampled decides whether the operation scope belongs to is recorded. The
+// decision is stored on the scope so statements GORM runs on behalf of the
+// operation, like saving associations, share it.
+func (t *Tracer) sampled(scope *gorm.Scope) bool {
+	if v, ok := scope.Get(sampleScopeKey); ok {
+		return v.(bool)
+	}
+	t.mu.Lock()
+	rate := t.sample
+	t.mu.Unlock()
+
+	sampled := rate >= 1 || rand.Float64() < rate
+	scope.Set(sampleScopeKey, sampled)
+	return sampled
+}
+
+func (t *Tracer) write(event *GormEvent) {
+	if t.metricsOnly {
+		return
+	}
+
+	t.sinkMu.RLock()
+	defer t.sinkMu.RUnlock()
+	if t.sinkClosed {
+		return
+	}
+
+	t.mu.Lock()
+	minDuration := t.minDuration
+	t.mu.Unlock()
+
+	if len(event.Errors) == 0 && event.Violation == nil && (t.errorsOnly || event.unsampled || event.IsComplete && event.Duration < minDuration) {
+		atomic.AddUint64(&t.filtered, 1)
+		return
+	}
+	if t.redactVars {
+		event.SQLVars = nil
+	}
+	if t.verbosity == VerbositySummary {
+		event.Query = ""
+		event.Interpolated = ""
+		event.SQLVars = nil
+		event.Vars = nil
+		event.StackTrace = ""
+		event.Caller = ""
+		event.CallerFunc = ""
+		event.Search = nil
+		event.Changes = nil
+	}
+	if err := t.sink.Write(event); err != nil {
+		t.sinkError(err)
+		return
+	}
+	atomic.AddUint64(&t.written, 1)
+}
+
+func (t *Tracer) sinkError(err error) {
+	atomic.AddUint64(&t.failed, 1)
+	if t.onError != nil {
+		t.onError(err)
+	}
+}
+
+// Flush flushes the tracer's sink.
+func (t *Tracer) Flush() error {
+	return t.sink.Flush()
+}
+
+// Stats reports how many events were written, failed or dropped so far.
+func (t *Tracer) Stats() TracerStats {
+	stats := TracerStats{
+		Written:    atomic.LoadUint64(&t.written),
+		Failed:     atomic.LoadUint64(&t.failed),
+		Filtered:   atomic.LoadUint64(&t.filtered),
+		Evicted:    atomic.LoadUint64(&t.evicted),
+		Suppressed: atomic.LoadUint64(&t.suppressed),
+	}
+	if d, ok := t.sink.(dropCounter); ok {
+		stats.Dropped = d.Dropped()
+	}
+	return stats
 }
 
 var knownAttrs = []string{
@@ -215,6 +773,44 @@ var knownAttrs = []string{
 	"gorm:delete_option",
 	"gorm:started_transaction",
 	"gorm:table_options",
+	TagKey,
+	AnnotationsKey,
+}
+
+// modelType names the Go type of the value an operation works on, such as
+// *models.Account or *[]models.Account.
+func modelType(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// isSoftDelete reports whether a delete only set the deleted_at column of
+// the rows, which gorm does for models with a DeletedAt field unless the
+// delete is Unscoped.
+func isSoftDelete(scope *gorm.Scope) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(scope.SQL)), "UPDATE")
+}
+
+// rowsReturned counts the rows a query scanned into its destination: the
+// length of a slice, or one for a struct that was found. Unlike
+// RowsAffected it doesn't depend on what the driver reports.
+func rowsReturned(scope *gorm.Scope) int64 {
+	if scope.Value == nil {
+		return 0
+	}
+	v := scope.IndirectValue()
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return int64(v.Len())
+	case reflect.Struct:
+		if scope.DB().RecordNotFound() || scope.HasError() {
+			return 0
+		}
+		return 1
+	}
+	return 0
 }
 
 func copyScopeAttrs(scope *gorm.Scope) map[string]interface{} {
@@ -229,18 +825,90 @@ func copyScopeAttrs(scope *gorm.Scope) map[string]interface{} {
 
 func extractFromScope(entry *GormEvent, scope *gorm.Scope) {
 	entry.Query = scope.SQL
+	entry.Fingerprint = Fingerprint(scope.SQL)
 	entry.RowsAffected = scope.DB().RowsAffected
 	entry.Errors = scope.DB().GetErrors()
+	entry.HasError = len(entry.Errors) > 0
 	entry.Vars = copyScopeAttrs(scope)
 }
 
+// Close shuts the tracer down: it stops accepting events and removes its
+// callbacks, writes the events of operations that never completed, then
+// flushes and closes the sink, which drains asynchronous queues and syncs
+// files to disk. Concurrent calls wait for the first to finish. gorm's
+// callbacks can't change while statements run, so close the tracer once
+// the database is no longer in use.
 func (t *Tracer) Close() {
+	t.closeOnce.Do(t.shutdown)
+}
+
+func (t *Tracer) shutdown() {
+	t.mu.Lock()
+	t.closed = true
+	traced := t.traced
+	for _, stop := range t.stopReload {
+		stop()
+	}
+	var pending []*GormEvent
+	for key, e := range t.Events {
+		pending = append(pending, e)
+		t.removeEvent(key)
+	}
+	t.mu.Unlock()
+
+	for _, db := range traced {
+		// Leave alone databases another tracer has taken over.
+		if tracerOf(db) == t {
+			Untrace(db)
+		}
+	}
+	for _, e := range pending {
+		e.end(t.clock.Now())
+		t.write(e)
+	}
+	if t.explain != nil {
+		t.explain.stop()
+	}
+	if t.leakedRows != nil {
+		t.leakedRows.stop()
+	}
+	if t.fullCount != nil {
+		t.fullCount.wait()
+	}
+
+	// Wait for writes in flight, and turn away later ones.
+	t.sinkMu.Lock()
+	defer t.sinkMu.Unlock()
+	t.sinkClosed = true
+	if err := t.sink.Flush(); err != nil {
+		t.sinkError(err)
+	}
+	if err := t.sink.Close(); err != nil {
+		t.sinkError(err)
+	}
+}
+
+// SetSampleRate changes the sample rate of operations starting from now
+// on, see WithSampleRate.
+func (t *Tracer) SetSampleRate(rate float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sample = rate
+}
+
+// PendingEvents returns the events of operations that have started but not
+// completed yet.
+func (t *Tracer) PendingEvents() []*GormEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var pending []*GormEvent
 	for _, e := range t.Events {
 		if !e.IsComplete {
-			e.EndTime = time.Now()
-			writeEntry(e)
+			pending = append(pending, e)
 		}
 	}
+	return pending
 }
 
 func RuleError(msg string, args ...interface{}) error {
@@ -260,7 +928,7 @@ func NoWhereClauseInSelect(event *GormEvent, scope *gorm.Scope) error {
 }
 
 func NoWhereClauseInDelete(event *GormEvent, scope *gorm.Scope) error {
-	if event.EventType == "delete" && len(scope.SQLVars) == 0 {
+	if event.EventType == "delete" && missingWhere(scope) {
 		event.Warnings = append(event.Warnings, "no_where_delete")
 		return RuleError("no where clause in delete")
 	}
@@ -268,7 +936,7 @@ func NoWhereClauseInDelete(event *GormEvent, scope *gorm.Scope) error {
 }
 
 func NoWhereClauseInUpdate(event *GormEvent, scope *gorm.Scope) error {
-	if event.EventType == "update" && len(scope.SQLVars) == 0 {
+	if event.EventType == "update" && missingWhere(scope) {
 		event.Warnings = append(event.Warnings, "no_where_update")
 		return RuleError("no where clause in update")
 	}
@@ -298,11 +966,30 @@ func InsertWithBlanks(event *GormEvent, scope *gorm.Scope) error {
 	return nil
 }
 
-var allGenericRules = []RuleFunc{
-	NoWhereClauseInSelect,
-	NoWhereClauseInUpdate,
-	NoWhereClauseInDelete,
-	InsertWithBlanks,
+// blankInsertDetector reports the creates flagged by the
+// zero_insert_value rule as violations.
+type blankInsertDetector struct{}
+
+func (blankInsertDetector) rule() string { return "zero_insert_value" }
+
+func (d blankInsertDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "create" || !hasWarning(e, d.rule()) {
+		return nil
+	}
+	return singleViolation(d.rule(), e, fmt.Sprintf("create of %s inserted zero values", e.TableName))
+}
+
+// namedRule names a rule after the warning it adds.
+type namedRule struct {
+	name string
+	fn   RuleFunc
+}
+
+var allGenericRules = []namedRule{
+	{"no_where_clause", NoWhereClauseInSelect},
+	{"no_where_update", NoWhereClauseInUpdate},
+	{"no_where_delete", NoWhereClauseInDelete},
+	{"zero_insert_value", InsertWithBlanks},
 }
 
 // excludeGormStack embarassingly hacked together :x
@@ -49,7 +49,7 @@ func prepareDatabase(testT *testing.T) (*gorm.DB, *Tracer, func(), error) {
 	db = db.Debug()
 
 	// Add the GORMSanity Tracer
-	db, tracer, closer := TraceDB(db, testT)
+	db, tracer := TraceDB(db, WithTest(testT))
 	tracer.dontFail = true
 
 	// Create our test schema
@@ -64,7 +64,7 @@ func prepareDatabase(testT *testing.T) (*gorm.DB, *Tracer, func(), error) {
 		)
 	`)
 
-	return db, tracer, closer, nil
+	return db, tracer, tracer.Close, nil
 }
 
 func (s *AccountTestSuite) SetupTest() {
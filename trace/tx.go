@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+)
+
+// txScopeKey holds the ID of the transaction an operation runs in, so
+// statements gorm runs on its behalf, like saving associations, share it.
+const txScopeKey = trackScopeKey + ":transaction"
+
+// txTracerKey holds the tracer of a transaction begun with Begin, which
+// can't be found from the transaction's handle, see tracerOf.
+const txTracerKey = trackScopeKey + ":transaction_tracer"
+
+// Begin starts a transaction like db.Begin, recording one transaction ID
+// on the events of every operation run on the returned handle.
+// Transactions gorm starts itself for writes get their own IDs. End it
+// with Commit or Rollback for its length to be judged, see
+// WithLongTransactionDetection.
+func Begin(db *gorm.DB) *gorm.DB {
+	t := tracerOf(db)
+	id := uuid.New().String()
+	tx := db.Begin().Set(txScopeKey, id)
+	if t != nil && tx.Error == nil {
+		if t.longTx != nil {
+			t.longTx.begin(id, t.clock.Now())
+		}
+		tx = tx.Set(txTracerKey, t)
+	}
+	return tx
+}
+
+// Commit commits a transaction begun with Begin like tx.Commit.
+func Commit(tx *gorm.DB) *gorm.DB {
+	defer endTransaction(tx)
+	return tx.Commit()
+}
+
+// Rollback rolls back a transaction begun with Begin like tx.Rollback.
+func Rollback(tx *gorm.DB) *gorm.DB {
+	defer endTransaction(tx)
+	return tx.Rollback()
+}
+
+func endTransaction(tx *gorm.DB) {
+	t, _ := tx.Get(txTracerKey)
+	id, _ := tx.Get(txScopeKey)
+	if t, ok := t.(*Tracer); ok && id != nil {
+		t.endTransaction(id.(string))
+	}
+}
+
+// transactionID returns the ID of the transaction scope runs in, creating
+// one when gorm has just begun it.
+func transactionID(scope *gorm.Scope) string {
+	if v, ok := scope.Get(txScopeKey); ok {
+		return v.(string)
+	}
+	if _, ok := scope.InstanceGet("gorm:started_transaction"); ok {
+		id := uuid.New().String()
+		scope.Set(txScopeKey, id)
+		return id
+	}
+	return ""
+}
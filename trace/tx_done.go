@@ -0,0 +1,28 @@
+package trace
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// txDoneDetector flags operations run on a transaction that was already
+// committed or rolled back. gorm only records the error on the handle it
+// returns, so it goes unnoticed unless checked, and usually means the
+// transaction's control flow is broken: the operation ran outside it, or
+// not at all.
+type txDoneDetector struct{}
+
+func (txDoneDetector) rule() string { return "tx_done" }
+
+func (d txDoneDetector) observe(e *GormEvent) []*Violation {
+	done := false
+	for _, err := range e.Errors {
+		done = done || err == sql.ErrTxDone
+	}
+	if !done {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	msg := fmt.Sprintf("%s on %s ran on a transaction already committed or rolled back", e.EventType, e.TableName)
+	return singleViolation(d.rule(), e, msg)
+}
@@ -0,0 +1,41 @@
+package trace
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_TxDone(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithoutRules("no_where_clause", "zero_insert_value"))
+	tx := Begin(db)
+	a.NoError(tx.Create(&models.Account{EmailAddress: "tx@acme.com", Status: models.Status_Active}).Error)
+	a.NoError(tx.Commit().Error)
+	a.Equal(sql.ErrTxDone, tx.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	rolledBack := db.Begin()
+	a.NoError(rolledBack.Rollback().Error)
+	a.Error(rolledBack.Delete(&models.Account{Id: 1}).Error)
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "tx_done"))
+	}
+	a.Equal([]bool{false, true, true}, flagged)
+	a.Len(violations, 2)
+	a.Equal("tx_done", violations[0].Rule)
+	a.Regexp(`^query on accounts ran on a transaction already committed or rolled back at .*tx_done_test.go:\d+$`, violations[0].Message)
+	a.Contains(violations[1].Message, "delete on accounts ran on a transaction already committed or rolled back")
+}
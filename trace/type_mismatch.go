@@ -0,0 +1,150 @@
+package trace
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// comparison matches a column compared to a bind value, capturing the
+// table the column is qualified with, the column and the placeholder.
+var comparison = regexp.MustCompile(`(?i)(?:"?(\w+)"?\.)?"?(\w+)"?\s*(?:=|<>|!=|<=|>=|<|>|\bIN\s*\()\s*(\$\d+|\?)`)
+
+// typeMismatch is a column compared to a value of another type.
+type typeMismatch struct {
+	column, columnType, valueType string
+}
+
+// typeMismatchDetector flags conditions comparing a column to a value of
+// another type, such as an integer column to a string, which makes the
+// database convert the column and so keeps it from using its index, see
+// WithTypeMismatchDetection.
+type typeMismatchDetector struct{}
+
+func (typeMismatchDetector) rule() string { return "type_mismatch" }
+
+func (d typeMismatchDetector) observe(e *GormEvent) []*Violation {
+	if len(e.typeMismatches) == 0 {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	var descs []string
+	for _, m := range e.typeMismatches {
+		descs = append(descs, fmt.Sprintf("%s, a %s column, to a %s", m.column, m.columnType, m.valueType))
+	}
+	msg := fmt.Sprintf("%s on %s compares %s; converting the column can keep its index from being used", e.EventType, e.TableName, strings.Join(descs, " and "))
+	return singleViolation(d.rule(), e, msg)
+}
+
+// typeMismatches finds the columns of scope's model that its statement
+// compares to values of another type.
+func typeMismatches(scope *gorm.Scope) []typeMismatch {
+	if scope.Value == nil || len(scope.SQLVars) == 0 {
+		return nil
+	}
+	columns := map[string]string{}
+	for _, f := range scope.GetModelStruct().StructFields {
+		if f.IsNormal && !f.IsIgnored {
+			if typ := typeClass(f.Struct.Type); typ != "" {
+				columns[f.DBName] = typ
+			}
+		}
+	}
+	table := scope.TableName()
+
+	var mismatches []typeMismatch
+	query := scope.SQL
+	for _, m := range comparison.FindAllStringSubmatchIndex(query, -1) {
+		if m[2] >= 0 && query[m[2]:m[3]] != table {
+			continue
+		}
+		column := query[m[4]:m[5]]
+		columnType, ok := columns[column]
+		if !ok {
+			continue
+		}
+		v, ok := bindValue(query, m[6], query[m[6]:m[7]], scope.SQLVars)
+		if !ok {
+			continue
+		}
+		if valueType := valueClass(v); valueType != "" && valueType != columnType {
+			mismatches = append(mismatches, typeMismatch{column, columnType, valueType})
+		}
+	}
+	return mismatches
+}
+
+// bindValue returns the value of the placeholder at offset at in query.
+func bindValue(query string, at int, placeholder string, vars []interface{}) (interface{}, bool) {
+	n := strings.Count(fingerprintStrings.ReplaceAllString(query[:at], "''"), "?")
+	if strings.HasPrefix(placeholder, "$") {
+		n, _ = strconv.Atoi(placeholder[1:])
+		n--
+	}
+	if n < 0 || n >= len(vars) {
+		return nil, false
+	}
+	return vars[n], true
+}
+
+var nullTypes = map[reflect.Type]string{
+	reflect.TypeOf(sql.NullString{}):  "string",
+	reflect.TypeOf(sql.NullInt64{}):   "number",
+	reflect.TypeOf(sql.NullInt32{}):   "number",
+	reflect.TypeOf(sql.NullFloat64{}): "number",
+	reflect.TypeOf(sql.NullBool{}):    "boolean",
+	reflect.TypeOf(sql.NullTime{}):    "time",
+}
+
+// typeClass groups the Go types of columns and values by how the database
+// compares them, returning "" for types it can't tell.
+func typeClass(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return "time"
+	}
+	if class, ok := nullTypes[t]; ok {
+		return class
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	}
+	return ""
+}
+
+// valueClass is typeClass for a bind value, as the driver will be given
+// it.
+func valueClass(v interface{}) string {
+	if valuer, ok := v.(driver.Valuer); ok && !nilPointer(v) {
+		var err error
+		if v, err = valuer.Value(); err != nil {
+			return ""
+		}
+	}
+	if v == nil {
+		return ""
+	}
+	return typeClass(reflect.TypeOf(v))
+}
+
+// nilPointer reports whether v is a nil pointer, which database/sql binds
+// as NULL without calling its Value method.
+func nilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
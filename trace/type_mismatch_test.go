@@ -0,0 +1,49 @@
+package trace
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_TypeMismatch(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithTypeMismatchDetection())
+	a.NoError(db.Where("id = ?", "42").Find(&[]models.Account{}).Error)
+	a.NoError(db.Where("id = ? AND email_address = ?", 42, "jane@acme.com").Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 3)
+	a.True(hasWarning(events[0], "type_mismatch"))
+	a.Equal("type_mismatch", events[1].Violation.Rule)
+	a.Regexp(`^query on accounts compares id, a number column, to a string; converting the column can keep its index from being used at .*type_mismatch_test.go:\d+$`, events[1].Violation.Message)
+	a.False(hasWarning(events[2], "type_mismatch"))
+}
+
+type nullableAccount struct {
+	ID           int `gorm:"primary_key"`
+	EmailAddress *sql.NullString
+}
+
+func (nullableAccount) TableName() string { return "accounts" }
+
+func TestTracer_TypeMismatch_NilValuer(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithTypeMismatchDetection())
+	a.NoError(db.Save(&nullableAccount{ID: 1}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 1)
+	a.False(hasWarning(events[0], "type_mismatch"))
+}
@@ -0,0 +1,34 @@
+package trace
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var limitKeyword = regexp.MustCompile(`(?i)\b(?:LIMIT|FETCH\s+FIRST|TOP)\b`)
+
+// unboundedReadDetector flags queries without a limit returning more than
+// maxRows rows, which load whole tables into memory as they grow, see
+// WithUnboundedReadDetection.
+type unboundedReadDetector struct {
+	maxRows int64
+}
+
+func (d unboundedReadDetector) rule() string { return "unbounded_read" }
+
+func (d unboundedReadDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "query" || e.RowsReturned <= d.maxRows || hasLimit(e) {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	return singleViolation(d.rule(), e, fmt.Sprintf("query on %s without a limit returned %d rows", e.TableName, e.RowsReturned))
+}
+
+// hasLimit reports whether e's query was limited, by gorm's Limit or in
+// its SQL.
+func hasLimit(e *GormEvent) bool {
+	if e.Search != nil && e.Search.Limit != "" && e.Search.Limit != "-1" {
+		return true
+	}
+	return limitKeyword.MatchString(fingerprintStrings.ReplaceAllString(e.Query, "?"))
+}
@@ -0,0 +1,39 @@
+package trace
+
+import (
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_UnboundedRead(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	sink := &memorySink{}
+	fdb.rows = func(query string, args []driver.Value) ([]string, [][]driver.Value) {
+		return []string{"id"}, [][]driver.Value{{int64(1)}, {int64(2)}, {int64(3)}}
+	}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithUnboundedReadDetection(2), WithoutRules("no_where_clause", "zero_insert_value"))
+	a.NoError(db.Find(&[]models.Account{}).Error)
+	a.NoError(db.Limit(3).Find(&[]models.Account{}).Error)
+	a.NoError(db.Raw("SELECT * FROM accounts LIMIT 3").Find(&[]models.Account{}).Error)
+	a.NoError(db.First(&models.Account{}).Error)
+	tracer.Close()
+
+	var unbounded []bool
+	var violations int
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations++
+			a.Equal("unbounded_read", e.Violation.Rule)
+			continue
+		}
+		unbounded = append(unbounded, hasWarning(e, "unbounded_read"))
+	}
+	a.Equal([]bool{true, false, false, false}, unbounded)
+	a.Equal(1, violations)
+}
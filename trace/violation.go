@@ -0,0 +1,129 @@
+package trace
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+)
+
+// ViolationEventType is the event type of violations, see Violation.
+const ViolationEventType = "violation"
+
+// Violation describes a problem found by looking across operations rather
+// than at one, such as an N+1 query. It's written as an event of type
+// ViolationEventType, carrying the details of the operation that revealed
+// it, in GormEvent.Violation.
+type Violation struct {
+	// Rule names the detector, as passed to WithoutRules.
+	Rule string `json:"rule"`
+	// Severity is how serious breaking the rule is, see WithRuleSeverity.
+	Severity Severity `json:"severity,omitempty"`
+	Message  string   `json:"message"`
+	// Count is how many operations make up the violation.
+	Count int `json:"count,omitempty"`
+	// Events are the IDs of the events of those operations.
+	Events []string `json:"events,omitempty"`
+	// Plan is the query plan that revealed the violation, see WithExplain.
+	Plan string `json:"plan,omitempty"`
+	// Cost is the planner's estimate of the cost of the plan's offending
+	// step, in its own units, when it gives one.
+	Cost float64 `json:"cost,omitempty"`
+}
+
+// detector finds violations across the events of completed operations.
+// observe is called with each event before it's written, and may add
+// warnings to it.
+type detector interface {
+	rule() string
+	observe(e *GormEvent) []*Violation
+}
+
+// singleViolation is the violation of rule by e's operation alone,
+// described by msg followed by the code that issued it.
+func singleViolation(rule string, e *GormEvent, msg string) []*Violation {
+	if e.Caller != "" {
+		msg += " at " + e.Caller
+	}
+	return []*Violation{{
+		Rule:    rule,
+		Message: msg,
+		Count:   1,
+		Events:  []string{e.ID},
+	}}
+}
+
+// detect runs the enabled detectors on e, returning the events of the
+// violations found.
+func (t *Tracer) detect(e *GormEvent) []*GormEvent {
+	if t.metricsOnly || len(t.detectors) == 0 {
+		return nil
+	}
+	t.mu.Lock()
+	disabled := t.disabledRules
+	t.mu.Unlock()
+
+	var events []*GormEvent
+	for _, d := range t.detectors {
+		if disabled[d.rule()] {
+			continue
+		}
+		for _, v := range d.observe(e) {
+			events = append(events, t.violationEvent(e, v))
+		}
+	}
+	if t.ruleWindows != nil {
+		t.ruleWindows.add(e)
+	}
+	return t.suppressViolations(e, events)
+}
+
+// reportViolation writes the event of v, found apart from completing an
+// operation, unless its rule is disabled or it's suppressed.
+func (t *Tracer) reportViolation(trigger *GormEvent, v *Violation) {
+	if t.metricsOnly {
+		return
+	}
+	t.mu.Lock()
+	disabled := t.disabledRules[v.Rule]
+	t.mu.Unlock()
+	switch {
+	case disabled:
+	case t.suppresses(v.Rule, trigger):
+		atomic.AddUint64(&t.suppressed, 1)
+	default:
+		t.write(t.violationEvent(trigger, v))
+	}
+}
+
+// violationEvent describes v with the details of trigger, the event that
+// revealed it, ranking v by the severity of its rule.
+func (t *Tracer) violationEvent(trigger *GormEvent, v *Violation) *GormEvent {
+	if v.Severity == "" {
+		v.Severity = t.severity(v.Rule)
+	}
+	e := *trigger
+	e.ID = uuid.New().String()
+	e.ParentID = ""
+	e.EventType = ViolationEventType
+	e.StartTime = trigger.EndTime
+	e.Duration = 0
+	e.IsComplete = true
+	e.Warnings = []string{v.Rule}
+	e.Violation = v
+	e.unsampled = false
+	e.preloads = nil
+	e.initialValues = nil
+	return &e
+}
+
+// argsHash identifies the values a statement was run with.
+func argsHash(vars []interface{}) string {
+	if len(vars) == 0 {
+		return ""
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%#v", vars)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,295 @@
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// WebSocketSink streams events to WebSocket clients for watching queries
+// live. It's an http.Handler: WebSocket requests are subscribed to every
+// event written from then on, as JSON text messages unless another
+// Formatter is set, and plain requests get a page that connects and shows
+// the stream. Clients that can't keep up miss events rather than slowing
+// down the application; see Dropped.
+//
+//	sink := trace.NewWebSocketSink()
+//	go http.ListenAndServe("localhost:7070", sink)
+//
+// Browsers let any page open a WebSocket to any host, so connections from
+// pages served by other hosts than the sink's are refused unless listed in
+// AllowedOrigins, lest they read the application's queries.
+type WebSocketSink struct {
+	Formatter Formatter
+	// ClientBuffer is the number of messages queued per client before
+	// events are dropped for it.
+	ClientBuffer int
+	// AllowedOrigins lists the other origins, such as
+	// "https://dashboard.internal", or hosts, such as "localhost:3000",
+	// whose pages may connect.
+	AllowedOrigins []string
+
+	dropped uint64
+
+	mu      sync.Mutex
+	closed  bool
+	clients map[*wsClient]struct{}
+}
+
+type wsClient struct {
+	send chan []byte
+}
+
+// NewWebSocketSink creates a sink streaming JSON events.
+func NewWebSocketSink() *WebSocketSink {
+	return &WebSocketSink{
+		Formatter:    JSONFormatter{},
+		ClientBuffer: 256,
+		clients:      map[*wsClient]struct{}{},
+	}
+}
+
+// Dropped returns the number of messages discarded because a client's
+// buffer was full.
+func (s *WebSocketSink) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (s *WebSocketSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, websocketPage)
+		return
+	}
+
+	if !s.allowOrigin(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client := &wsClient{send: make(chan []byte, s.ClientBuffer)}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		http.Error(w, "sink closed", http.StatusServiceUnavailable)
+		return
+	}
+	s.clients[client] = struct{}{}
+	s.mu.Unlock()
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		s.remove(client)
+		return
+	}
+
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		s.remove(client)
+		conn.Close()
+		return
+	}
+
+	go func() {
+		wsReadUntilClose(rw.Reader)
+		s.remove(client)
+	}()
+	s.writeLoop(conn, client)
+}
+
+// allowOrigin reports whether the page r comes from may connect: requests
+// without an Origin aren't from browsers, and same host ones are the page
+// served by the sink.
+func (s *WebSocketSink) allowOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range s.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) || strings.EqualFold(allowed, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+// remove unsubscribes client, closing its queue so its writer finishes.
+func (s *WebSocketSink) remove(client *wsClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.clients[client]; ok {
+		delete(s.clients, client)
+		close(client.send)
+	}
+}
+
+func (s *WebSocketSink) writeLoop(conn net.Conn, client *wsClient) {
+	defer conn.Close()
+	for msg := range client.send {
+		if _, err := conn.Write(wsFrame(0x1, msg)); err != nil {
+			s.remove(client)
+			for range client.send {
+			}
+			return
+		}
+	}
+	conn.Write(wsFrame(0x8, nil))
+}
+
+// wsFrame encodes an unmasked, unfragmented server frame.
+func wsFrame(opcode byte, payload []byte) []byte {
+	frame := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(n))
+	default:
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// wsReadUntilClose discards client frames until a close frame arrives or
+// the connection fails.
+func wsReadUntilClose(r *bufio.Reader) {
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return
+		}
+		if header[0]&0x0f == 0x8 {
+			return
+		}
+
+		n := uint64(header[1] & 0x7f)
+		switch n {
+		case 126:
+			var ext [2]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			if _, err := io.ReadFull(r, ext[:]); err != nil {
+				return
+			}
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		if header[1]&0x80 != 0 {
+			n += 4 // masking key
+		}
+		if _, err := io.CopyN(ioutil.Discard, r, int64(n)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *WebSocketSink) Write(event *GormEvent) error {
+	record, err := s.Formatter.Format(event)
+	if err != nil {
+		return err
+	}
+	record = bytes.TrimRight(record, "\n")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+
+	for client := range s.clients {
+		select {
+		case client.send <- record:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+	return nil
+}
+
+func (s *WebSocketSink) Flush() error {
+	return nil
+}
+
+// Close disconnects every client.
+func (s *WebSocketSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for client := range s.clients {
+		delete(s.clients, client)
+		close(client.send)
+	}
+	return nil
+}
+
+const websocketPage = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gormsanity</title>
+<style>
+body { font-family: monospace; margin: 0; }
+div { border-bottom: 1px solid #ddd; padding: 4px 8px; white-space: pre-wrap; }
+.error { background: #fdd; }
+</style>
+</head>
+<body>
+<script>
+var ws = new WebSocket(location.href.replace(/^http/, "ws"));
+ws.onmessage = function (msg) {
+	var div = document.createElement("div");
+	div.textContent = msg.data;
+	try {
+		var e = JSON.parse(msg.data);
+		div.textContent = e.start_time + " " + e.event_type + " " + e.query;
+		if (e.errors && e.errors.length) div.className = "error";
+	} catch (err) {}
+	document.body.insertBefore(div, document.body.firstChild);
+};
+</script>
+</body>
+</html>
+`
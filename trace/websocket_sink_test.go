@@ -0,0 +1,115 @@
+package trace
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebSocketAccept(t *testing.T) {
+	// Example from RFC 6455 section 1.3.
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="))
+}
+
+func TestWebSocketSink(t *testing.T) {
+	a := require.New(t)
+	sink := NewWebSocketSink()
+	srv := httptest.NewServer(sink)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	a.NoError(err)
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	a.Contains(string(page), "new WebSocket")
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	a.NoError(err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	io.WriteString(conn, "GET / HTTP/1.1\r\n"+
+		"Host: localhost\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n"+
+		"Sec-WebSocket-Version: 13\r\n\r\n")
+
+	r := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(r, nil)
+	a.NoError(err)
+	a.Equal(http.StatusSwitchingProtocols, resp.StatusCode)
+	a.Equal("s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	a.NoError(sink.Write(&GormEvent{EventType: "query", Query: "SELECT 1"}))
+
+	header := make([]byte, 2)
+	_, err = io.ReadFull(r, header)
+	a.NoError(err)
+	a.Equal(byte(0x81), header[0], "final text frame")
+	a.Equal(byte(126), header[1], "16 bit length")
+	ext := make([]byte, 2)
+	_, err = io.ReadFull(r, ext)
+	a.NoError(err)
+	payload := make([]byte, int(ext[0])<<8|int(ext[1]))
+	_, err = io.ReadFull(r, payload)
+	a.NoError(err)
+
+	event, err := DecodeEvent(payload)
+	a.NoError(err)
+	a.Equal("SELECT 1", event.Query)
+
+	a.NoError(sink.Close())
+	_, err = io.ReadFull(r, header)
+	a.NoError(err)
+	a.Equal(byte(0x88), header[0], "close frame")
+	a.Equal(errSinkClosed, sink.Write(&GormEvent{}))
+}
+
+func TestWSFrame(t *testing.T) {
+	a := require.New(t)
+	a.Equal([]byte{0x81, 2, 'h', 'i'}, wsFrame(0x1, []byte("hi")))
+
+	long := wsFrame(0x1, make([]byte, 300))
+	a.Equal([]byte{0x81, 126, 0x01, 0x2c}, long[:4])
+	a.Len(long, 304)
+}
+
+func TestWebSocketSink_Origin(t *testing.T) {
+	a := require.New(t)
+	sink := NewWebSocketSink()
+	sink.AllowedOrigins = []string{"https://dashboard.internal", "localhost:3000"}
+
+	for origin, allowed := range map[string]bool{
+		"":                           true,
+		"http://localhost:7070":      true,
+		"https://dashboard.internal": true,
+		"http://localhost:3000":      true,
+		"https://evil.example":       false,
+		"http://localhost:7071":      false,
+		"null":                       false,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "http://localhost:7070/", nil)
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		sink.ServeHTTP(w, r)
+		if allowed {
+			// Past the origin check the recorder can't be hijacked.
+			a.Equal(http.StatusInternalServerError, w.Code, origin)
+		} else {
+			a.Equal(http.StatusForbidden, w.Code, origin)
+		}
+	}
+}
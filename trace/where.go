@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ErrMissingWhere is the error updates and deletes without conditions fail
+// with when the tracer is strict about them, see WithStrictWhere.
+var ErrMissingWhere = errors.New("gormsanity: update or delete without conditions")
+
+var (
+	whereKeyword = regexp.MustCompile(`(?i)\bWHERE\b`)
+	// softDeleteOnly matches the condition gorm adds to statements on
+	// models with a DeletedAt field, which doesn't narrow them down.
+	softDeleteOnly = regexp.MustCompile(`(?i)\bWHERE\s+(?:"?\w+"?\.)?"?deleted_at"?\s+IS\s+NULL\s*$`)
+)
+
+// hasWhere reports whether query has a WHERE clause, besides the one
+// excluding soft deleted rows.
+func hasWhere(query string) bool {
+	q := fingerprintStrings.ReplaceAllString(query, "?")
+	return whereKeyword.MatchString(q) && !softDeleteOnly.MatchString(q)
+}
+
+// hasConditions reports whether the rows scope's statement works on are
+// narrowed down, by conditions or the primary key of its model.
+func hasConditions(scope *gorm.Scope) bool {
+	if scope.Value != nil && scope.IndirectValue().Kind() == reflect.Struct && !scope.PrimaryKeyZero() {
+		return true
+	}
+	c := searchClauses(scope, true)
+	return c != nil && (len(c.Where) > 0 || len(c.Or) > 0 || len(c.Not) > 0)
+}
+
+// missingWhere reports whether scope's statement works on every row.
+func missingWhere(scope *gorm.Scope) bool {
+	return !hasConditions(scope) && !hasWhere(scope.SQL)
+}
+
+// requireWhere fails updates and deletes without conditions before they
+// run, see WithStrictWhere.
+func requireWhere(scope *gorm.Scope) {
+	if !hasConditions(scope) {
+		scope.Err(ErrMissingWhere)
+	}
+}
+
+// missingWhereDetector reports the queries, updates or deletes flagged by
+// the no_where_clause, no_where_update and no_where_delete rules as
+// violations, as they read or change every row of a table.
+type missingWhereDetector struct {
+	eventType, name string
+}
+
+func (d missingWhereDetector) rule() string { return d.name }
+
+func (d missingWhereDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != d.eventType || !hasWarning(e, d.name) {
+		return nil
+	}
+	outcome := fmt.Sprintf("affected %d rows", e.RowsAffected)
+	if d.eventType == "query" {
+		outcome = fmt.Sprintf("returned %d rows", e.RowsReturned)
+	}
+	return singleViolation(d.name, e, fmt.Sprintf("%s of %s without conditions %s", d.eventType, e.TableName, outcome))
+}
+
+func hasWarning(e *GormEvent, warning string) bool {
+	for _, w := range e.Warnings {
+		if w == warning {
+			return true
+		}
+	}
+	return false
+}
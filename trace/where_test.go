@@ -0,0 +1,94 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestHasWhere(t *testing.T) {
+	a := require.New(t)
+	a.True(hasWhere(`UPDATE "accounts" SET "status" = $1 WHERE (id = $2)`))
+	a.False(hasWhere(`UPDATE "accounts" SET "status" = $1`))
+	a.False(hasWhere(`UPDATE "accounts" SET "nick_name" = 'somewhere'`))
+	a.False(hasWhere(`UPDATE "test_notes" SET "deleted_at"=$1  WHERE "test_notes"."deleted_at" IS NULL`))
+	a.True(hasWhere(`UPDATE "test_notes" SET "deleted_at"=$1  WHERE (id = $2) AND "test_notes"."deleted_at" IS NULL`))
+}
+
+func TestTracer_MissingWhere(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink))
+	a.NoError(db.Model(&models.Account{}).Updates(map[string]interface{}{"status": models.Status_Disabled}).Error)
+	a.NoError(db.Model(&models.Account{Id: 1}).Updates(map[string]interface{}{"status": models.Status_Disabled}).Error)
+	a.NoError(db.Delete(&testNote{}).Error)
+	a.NoError(db.Where("id = ?", 1).Delete(&testNote{}).Error)
+	tracer.Close()
+
+	var warnings [][]string
+	var violations []string
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation.Rule)
+			continue
+		}
+		warnings = append(warnings, e.Warnings)
+	}
+	a.Equal([][]string{{"no_where_update"}, nil, {"no_where_delete"}, nil}, warnings)
+	a.Equal([]string{"no_where_update", "no_where_delete"}, violations)
+}
+
+func TestTracer_NoWhereClauseInSelect(t *testing.T) {
+	a := require.New(t)
+	db, _ := openFakeDB(t)
+	sink := &memorySink{}
+
+	traced, tracer := TraceDB(db, WithSink(sink), WithRuleSeverity("no_where_clause", SeverityWarn))
+	a.NoError(traced.Find(&[]models.Account{}).Error)
+	a.NoError(traced.Where("id = ?", 1).Find(&[]models.Account{}).Error)
+	tracer.Close()
+
+	events := sink.Events()
+	a.Len(events, 3)
+	a.Equal([]string{"no_where_clause"}, events[0].Warnings)
+	v := events[1].Violation
+	a.Equal("no_where_clause", v.Rule)
+	a.Equal(SeverityWarn, v.Severity)
+	a.Regexp(`^query of accounts without conditions returned 0 rows at .*where_test.go:\d+$`, v.Message)
+	a.Equal([]string{events[0].ID}, v.Events)
+	a.Empty(events[2].Warnings)
+
+	// Suppressed like the other rules.
+	sink = &memorySink{}
+	traced, tracer = TraceDB(db, WithSink(sink), WithSuppressions(Suppression{Rule: "no_where_clause"}))
+	a.NoError(traced.Find(&[]models.Account{}).Error)
+	tracer.Close()
+	a.Len(sink.Events(), 1)
+	a.Empty(sink.Events()[0].Warnings)
+	a.Equal(uint64(1), tracer.Stats().Suppressed)
+}
+
+func TestTracer_StrictWhere(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	sink := &memorySink{}
+
+	db, tracer := TraceDB(db, WithSink(sink), WithStrictWhere())
+	a.Equal(ErrMissingWhere, db.Model(&models.Account{}).Updates(map[string]interface{}{"status": models.Status_Disabled}).Error)
+	a.Equal(ErrMissingWhere, db.Delete(&models.Account{}).Error)
+	a.NoError(db.Delete(&models.Account{Id: 1}).Error)
+	tracer.Close()
+
+	for _, q := range fdb.queries {
+		a.NotContains(q, "UPDATE \"accounts\" SET")
+	}
+	events := sink.Events()
+	a.Equal(ErrMissingWhere.Error(), events[0].Errors[0].Error())
+
+	// Closing the tracer removes the guard.
+	a.NoError(db.Delete(&models.Account{}).Error)
+}
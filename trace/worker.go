@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+)
+
+// WorkerKey is the scope setting labelling the worker issuing operations,
+// recorded on their events:
+//
+//	db.Set(trace.WorkerKey, "billing-worker-3").Find(&invoices)
+const WorkerKey = "gormsanity:worker"
+
+// Worker returns a handle of db whose operations are labelled as issued by
+// worker.
+func Worker(db *gorm.DB, worker string) *gorm.DB {
+	return db.Set(WorkerKey, worker)
+}
+
+func workerOf(scope *gorm.Scope) string {
+	if v, ok := scope.Get(WorkerKey); ok {
+		if worker, ok := v.(string); ok {
+			return worker
+		}
+	}
+	return ""
+}
+
+// goroutineID returns the ID of the calling goroutine, parsed from the
+// header of its stack trace, or 0 if it can't be found. Go doesn't expose
+// it otherwise, as it's only meant for debugging.
+func goroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, err := strconv.ParseUint(string(buf), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return id
+}
@@ -0,0 +1,22 @@
+package trace
+
+import "fmt"
+
+// zeroRowDetector flags updates and deletes that succeeded without
+// affecting any rows, often because their conditions matched nothing by
+// mistake, unless their fingerprint is allowed, see
+// WithZeroRowWriteDetection.
+type zeroRowDetector struct {
+	allowed map[string]bool
+}
+
+func (d *zeroRowDetector) rule() string { return "zero_row_write" }
+
+func (d *zeroRowDetector) observe(e *GormEvent) []*Violation {
+	if e.EventType != "update" && e.EventType != "delete" || e.RowsAffected != 0 || len(e.Errors) > 0 || d.allowed[e.Fingerprint] {
+		return nil
+	}
+	e.Warnings = append(e.Warnings, d.rule())
+	msg := fmt.Sprintf("%s on %s affected no rows", e.EventType, e.TableName)
+	return singleViolation(d.rule(), e, msg)
+}
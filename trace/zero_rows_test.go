@@ -0,0 +1,38 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/joeandaverde/gormsanity/internal/models"
+)
+
+func TestTracer_ZeroRowWrite(t *testing.T) {
+	a := require.New(t)
+	db, fdb := openFakeDB(t)
+	sink := &memorySink{}
+
+	allowed := Fingerprint(`DELETE FROM "accounts"  WHERE "accounts"."id" = $1`)
+	db, tracer := TraceDB(db, WithSink(sink), WithZeroRowWriteDetection(allowed))
+	fdb.rowsAffected = 0
+	a.NoError(db.Model(&models.Account{Id: 1}).Update("nick_name", "jane").Error)
+	a.NoError(db.Delete(&models.Account{Id: 1}).Error)
+	fdb.rowsAffected = 1
+	a.NoError(db.Model(&models.Account{Id: 1}).Update("nick_name", "jane").Error)
+	tracer.Close()
+
+	var flagged []bool
+	var violations []*Violation
+	for _, e := range sink.Events() {
+		if e.Violation != nil {
+			violations = append(violations, e.Violation)
+			continue
+		}
+		flagged = append(flagged, hasWarning(e, "zero_row_write"))
+	}
+	a.Equal([]bool{true, false, false}, flagged)
+	a.Len(violations, 1)
+	a.Equal("zero_row_write", violations[0].Rule)
+	a.Regexp(`^update on accounts affected no rows at .*zero_rows_test.go:\d+$`, violations[0].Message)
+}